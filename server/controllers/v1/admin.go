@@ -0,0 +1,102 @@
+package v1
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"hound/helpers"
+	"hound/model"
+	"hound/model/database"
+	"hound/view"
+	"strconv"
+)
+
+type ResetPasswordRequest struct {
+	NewPassword string `json:"new_password" binding:"required,gte=8"`
+}
+
+func AdminListUsersHandler(c *gin.Context) {
+	limit, offset, err := getLimitOffset(c)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	users, totalRecords, err := database.ListUsers(limit, offset)
+	if err != nil {
+		helpers.ErrorResponse(c, errors.New(helpers.InternalServerError))
+		return
+	}
+	viewArray := []view.AdminUserView{}
+	for _, user := range users {
+		viewArray = append(viewArray, view.AdminUserView{
+			UserID:     user.Id,
+			Username:   user.Username,
+			FirstName:  user.FirstName,
+			LastName:   user.LastName,
+			UserMeta:   user.UserMeta,
+			IsAdmin:    user.IsAdmin,
+			IsDisabled: user.IsDisabled,
+			CreatedAt:  user.CreatedAt,
+			UpdatedAt:  user.UpdatedAt,
+		})
+	}
+	helpers.SuccessResponse(c, view.AdminUsersView{
+		Results:      &viewArray,
+		TotalRecords: totalRecords,
+		Limit:        limit,
+		Offset:       offset,
+	}, 200)
+}
+
+func AdminDisableUserHandler(c *gin.Context) {
+	adminSetUserFlag(c, func(userID int64) error {
+		return model.SetUserDisabled(userID, true)
+	})
+}
+
+func AdminEnableUserHandler(c *gin.Context) {
+	adminSetUserFlag(c, func(userID int64) error {
+		return model.SetUserDisabled(userID, false)
+	})
+}
+
+func AdminPromoteUserHandler(c *gin.Context) {
+	adminSetUserFlag(c, func(userID int64) error {
+		return model.SetUserAdmin(userID, true)
+	})
+}
+
+func AdminDemoteUserHandler(c *gin.Context) {
+	adminSetUserFlag(c, func(userID int64) error {
+		return model.SetUserAdmin(userID, false)
+	})
+}
+
+func AdminForceLogoutHandler(c *gin.Context) {
+	adminSetUserFlag(c, model.ForceLogout)
+}
+
+func AdminResetPasswordHandler(c *gin.Context) {
+	body := ResetPasswordRequest{}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Failed to bind reset password body"))
+		return
+	}
+	adminSetUserFlag(c, func(userID int64) error {
+		return model.ResetUserPassword(userID, body.NewPassword)
+	})
+}
+
+// adminSetUserFlag parses the :id user param and applies action
+func adminSetUserFlag(c *gin.Context, action func(userID int64) error) {
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid user id in url param"))
+		return
+	}
+	err = action(userID)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	helpers.SuccessResponse(c, gin.H{"status": "success"}, 200)
+}
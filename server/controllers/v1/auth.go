@@ -1,4 +1,4 @@
-	package v1
+package v1
 
 import (
 	"errors"
@@ -6,13 +6,26 @@ import (
 	"github.com/spf13/viper"
 	"hound/helpers"
 	"hound/model"
+	"strconv"
 )
 
+const (
+	accessTokenCookie  = "token"
+	refreshTokenCookie = "refresh_token"
+	// refresh token cookie is only sent to auth endpoints
+	refreshTokenCookiePath = "/api/v1/auth"
+)
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
 func RegistrationHandler(c *gin.Context) {
 	if !viper.GetBool("auth.allow-registration") {
 		err := errors.New(helpers.BadRequest)
 		_ = helpers.LogErrorWithMessage(err, "Registration is currently disabled")
 		helpers.ErrorResponse(c, err)
+		return
 	}
 	userPayload := model.RegistrationUser{}
 	if err := c.ShouldBindJSON(&userPayload); err != nil {
@@ -30,13 +43,13 @@ func RegistrationHandler(c *gin.Context) {
 		Username: userPayload.Username,
 		Password: userPayload.Password,
 	}
-	token, err := model.GenerateAccessToken(tokenPayload, client)
+	tokens, err := model.GenerateAccessToken(tokenPayload, client)
 	if err != nil {
 		helpers.ErrorResponse(c, err)
 		return
 	}
-	c.SetCookie("token", token, viper.GetInt("jwt-access-token-expiration"), "/", "", true, true)
-	helpers.SuccessResponse(c, gin.H{"status": "success", "username": userPayload.Username}, 200)
+	setAuthCookies(c, tokens)
+	helpers.SuccessResponse(c, authResponse(tokens), 200)
 }
 
 func LoginHandler(c *gin.Context) {
@@ -53,11 +66,64 @@ func LoginHandler(c *gin.Context) {
 		helpers.ErrorResponse(c, err)
 		return
 	}
-	token, err := model.GenerateAccessToken(userPayload, client)
+	tokens, err := model.GenerateAccessToken(userPayload, client)
 	if err != nil {
 		helpers.ErrorResponse(c, err)
 		return
 	}
-	c.SetCookie("token", token, viper.GetInt("jwt-access-token-expiration"), "/", "", true, true)
-	helpers.SuccessResponse(c, gin.H{"status": "success", "username": userPayload.Username}, 200)
-}
\ No newline at end of file
+	setAuthCookies(c, tokens)
+	helpers.SuccessResponse(c, authResponse(tokens), 200)
+}
+
+// RefreshHandler accepts the refresh token from its cookie or the request body
+func RefreshHandler(c *gin.Context) {
+	refreshToken, err := c.Cookie(refreshTokenCookie)
+	if err != nil || refreshToken == "" {
+		body := RefreshTokenRequest{}
+		if err := c.ShouldBindJSON(&body); err != nil || body.RefreshToken == "" {
+			helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.Unauthorized), "No refresh token supplied"))
+			return
+		}
+		refreshToken = body.RefreshToken
+	}
+	tokens, err := model.RefreshAccessToken(refreshToken)
+	if err != nil {
+		helpers.ErrorResponse(c, errors.New(helpers.Unauthorized))
+		return
+	}
+	setAuthCookies(c, tokens)
+	helpers.SuccessResponse(c, authResponse(tokens), 200)
+}
+
+// LogoutHandler revokes the session of the calling access token, requires JWTMiddleware
+func LogoutHandler(c *gin.Context) {
+	sessionID, err := strconv.ParseInt(c.GetHeader("X-Session-ID"), 10, 64)
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.Unauthorized), "Invalid session"))
+		return
+	}
+	err = model.RevokeSession(sessionID)
+	if err != nil {
+		helpers.ErrorResponse(c, errors.New(helpers.InternalServerError))
+		return
+	}
+	c.SetCookie(accessTokenCookie, "", -1, "/", "", true, true)
+	c.SetCookie(refreshTokenCookie, "", -1, refreshTokenCookiePath, "", true, true)
+	helpers.SuccessResponse(c, gin.H{"status": "success"}, 200)
+}
+
+func setAuthCookies(c *gin.Context, tokens *model.AuthTokens) {
+	c.SetCookie(accessTokenCookie, tokens.AccessToken, tokens.AccessTokenExpiration, "/", "", true, true)
+	c.SetCookie(refreshTokenCookie, tokens.RefreshToken, tokens.RefreshTokenExpiration, refreshTokenCookiePath, "", true, true)
+}
+
+// tokens are also returned in the body for clients that can't use cookies
+func authResponse(tokens *model.AuthTokens) gin.H {
+	return gin.H{
+		"status":        "success",
+		"username":      tokens.Username,
+		"access_token":  tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.AccessTokenExpiration,
+	}
+}
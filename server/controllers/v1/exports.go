@@ -0,0 +1,38 @@
+package v1
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"hound/helpers"
+	"hound/model/database"
+	"hound/model/exports"
+	"time"
+)
+
+// ExportHandler downloads a zip of the user's collections, comments and history,
+// export.json inside can be imported into another instance with source=hound
+func ExportHandler(c *gin.Context) {
+	username := c.GetHeader("X-Username")
+	userID, err := database.GetUserIDFromUsername(username)
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid user"))
+		return
+	}
+	export, err := exports.GetUserExport(userID, username)
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.InternalServerError), "Failed to export user data"))
+		return
+	}
+	// build the zip first so failures can still return an error response
+	var buffer bytes.Buffer
+	err = exports.WriteExportZip(&buffer, export)
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.InternalServerError), "Failed to write export zip"))
+		return
+	}
+	filename := fmt.Sprintf("hound-export-%s-%s.zip", username, time.Now().Format("2006-01-02"))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Data(200, "application/zip", buffer.Bytes())
+}
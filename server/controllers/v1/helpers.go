@@ -2,19 +2,49 @@ package v1
 
 import (
 	"errors"
+	"github.com/gin-gonic/gin"
 	"hound/helpers"
-	"hound/model/database"
 	"hound/model/sources"
+	"strconv"
 )
 
 func ValidateMediaParams(mediaType string, mediaSource string) error {
-	validType := mediaType == database.MediaTypeTVShow || mediaType == database.MediaTypeMovie || mediaType == database.MediaTypeGame
-	if !validType {
-		return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid media type")
+	// source must be registered and support the media type
+	_, err := sources.GetSourceForMediaType(mediaType, mediaSource)
+	return err
+}
+
+// getLimitOffset parses limit and offset query params, -1 means no limit, offset
+func getLimitOffset(c *gin.Context) (int, int, error) {
+	limitQuery := c.Query("limit")
+	offsetQuery := c.Query("offset")
+	limit := -1
+	offset := -1
+	if limitQuery != "" && offsetQuery != "" {
+		var err error
+		limit, err = strconv.Atoi(limitQuery)
+		if err != nil {
+			_ = helpers.LogErrorWithMessage(err, "Invalid limit query param")
+			return -1, -1, errors.New(helpers.BadRequest)
+		}
+		offset, err = strconv.Atoi(offsetQuery)
+		if err != nil {
+			_ = helpers.LogErrorWithMessage(err, "Invalid offset query param")
+			return -1, -1, errors.New(helpers.BadRequest)
+		}
+	}
+	return limit, offset, nil
+}
+
+// getTrendingParams parses page (default 1) and time_window (day or week, default week) query params
+func getTrendingParams(c *gin.Context) (string, int, error) {
+	timeWindow := c.DefaultQuery("time_window", sources.TrendingTimeWindowWeek)
+	if timeWindow != sources.TrendingTimeWindowDay && timeWindow != sources.TrendingTimeWindowWeek {
+		return "", -1, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid time_window query param")
 	}
-	validSource := mediaSource == sources.SourceTMDB || mediaSource == sources.SourceIGDB
-	if !validSource {
-		return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid media source")
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 || page > sources.TMDBTrendingMaxPage {
+		return "", -1, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid page query param")
 	}
-	return nil
+	return timeWindow, page, nil
 }
@@ -0,0 +1,178 @@
+package v1
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"hound/helpers"
+	"hound/model/database"
+	"hound/model/sources"
+	"hound/view"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type HistoryRequest struct {
+	MediaType     string    `json:"media_type" binding:"required,gt=0"`
+	MediaSource   string    `json:"media_source" binding:"required,gt=0"`
+	SourceID      string    `json:"source_id" binding:"required,gt=0"`
+	SeasonNumber  *int      `json:"season_number"`  // tv shows only, marks the whole season if episode is omitted
+	EpisodeNumber *int      `json:"episode_number"` // tv shows only
+	WatchedAt     time.Time `json:"watched_at"`     // defaults to now
+	Notes         string    `json:"notes"`
+}
+
+// GetHistoryHandler lists the user's watch history, newest first.
+// Optional filters: media_type, media_source + source_id, start_date, end_date
+func GetHistoryHandler(c *gin.Context) {
+	limit, offset, err := getLimitOffset(c)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	userID, err := database.GetUserIDFromUsername(c.GetHeader("X-Username"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid user"))
+		return
+	}
+	query := database.HistoryQuery{UserID: userID}
+	if mediaType := c.Query("media_type"); mediaType != "" {
+		query.MediaType = &mediaType
+	}
+	if c.Query("media_source") != "" && c.Query("source_id") != "" {
+		if query.MediaType == nil {
+			helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "media_type required with source_id"))
+			return
+		}
+		libraryID, err := database.GetInternalLibraryID(*query.MediaType, c.Query("media_source"), c.Query("source_id"))
+		if err != nil {
+			// item was never added, so there is no history
+			helpers.SuccessResponse(c, view.HistoryView{Results: &[]view.HistoryObject{}, Limit: limit, Offset: offset}, 200)
+			return
+		}
+		query.LibraryID = libraryID
+	}
+	query.StartDate, err = parseDateQuery(c.Query("start_date"), false)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	query.EndDate, err = parseDateQuery(c.Query("end_date"), true)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	records, totalRecords, err := database.GetHistory(query, limit, offset)
+	if err != nil {
+		helpers.ErrorResponse(c, errors.New(helpers.InternalServerError))
+		return
+	}
+	helpers.SuccessResponse(c, view.HistoryView{
+		Results:      getHistoryObjects(records),
+		TotalRecords: totalRecords,
+		Limit:        limit,
+		Offset:       offset,
+	}, 200)
+}
+
+func AddHistoryHandler(c *gin.Context) {
+	body := HistoryRequest{}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Failed to bind history body"))
+		return
+	}
+	err := ValidateMediaParams(body.MediaType, body.MediaSource)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	userID, err := database.GetUserIDFromUsername(c.GetHeader("X-Username"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid user"))
+		return
+	}
+	err = sources.AddToHistory(userID, body.MediaType, body.MediaSource, body.SourceID,
+		body.SeasonNumber, body.EpisodeNumber, body.WatchedAt, body.Notes)
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Failed to add history"))
+		return
+	}
+	helpers.SuccessResponse(c, gin.H{"status": "success"}, 200)
+}
+
+// DeleteHistoryHandler deletes comma separated ?ids=, all or nothing
+func DeleteHistoryHandler(c *gin.Context) {
+	userID, err := database.GetUserIDFromUsername(c.GetHeader("X-Username"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid user"))
+		return
+	}
+	var historyIDs []int64
+	for _, item := range strings.Split(c.Query("ids"), ",") {
+		historyID, err := strconv.ParseInt(item, 10, 64)
+		if err != nil {
+			helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid history id in url param"))
+			return
+		}
+		historyIDs = append(historyIDs, historyID)
+	}
+	err = database.DeleteHistory(userID, historyIDs)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	helpers.SuccessResponse(c, gin.H{"status": "success"}, 200)
+}
+
+// parseHistoryTagData parses legacy tag data, S1 (whole season) or S1E3, empty for movies and games
+func parseHistoryTagData(tagData string) (*int, *int, error) {
+	if tagData == "" {
+		return nil, nil, nil
+	}
+	seasonNumber, episodeNumber, ok := database.ParseHistoryTagData(tagData)
+	if !ok {
+		return nil, nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid TagData format, regex failed")
+	}
+	return seasonNumber, episodeNumber, nil
+}
+
+// parseDateQuery accepts RFC3339 or YYYY-MM-DD, date-only end dates include the whole day
+func parseDateQuery(dateQuery string, isEndDate bool) (*time.Time, error) {
+	if dateQuery == "" {
+		return nil, nil
+	}
+	date, err := time.Parse(time.RFC3339, dateQuery)
+	if err == nil {
+		return &date, nil
+	}
+	date, err = time.Parse("2006-01-02", dateQuery)
+	if err != nil {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid date query param "+dateQuery)
+	}
+	if isEndDate {
+		date = date.Add(24*time.Hour - time.Nanosecond)
+	}
+	return &date, nil
+}
+
+func getHistoryObjects(records []database.HistoryGroup) *[]view.HistoryObject {
+	historyObjects := []view.HistoryObject{}
+	for _, item := range records {
+		historyObjects = append(historyObjects, view.HistoryObject{
+			HistoryID:     item.HistoryID,
+			LibraryID:     item.LibraryID,
+			MediaType:     item.MediaType,
+			MediaSource:   item.MediaSource,
+			SourceID:      item.SourceID,
+			MediaTitle:    item.MediaTitle,
+			ThumbnailURL:  item.ThumbnailURL,
+			SeasonNumber:  item.SeasonNumber,
+			EpisodeNumber: item.EpisodeNumber,
+			WatchedAt:     item.WatchedAt,
+			RewatchNumber: item.RewatchNumber,
+			Notes:         string(item.Notes),
+			CreatedAt:     item.CreatedAt,
+		})
+	}
+	return &historyObjects
+}
@@ -0,0 +1,90 @@
+package v1
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"hound/helpers"
+	"hound/model/database"
+	"hound/model/imports"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// max size of an uploaded export file
+const importMaxFileSize = 20 << 20
+
+// StartImportHandler imports an export file in the background, multipart form fields:
+// file, source (trakt, letterboxd, imdb, hound), dry_run (only match rows, nothing is written)
+func StartImportHandler(c *gin.Context) {
+	userID, err := database.GetUserIDFromUsername(c.GetHeader("X-Username"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid user"))
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, importMaxFileSize+(1<<20))
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Missing import file or file too large"))
+		return
+	}
+	if fileHeader.Size > importMaxFileSize {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Import file too large"))
+		return
+	}
+	dryRun := false
+	if c.PostForm("dry_run") != "" {
+		dryRun, err = strconv.ParseBool(c.PostForm("dry_run"))
+		if err != nil {
+			helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid dry_run value"))
+			return
+		}
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.InternalServerError), "Failed to open import file"))
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.InternalServerError), "Failed to read import file"))
+		return
+	}
+	job, err := imports.StartImport(userID, c.PostForm("source"), data, dryRun)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	helpers.SuccessResponse(c, job, 202)
+}
+
+// GetImportJobHandler returns the progress and unmatched rows of an import job
+func GetImportJobHandler(c *gin.Context) {
+	jobID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid job id in url param"))
+		return
+	}
+	userID, err := database.GetUserIDFromUsername(c.GetHeader("X-Username"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid user"))
+		return
+	}
+	job, err := imports.GetJob(userID, jobID)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	helpers.SuccessResponse(c, job, 200)
+}
+
+// GetImportJobsHandler lists the user's recent import jobs
+func GetImportJobsHandler(c *gin.Context) {
+	userID, err := database.GetUserIDFromUsername(c.GetHeader("X-Username"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid user"))
+		return
+	}
+	helpers.SuccessResponse(c, imports.GetJobs(userID), 200)
+}
@@ -10,7 +10,6 @@ import (
 	"hound/model/database"
 	"hound/model/sources"
 	"hound/view"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -27,6 +26,19 @@ type AddToCollectionRequest struct {
 	CollectionID *int64 `json:"collection_id"`
 }
 
+type MoveCollectionItemRequest struct {
+	MediaSource string `json:"media_source" binding:"required,gt=0"`
+	MediaType   string `json:"media_type"  binding:"required,gt=0"`
+	SourceID    string `json:"source_id" binding:"required,gt=0"`
+	Position    *int   `json:"position" binding:"required,gte=0"` // 0 is the top of the collection
+}
+
+type BatchCollectionRequest struct {
+	Action             string                   `json:"action" binding:"required,gt=0"` // add, remove, move, copy
+	Items              []sources.CollectionItem `json:"items" binding:"required,dive"`
+	TargetCollectionID *int64                   `json:"target_collection_id"` // move, copy only
+}
+
 type CommentRequest struct {
 	CommentType  string    `json:"comment_type" binding:"required,gt=0"` // review, etc.
 	IsPrivate    bool      `json:"is_private"`
@@ -38,6 +50,18 @@ type CommentRequest struct {
 	Score        int       `json:"score"`    // only for reviews
 }
 
+// UpdateCommentRequest only updates fields that are present
+type UpdateCommentRequest struct {
+	CommentType  *string    `json:"comment_type"`
+	IsPrivate    *bool      `json:"is_private"`
+	CommentTitle *string    `json:"title"`
+	Comment      *string    `json:"comment"`
+	StartDate    *time.Time `json:"start_date"`
+	EndDate      *time.Time `json:"end_date"`
+	TagData      *string    `json:"tag_data"`
+	Score        *int       `json:"score"`
+}
+
 func GeneralSearchHandler(c *gin.Context) {
 	queryString := c.Query("q")
 	// search tmdb
@@ -61,7 +85,7 @@ func GetMediaBackdrops(c *gin.Context) {
 		helpers.SuccessResponse(c, gin.H{"backdrop_urls": backdropsCache}, 200)
 		return
 	}
-	shows, err := sources.GetTrendingTVShowsTMDB("1")
+	shows, err := sources.GetTrendingTVShowsTMDB(sources.TrendingTimeWindowWeek, 1)
 	if err != nil {
 		helpers.ErrorResponse(c, errors.New(helpers.InternalServerError))
 		return
@@ -75,7 +99,7 @@ func GetMediaBackdrops(c *gin.Context) {
 			}
 		}
 	}
-	movies, err := sources.GetTrendingMoviesTMDB("1")
+	movies, err := sources.GetTrendingMoviesTMDB(sources.TrendingTimeWindowWeek, 1)
 	if err != nil {
 		helpers.ErrorResponse(c, errors.New(helpers.InternalServerError))
 		return
@@ -113,32 +137,11 @@ func AddToCollectionHandler(c *gin.Context) {
 		helpers.ErrorResponse(c, err)
 		return
 	}
-	// get source ID as int, right now all sources have int ids
-	sourceID, err := strconv.Atoi(body.SourceID)
+	err = sources.AddToCollection(username, body.MediaType, body.MediaSource, body.SourceID, body.CollectionID)
 	if err != nil {
-		_ = helpers.LogErrorWithMessage(err, "Failed to convert sourceID string to int")
-		helpers.ErrorResponse(c, err)
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Failed to add item to collection"))
 		return
 	}
-	if body.MediaType == database.MediaTypeTVShow {
-		err = sources.AddTVShowToCollectionTMDB(username, body.MediaSource, sourceID, body.CollectionID)
-		if err != nil {
-			helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Failed to add tv show to collection"))
-			return
-		}
-	} else if body.MediaType == database.MediaTypeMovie {
-		err = sources.AddMovieToCollectionTMDB(username, body.MediaSource, sourceID, body.CollectionID)
-		if err != nil {
-			helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Failed to add movie to collection"))
-			return
-		}
-	} else if body.MediaType == database.MediaTypeGame {
-		err = sources.AddGameToCollectionIGDB(username, body.MediaSource, sourceID, body.CollectionID)
-		if err != nil {
-			helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Failed to add game to collection"))
-			return
-		}
-	}
 	helpers.SuccessResponse(c, gin.H{"status": "success"}, 200)
 }
 
@@ -186,8 +189,9 @@ func GetUserCollectionsHandler(c *gin.Context) {
 		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid user"))
 		return
 	}
+	// owned collections and collections shared with the user
 	query := database.CollectionRecordQuery{
-		OwnerID: &userID,
+		MemberID: &userID,
 	}
 	records, _, err := database.SearchForCollection(query, -1, -1)
 	if err != nil {
@@ -196,15 +200,21 @@ func GetUserCollectionsHandler(c *gin.Context) {
 	}
 	var collectionResponse []view.CollectionRecordView
 	for _, record := range records {
+		owner, err := database.GetUsernameFromID(record.OwnerID)
+		if err != nil {
+			helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid user"))
+			return
+		}
 		temp := view.CollectionRecordView{
 			CollectionID:    record.CollectionID,
 			CollectionTitle: record.CollectionTitle,
 			Description:     string(record.Description),
-			Username:        c.GetHeader("X-Username"),
+			Username:        owner,
 			IsPrimary:       record.IsPrimary,
 			IsPublic:        record.IsPublic,
 			Tags:            record.Tags,
 			ThumbnailURL:    record.ThumbnailURL,
+			Rules:           record.Rules,
 			CreatedAt:       record.CreatedAt,
 			UpdatedAt:       record.UpdatedAt,
 		}
@@ -230,30 +240,243 @@ func CreateCollectionHandler(c *gin.Context) {
 	}
 	body.OwnerID = userID
 	collectionID, err := database.CreateCollection(body)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
 	helpers.SuccessResponse(c, gin.H{"status": "success", "collection_id": collectionID}, 200)
 }
 
-func GetCollectionContentsHandler(c *gin.Context) {
-	idParam := c.Param("id")
-	limitQuery := c.Query("limit")
-	offsetQuery := c.Query("offset")
-	// -1 means no limit, offset
-	limit := -1
-	offset := -1
-	if limitQuery != "" && offsetQuery != "" {
-		var err error
-		limit, err = strconv.Atoi(limitQuery)
+// GetPublicCollectionsHandler lists public collections of every user.
+// Optional filters: q (title, description), tags (comma separated names), owner (username),
+// sort (newest, most_items, most_followed), limit, offset
+func GetPublicCollectionsHandler(c *gin.Context) {
+	limit, offset, err := getLimitOffset(c)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	userID, err := database.GetUserIDFromUsername(c.GetHeader("X-Username"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid user"))
+		return
+	}
+	isPublic := true
+	query := database.CollectionRecordQuery{IsPublic: &isPublic}
+	if searchQuery := c.Query("q"); searchQuery != "" {
+		query.SearchQuery = &searchQuery
+	}
+	if tagsQuery := c.Query("tags"); tagsQuery != "" {
+		var tags []database.TagObject
+		for _, item := range strings.Split(tagsQuery, ",") {
+			if strings.TrimSpace(item) != "" {
+				tags = append(tags, database.TagObject{TagName: strings.TrimSpace(item)})
+			}
+		}
+		query.Tags = &tags
+	}
+	if owner := c.Query("owner"); owner != "" {
+		ownerID, err := database.GetUserIDFromUsername(owner)
+		if err != nil {
+			// unknown owner, no collections
+			helpers.SuccessResponse(c, view.PublicCollectionsView{Results: &[]view.PublicCollectionObject{}, Limit: limit, Offset: offset}, 200)
+			return
+		}
+		query.OwnerID = &ownerID
+	}
+	sortBy := c.DefaultQuery("sort", database.CollectionSortNewest)
+	if sortBy != database.CollectionSortNewest && sortBy != database.CollectionSortMostItems &&
+		sortBy != database.CollectionSortMostFollowed {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid sort query param"))
+		return
+	}
+	query.SortBy = &sortBy
+	records, totalRecords, err := database.SearchForCollection(query, limit, offset)
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Error searching collection"))
+		return
+	}
+	collections := []view.PublicCollectionObject{}
+	for _, record := range records {
+		owner, err := database.GetUsernameFromID(record.OwnerID)
+		if err != nil {
+			helpers.ErrorResponse(c, errors.New(helpers.InternalServerError))
+			return
+		}
+		itemCount, err := database.CountCollectionItems(record.CollectionID)
 		if err != nil {
-			_ = helpers.LogErrorWithMessage(err, "Invalid limit query param")
-			helpers.ErrorResponse(c, errors.New(helpers.BadRequest))
+			helpers.ErrorResponse(c, errors.New(helpers.InternalServerError))
 			return
 		}
-		offset, err = strconv.Atoi(offsetQuery)
+		followerCount, err := database.CountCollectionFollowers(record.CollectionID)
 		if err != nil {
-			_ = helpers.LogErrorWithMessage(err, "Invalid offset query param")
-			helpers.ErrorResponse(c, errors.New(helpers.BadRequest))
+			helpers.ErrorResponse(c, errors.New(helpers.InternalServerError))
 			return
 		}
+		isFollowing, err := database.IsFollowingCollection(userID, record.CollectionID)
+		if err != nil {
+			helpers.ErrorResponse(c, errors.New(helpers.InternalServerError))
+			return
+		}
+		collections = append(collections, view.PublicCollectionObject{
+			CollectionRecordView: view.CollectionRecordView{
+				CollectionID:    record.CollectionID,
+				CollectionTitle: record.CollectionTitle,
+				Description:     string(record.Description),
+				Username:        owner,
+				IsPrimary:       record.IsPrimary,
+				IsPublic:        record.IsPublic,
+				Tags:            record.Tags,
+				ThumbnailURL:    record.ThumbnailURL,
+				Rules:           record.Rules,
+				CreatedAt:       record.CreatedAt,
+				UpdatedAt:       record.UpdatedAt,
+			},
+			ItemCount:     itemCount,
+			FollowerCount: followerCount,
+			IsFollowing:   isFollowing,
+		})
+	}
+	helpers.SuccessResponse(c, view.PublicCollectionsView{
+		Results:      &collections,
+		TotalRecords: totalRecords,
+		Limit:        limit,
+		Offset:       offset,
+	}, 200)
+}
+
+func FollowCollectionHandler(c *gin.Context) {
+	collectionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid collection id in url param"))
+		return
+	}
+	userID, err := database.GetUserIDFromUsername(c.GetHeader("X-Username"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid user"))
+		return
+	}
+	err = database.FollowCollection(userID, int64(collectionID))
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	helpers.SuccessResponse(c, gin.H{"status": "success"}, 200)
+}
+
+func UnfollowCollectionHandler(c *gin.Context) {
+	collectionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid collection id in url param"))
+		return
+	}
+	userID, err := database.GetUserIDFromUsername(c.GetHeader("X-Username"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid user"))
+		return
+	}
+	err = database.UnfollowCollection(userID, int64(collectionID))
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	helpers.SuccessResponse(c, gin.H{"status": "success"}, 200)
+}
+
+// BatchCollectionHandler adds, removes, moves or copies many items at once. All items succeed
+// or nothing is applied, status is success or failed and the response reports the result of every item
+func BatchCollectionHandler(c *gin.Context) {
+	body := BatchCollectionRequest{}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Failed to bind batch body"))
+		return
+	}
+	collectionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid collection id in url param"))
+		return
+	}
+	userID, err := database.GetUserIDFromUsername(c.GetHeader("X-Username"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid user"))
+		return
+	}
+	results, success, err := sources.BatchCollectionItems(userID, body.Action, int64(collectionID), body.TargetCollectionID, body.Items)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	// a failed batch is still a 200, the client needs the results to see which items failed
+	status := "success"
+	if !success {
+		status = "failed"
+	}
+	helpers.SuccessResponse(c, gin.H{"status": status, "results": results}, 200)
+}
+
+func UpdateCollectionHandler(c *gin.Context) {
+	body := database.UpdateCollectionRequest{}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Failed to bind collection body"))
+		return
+	}
+	if body.CollectionTitle != nil && strings.TrimSpace(*body.CollectionTitle) == "" {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Collection title cannot be empty"))
+		return
+	}
+	collectionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid collection id in url param"))
+		return
+	}
+	userID, err := database.GetUserIDFromUsername(c.GetHeader("X-Username"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid user"))
+		return
+	}
+	err = database.UpdateCollection(userID, int64(collectionID), body)
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Failed to update collection"))
+		return
+	}
+	helpers.SuccessResponse(c, gin.H{"status": "success"}, 200)
+}
+
+func MoveCollectionItemHandler(c *gin.Context) {
+	body := MoveCollectionItemRequest{}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Failed to bind move body"))
+		return
+	}
+	collectionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid collection id in url param"))
+		return
+	}
+	userID, err := database.GetUserIDFromUsername(c.GetHeader("X-Username"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid user"))
+		return
+	}
+	libraryID, err := database.GetInternalLibraryID(body.MediaType, body.MediaSource, body.SourceID)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	err = database.MoveCollectionRelation(userID, *libraryID, int64(collectionID), *body.Position)
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Failed to move collection item"))
+		return
+	}
+	helpers.SuccessResponse(c, gin.H{"status": "success"}, 200)
+}
+
+func GetCollectionContentsHandler(c *gin.Context) {
+	idParam := c.Param("id")
+	limit, offset, err := getLimitOffset(c)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
 	}
 	userID, err := database.GetUserIDFromUsername(c.GetHeader("X-Username"))
 	if err != nil {
@@ -302,6 +525,7 @@ func GetCollectionContentsHandler(c *gin.Context) {
 			IsPublic:        collection.IsPublic,
 			Tags:            collection.Tags,
 			ThumbnailURL:    collection.ThumbnailURL,
+			Rules:           collection.Rules,
 			CreatedAt:       collection.CreatedAt,
 			UpdatedAt:       collection.UpdatedAt,
 		},
@@ -377,6 +601,10 @@ func PostCommentHandler(c *gin.Context) {
 	}
 	idParam := c.Param("id")
 	mediaSource, sourceID, err := ParseID(idParam)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
 	requestURL := strings.Split(c.Request.URL.Path, "/")
 	if len(requestURL) <= 0 {
 		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.InternalServerError), "request url invalid (should not happen)"))
@@ -398,6 +626,22 @@ func PostCommentHandler(c *gin.Context) {
 		helpers.ErrorResponse(c, err)
 		return
 	}
+	// history is stored in its own table, comment_type history kept for older clients
+	if body.CommentType == "history" {
+		seasonNumber, episodeNumber, err := parseHistoryTagData(body.TagData)
+		if err != nil {
+			helpers.ErrorResponse(c, err)
+			return
+		}
+		err = sources.AddToHistory(userID, mediaType, mediaSource, strconv.Itoa(sourceID),
+			seasonNumber, episodeNumber, body.StartDate, body.Comment)
+		if err != nil {
+			helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Failed to add history"))
+			return
+		}
+		helpers.SuccessResponse(c, gin.H{"status": "success"}, 200)
+		return
+	}
 	comment := database.CommentRecord{
 		UserID:       userID,
 		CommentTitle: body.CommentTitle,
@@ -409,74 +653,18 @@ func PostCommentHandler(c *gin.Context) {
 		TagData:      body.TagData,
 		Score:        body.Score,
 	}
-	if mediaType == database.MediaTypeTVShow || mediaType == database.MediaTypeMovie {
-		record, err := sources.GetLibraryObjectTMDB(mediaType, sourceID)
-		if err != nil {
-			helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.InternalServerError), "Failed to get library object tmdb"))
-			return
-		}
-		// TODO bound checking for tag data (season and episode)
-		// add item to internal library if not there
-		libraryID, err := database.AddRecordToInternalLibrary(record)
-		if err != nil {
-			helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.InternalServerError), "Failed to insert record to library"))
-			return
-		}
-		if mediaType == database.MediaTypeTVShow && body.CommentType == "history" {
-			if match, _ := regexp.MatchString(`S\d+$|S\d+E\d+$`, body.TagData); !match {
-				fmt.Println(body.TagData)
-				helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid TagData format, regex failed"))
-				return
-			}
-			// mark seasons as watch case, no episode data
-			if !strings.Contains(body.TagData, "E") {
-				seasonNumber, err := strconv.Atoi(strings.Split(body.TagData, "E")[0][1:])
-				if err != nil {
-					helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid TagData format"))
-					return
-				}
-				season, err := sources.GetTVSeasonTMDB(sourceID, seasonNumber, nil)
-				if err != nil {
-					helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Error retrieving season"))
-					return
-				}
-				minEpisode := season.Episodes[0].EpisodeNumber
-				maxEpisode := 0
-				for _, ep := range season.Episodes {
-					if ep.EpisodeNumber < minEpisode {
-						minEpisode = ep.EpisodeNumber
-					}
-					if ep.EpisodeNumber > maxEpisode {
-						maxEpisode = ep.EpisodeNumber
-					}
-				}
-				err = sources.MarkTVSeasonAsWatchedTMDB(userID, libraryID, seasonNumber, minEpisode, maxEpisode, body.StartDate)
-				if err != nil {
-					helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.InternalServerError), "Error during batch insertion"))
-					return
-				}
-				helpers.SuccessResponse(c, gin.H{"status": "success"}, 200)
-				return
-			}
-		}
-		comment.LibraryID = libraryID
-	} else if mediaType == database.MediaTypeGame {
-		record, err := sources.GetLibraryObjectIGDB(sourceID)
-		if err != nil {
-			helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.InternalServerError), "Failed to get library object tmdb"))
-			return
-		}
-		// add item to internal library if not there
-		libraryID, err := database.AddRecordToInternalLibrary(record)
-		if err != nil {
-			helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.InternalServerError), "Failed to insert record to library"))
-			return
-		}
-		comment.LibraryID = libraryID
-	} else {
-		helpers.ErrorResponse(c, errors.New(helpers.BadRequest))
+	record, err := sources.GetLibraryObject(mediaType, mediaSource, strconv.Itoa(sourceID))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.InternalServerError), "Failed to get library object"))
 		return
 	}
+	// add item to internal library if not there
+	libraryID, err := database.AddRecordToInternalLibrary(record)
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.InternalServerError), "Failed to insert record to library"))
+		return
+	}
+	comment.LibraryID = libraryID
 	err = database.AddComment(&comment)
 	if err != nil {
 		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.InternalServerError), "Failed to add comment"))
@@ -540,33 +728,149 @@ func ParseID(idParam string) (string, int, error) {
 	return mediaSource, sourceID, nil
 }
 
-func GetCommentsCore(username string, libraryID int64, commentType *string) (*[]view.CommentObject, error) {
-	comments, err := database.GetComments(libraryID, commentType)
+// UpdateCommentHandler edits a comment owned by the user, the previous version is kept in the edit history
+func UpdateCommentHandler(c *gin.Context) {
+	commentID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		return nil, err
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid comment id in url param"))
+		return
 	}
-	var commentsView []view.CommentObject
-	for _, item := range *comments {
-		commenter, _ := database.GetUsernameFromID(item.UserID)
-		if item.IsPrivate && username != commenter {
+	body := UpdateCommentRequest{}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Failed to bind comment body"))
+		return
+	}
+	username := c.GetHeader("X-Username")
+	userID, err := database.GetUserIDFromUsername(username)
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid user"))
+		return
+	}
+	comment, err := database.GetComment(commentID)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	if comment.UserID != userID {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.Forbidden), "Comment belongs to another user"))
+		return
+	}
+	if body.CommentType != nil {
+		comment.CommentType = *body.CommentType
+	}
+	if body.IsPrivate != nil {
+		comment.IsPrivate = *body.IsPrivate
+	}
+	if body.CommentTitle != nil {
+		comment.CommentTitle = *body.CommentTitle
+	}
+	if body.Comment != nil {
+		comment.Comment = []byte(*body.Comment)
+	}
+	if body.StartDate != nil {
+		comment.StartDate = *body.StartDate
+	}
+	if body.EndDate != nil {
+		comment.EndDate = *body.EndDate
+	}
+	if body.TagData != nil {
+		comment.TagData = *body.TagData
+	}
+	if body.Score != nil {
+		comment.Score = *body.Score
+	}
+	err = database.UpdateComment(userID, comment)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	comment, err = database.GetComment(commentID)
+	if err != nil {
+		helpers.ErrorResponse(c, errors.New(helpers.InternalServerError))
+		return
+	}
+	helpers.SuccessResponse(c, getCommentObject(*comment, username), 200)
+}
+
+// GetCommentEditsHandler lists previous versions of a comment, private comments and private versions only to their owner
+func GetCommentEditsHandler(c *gin.Context) {
+	commentID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid comment id in url param"))
+		return
+	}
+	userID, err := database.GetUserIDFromUsername(c.GetHeader("X-Username"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid user"))
+		return
+	}
+	comment, err := database.GetComment(commentID)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	if comment.IsPrivate && comment.UserID != userID {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.Forbidden), "Comment is private"))
+		return
+	}
+	edits, err := database.GetCommentEdits(commentID)
+	if err != nil {
+		helpers.ErrorResponse(c, errors.New(helpers.InternalServerError))
+		return
+	}
+	editsView := []view.CommentEditObject{}
+	for _, item := range edits {
+		// versions from while the comment was private stay private
+		if item.IsPrivate && comment.UserID != userID {
 			continue
 		}
-		comment := view.CommentObject{
-			CommentTitle: item.CommentTitle,
+		editsView = append(editsView, view.CommentEditObject{
+			EditID:       item.EditID,
 			CommentID:    item.CommentID,
 			CommentType:  item.CommentType,
-			UserID:       commenter,
-			LibraryID:    item.LibraryID,
 			IsPrivate:    item.IsPrivate,
+			CommentTitle: item.CommentTitle,
 			Comment:      string(item.Comment),
 			TagData:      item.TagData,
 			Score:        item.Score,
 			StartDate:    item.StartDate,
 			EndDate:      item.EndDate,
-			CreatedAt:    item.CreatedAt,
-			UpdatedAt:    item.UpdatedAt,
+			EditedAt:     item.EditedAt,
+		})
+	}
+	helpers.SuccessResponse(c, editsView, 200)
+}
+
+func GetCommentsCore(username string, libraryID int64, commentType *string) (*[]view.CommentObject, error) {
+	comments, err := database.GetComments(libraryID, commentType)
+	if err != nil {
+		return nil, err
+	}
+	var commentsView []view.CommentObject
+	for _, item := range *comments {
+		commenter, _ := database.GetUsernameFromID(item.UserID)
+		if item.IsPrivate && username != commenter {
+			continue
 		}
-		commentsView = append(commentsView, comment)
+		commentsView = append(commentsView, getCommentObject(item, commenter))
 	}
 	return &commentsView, nil
 }
+
+func getCommentObject(item database.CommentRecord, commenter string) view.CommentObject {
+	return view.CommentObject{
+		CommentTitle: item.CommentTitle,
+		CommentID:    item.CommentID,
+		CommentType:  item.CommentType,
+		UserID:       commenter,
+		LibraryID:    item.LibraryID,
+		IsPrivate:    item.IsPrivate,
+		Comment:      string(item.Comment),
+		TagData:      item.TagData,
+		Score:        item.Score,
+		StartDate:    item.StartDate,
+		EndDate:      item.EndDate,
+		CreatedAt:    item.CreatedAt,
+		UpdatedAt:    item.UpdatedAt,
+	}
+}
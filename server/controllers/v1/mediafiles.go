@@ -0,0 +1,145 @@
+package v1
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"hound/helpers"
+	"hound/model/database"
+	"hound/model/media"
+	"hound/view"
+	"strconv"
+)
+
+type MatchMediaFileRequest struct {
+	MediaType     string `json:"media_type" binding:"required"`
+	MediaSource   string `json:"media_source" binding:"required"`
+	SourceID      string `json:"source_id" binding:"required"`
+	SeasonNumber  *int   `json:"season_number"`
+	EpisodeNumber *int   `json:"episode_number"`
+}
+
+// StartMediaScanHandler scans the library roots in the background
+func StartMediaScanHandler(c *gin.Context) {
+	err := media.StartScan()
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	helpers.SuccessResponse(c, media.GetScanStatus(), 202)
+}
+
+func GetMediaScanHandler(c *gin.Context) {
+	helpers.SuccessResponse(c, media.GetScanStatus(), 200)
+}
+
+// GetMediaFilesHandler lists scanned files, query params: status (matched, unmatched, manual), library_id
+func GetMediaFilesHandler(c *gin.Context) {
+	limit, offset, err := getLimitOffset(c)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	query := database.MediaFileQuery{}
+	if status := c.Query("status"); status != "" {
+		if status != database.MediaFileStatusMatched && status != database.MediaFileStatusUnmatched &&
+			status != database.MediaFileStatusManual {
+			helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid status"))
+			return
+		}
+		query.MatchStatus = &status
+	}
+	if c.Query("library_id") != "" {
+		libraryID, err := strconv.ParseInt(c.Query("library_id"), 10, 64)
+		if err != nil {
+			helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid library_id"))
+			return
+		}
+		query.LibraryID = &libraryID
+	}
+	files, totalRecords, err := database.GetMediaFiles(query, limit, offset)
+	if err != nil {
+		helpers.ErrorResponse(c, errors.New(helpers.InternalServerError))
+		return
+	}
+	viewArray, err := mediaFilesToView(files)
+	if err != nil {
+		helpers.ErrorResponse(c, errors.New(helpers.InternalServerError))
+		return
+	}
+	helpers.SuccessResponse(c, view.MediaFilesView{
+		Results:      &viewArray,
+		TotalRecords: totalRecords,
+		Limit:        limit,
+		Offset:       offset,
+	}, 200)
+}
+
+// MatchMediaFileHandler overrides the match of a file, kept on later scans
+func MatchMediaFileHandler(c *gin.Context) {
+	fileID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid file id in url param"))
+		return
+	}
+	body := MatchMediaFileRequest{}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Failed to bind match body"))
+		return
+	}
+	file, err := media.MatchMediaFile(fileID, body.MediaType, body.MediaSource, body.SourceID, body.SeasonNumber, body.EpisodeNumber)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	viewArray, err := mediaFilesToView([]database.MediaFile{*file})
+	if err != nil {
+		helpers.ErrorResponse(c, errors.New(helpers.InternalServerError))
+		return
+	}
+	helpers.SuccessResponse(c, viewArray[0], 200)
+}
+
+func mediaFilesToView(files []database.MediaFile) ([]view.MediaFileObject, error) {
+	var libraryIDs []int64
+	for _, file := range files {
+		if file.LibraryID != nil {
+			libraryIDs = append(libraryIDs, *file.LibraryID)
+		}
+	}
+	records, err := database.GetLibraryRecords(libraryIDs)
+	if err != nil {
+		return nil, err
+	}
+	recordMap := map[int64]database.LibraryRecord{}
+	for _, record := range records {
+		recordMap[record.LibraryID] = record
+	}
+	viewArray := []view.MediaFileObject{}
+	for _, file := range files {
+		object := view.MediaFileObject{
+			FileID:        file.FileID,
+			Path:          file.Path,
+			LibraryRoot:   file.LibraryRoot,
+			Size:          file.Size,
+			ModTime:       file.ModTime,
+			MatchStatus:   file.MatchStatus,
+			MediaType:     file.MediaType,
+			ParsedTitle:   file.ParsedTitle,
+			ParsedYear:    file.ParsedYear,
+			SeasonNumber:  file.SeasonNumber,
+			EpisodeNumber: file.EpisodeNumber,
+			LibraryID:     file.LibraryID,
+			CreatedAt:     file.CreatedAt,
+			UpdatedAt:     file.UpdatedAt,
+		}
+		if file.LibraryID != nil {
+			if record, ok := recordMap[*file.LibraryID]; ok {
+				object.MediaSource = &record.MediaSource
+				object.SourceID = &record.SourceID
+				object.MediaTitle = &record.MediaTitle
+			}
+		}
+		viewArray = append(viewArray, object)
+	}
+	return viewArray, nil
+}
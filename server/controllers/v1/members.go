@@ -0,0 +1,155 @@
+package v1
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"hound/helpers"
+	"hound/model/database"
+	"hound/view"
+	"strconv"
+)
+
+type InviteMemberRequest struct {
+	Username string `json:"username" binding:"required,gt=0"`
+	Role     string `json:"role" binding:"required,gt=0"` // viewer, editor, owner
+}
+
+// GetCollectionMembersHandler lists members of a collection, pending invites are only listed to owners
+func GetCollectionMembersHandler(c *gin.Context) {
+	collectionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid collection id in url param"))
+		return
+	}
+	userID, err := database.GetUserIDFromUsername(c.GetHeader("X-Username"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid user"))
+		return
+	}
+	members, err := database.GetCollectionMembers(userID, int64(collectionID))
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	membersView, err := getCollectionMemberObjects(members)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	helpers.SuccessResponse(c, membersView, 200)
+}
+
+// InviteCollectionMemberHandler invites a user to a collection, or changes the role of an existing member
+func InviteCollectionMemberHandler(c *gin.Context) {
+	body := InviteMemberRequest{}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Failed to bind invite body"))
+		return
+	}
+	collectionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid collection id in url param"))
+		return
+	}
+	userID, err := database.GetUserIDFromUsername(c.GetHeader("X-Username"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid user"))
+		return
+	}
+	inviteeID, err := database.GetUserIDFromUsername(body.Username)
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid invitee"))
+		return
+	}
+	err = database.InviteCollectionMember(userID, int64(collectionID), inviteeID, body.Role)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	helpers.SuccessResponse(c, gin.H{"status": "success"}, 200)
+}
+
+func AcceptCollectionInviteHandler(c *gin.Context) {
+	collectionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid collection id in url param"))
+		return
+	}
+	userID, err := database.GetUserIDFromUsername(c.GetHeader("X-Username"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid user"))
+		return
+	}
+	err = database.AcceptCollectionInvite(userID, int64(collectionID))
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	helpers.SuccessResponse(c, gin.H{"status": "success"}, 200)
+}
+
+// RemoveCollectionMemberHandler removes a member or invite, users can remove themselves to leave or decline
+func RemoveCollectionMemberHandler(c *gin.Context) {
+	collectionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid collection id in url param"))
+		return
+	}
+	userID, err := database.GetUserIDFromUsername(c.GetHeader("X-Username"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid user"))
+		return
+	}
+	memberID, err := database.GetUserIDFromUsername(c.Param("username"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid member"))
+		return
+	}
+	err = database.RemoveCollectionMember(userID, int64(collectionID), memberID)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	helpers.SuccessResponse(c, gin.H{"status": "success"}, 200)
+}
+
+// GetCollectionInvitesHandler lists the user's pending invites
+func GetCollectionInvitesHandler(c *gin.Context) {
+	userID, err := database.GetUserIDFromUsername(c.GetHeader("X-Username"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid user"))
+		return
+	}
+	invites, err := database.GetPendingCollectionInvites(userID)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	invitesView, err := getCollectionMemberObjects(invites)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	helpers.SuccessResponse(c, invitesView, 200)
+}
+
+func getCollectionMemberObjects(members []database.CollectionMember) ([]view.CollectionMemberObject, error) {
+	membersView := []view.CollectionMemberObject{}
+	for _, item := range members {
+		username, err := database.GetUsernameFromID(item.UserID)
+		if err != nil {
+			return nil, helpers.LogErrorWithMessage(errors.New(helpers.InternalServerError), "Invalid member user id")
+		}
+		// inviter may have deleted their account
+		invitedBy, _ := database.GetUsernameFromID(item.InvitedBy)
+		membersView = append(membersView, view.CollectionMemberObject{
+			CollectionID: item.CollectionID,
+			Username:     username,
+			Role:         item.Role,
+			InvitedBy:    invitedBy,
+			IsAccepted:   item.IsAccepted,
+			CreatedAt:    item.CreatedAt,
+		})
+	}
+	return membersView, nil
+}
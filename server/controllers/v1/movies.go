@@ -24,15 +24,19 @@ func SearchMoviesHandler(c *gin.Context) {
 }
 
 func GetTrendingMoviesHandler(c *gin.Context) {
-	// pagination locked for now
-	results, err := sources.GetTrendingMoviesTMDB("1")
+	timeWindow, page, err := getTrendingParams(c)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	results, err := sources.GetTrendingMoviesTMDB(timeWindow, page)
 	if err != nil {
 		_ = helpers.LogErrorWithMessage(err, "Error getting popular tv shows")
 		helpers.ErrorResponse(c, err)
 		return
 	}
 	// convert url results
-	var viewArray []view.LibraryObject
+	viewArray := []view.LibraryObject{}
 	for _, item := range results.Results {
 		genreArray := sources.GetGenresMap(item.GenreIDs, database.MediaTypeMovie)
 		thumbnailURL := GetTMDBImageURL(item.PosterPath, tmdb.W300)
@@ -49,7 +53,13 @@ func GetTrendingMoviesHandler(c *gin.Context) {
 		}
 		viewArray = append(viewArray, viewObject)
 	}
-	helpers.SuccessResponse(c, viewArray, 200)
+	helpers.SuccessResponse(c, view.TrendingView{
+		Results:      &viewArray,
+		Page:         results.Page,
+		TotalPages:   results.TotalPages,
+		TotalResults: results.TotalResults,
+		TimeWindow:   timeWindow,
+	}, 200)
 }
 
 func GetMovieFromIDHandler(c *gin.Context) {
@@ -117,6 +127,19 @@ func GetMovieFromIDHandler(c *gin.Context) {
 			return
 		}
 		returnObject.Comments = comments
+		returnObject.Files, err = getStreamableFiles(*libraryID, nil)
+		if err != nil {
+			helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.InternalServerError), "Error retrieving media files"))
+			return
+		}
+		progress, err := getResumeProgress(c.GetHeader("X-Username"), *libraryID, nil)
+		if err != nil {
+			helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.InternalServerError), "Error retrieving playback progress"))
+			return
+		}
+		if len(*progress) > 0 {
+			returnObject.Resume = &(*progress)[0]
+		}
 	}
 	helpers.SuccessResponse(c, returnObject, 200)
 }
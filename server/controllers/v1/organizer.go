@@ -0,0 +1,69 @@
+package v1
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"hound/helpers"
+	"hound/model/database"
+	"hound/model/media"
+	"hound/view"
+	"strconv"
+)
+
+// PreviewOrganizerHandler returns what the organizer would do with the inbox, nothing is written
+func PreviewOrganizerHandler(c *gin.Context) {
+	results, err := media.RunOrganizer(true)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	helpers.SuccessResponse(c, results, 200)
+}
+
+// RunOrganizerHandler organizes the inbox now instead of waiting for the next poll
+func RunOrganizerHandler(c *gin.Context) {
+	results, err := media.RunOrganizer(false)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	helpers.SuccessResponse(c, results, 200)
+}
+
+// GetOrganizerOperationsHandler lists the operation log, query params: status (done, skipped, unmatched, undone)
+func GetOrganizerOperationsHandler(c *gin.Context) {
+	limit, offset, err := getLimitOffset(c)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	query := database.OrganizerOperationQuery{}
+	if status := c.Query("status"); status != "" {
+		query.Status = &status
+	}
+	operations, totalRecords, err := database.GetOrganizerOperations(query, limit, offset)
+	if err != nil {
+		helpers.ErrorResponse(c, errors.New(helpers.InternalServerError))
+		return
+	}
+	helpers.SuccessResponse(c, view.OrganizerOperationsView{
+		Results:      &operations,
+		TotalRecords: totalRecords,
+		Limit:        limit,
+		Offset:       offset,
+	}, 200)
+}
+
+func UndoOrganizerOperationHandler(c *gin.Context) {
+	operationID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid operation id in url param"))
+		return
+	}
+	operation, err := media.UndoOrganizerOperation(operationID)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	helpers.SuccessResponse(c, operation, 200)
+}
@@ -0,0 +1,147 @@
+package v1
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"hound/helpers"
+	"hound/model"
+	"hound/model/database"
+	"hound/model/media"
+	"hound/view"
+	"strconv"
+)
+
+type ProgressRequest struct {
+	MediaType     string `json:"media_type" binding:"required"`
+	MediaSource   string `json:"media_source" binding:"required"`
+	SourceID      string `json:"source_id" binding:"required"`
+	SeasonNumber  *int   `json:"season_number"`               // required for tv shows
+	EpisodeNumber *int   `json:"episode_number"`              // required for tv shows
+	Position      int    `json:"position"`                    // seconds
+	Duration      int    `json:"duration" binding:"required"` // seconds
+}
+
+// ReportProgressHandler stores the playback position of a movie or episode,
+// past playback.watched-threshold the item is recorded in history instead
+func ReportProgressHandler(c *gin.Context) {
+	body := ProgressRequest{}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Failed to bind progress body"))
+		return
+	}
+	err := ValidateMediaParams(body.MediaType, body.MediaSource)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	if body.MediaType == database.MediaTypeTVShow {
+		if body.SeasonNumber == nil || body.EpisodeNumber == nil {
+			helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "season_number and episode_number are required for tv shows"))
+			return
+		}
+	} else if body.MediaType == database.MediaTypeMovie {
+		body.SeasonNumber, body.EpisodeNumber = nil, nil
+	} else {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Progress is only tracked for movies and tv shows"))
+		return
+	}
+	userID, err := database.GetUserIDFromUsername(c.GetHeader("X-Username"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid user"))
+		return
+	}
+	libraryID, err := media.GetOrAddLibraryID(body.MediaType, body.MediaSource, body.SourceID)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	result, err := model.ReportProgress(userID, libraryID, body.SeasonNumber, body.EpisodeNumber, body.Position, body.Duration)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	helpers.SuccessResponse(c, result, 200)
+}
+
+// GetContinueWatchingHandler lists in-progress movies and episodes, most recently played first
+func GetContinueWatchingHandler(c *gin.Context) {
+	limit, offset, err := getLimitOffset(c)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	userID, err := database.GetUserIDFromUsername(c.GetHeader("X-Username"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid user"))
+		return
+	}
+	records, totalRecords, err := database.GetProgress(database.ProgressQuery{UserID: userID}, limit, offset)
+	if err != nil {
+		helpers.ErrorResponse(c, errors.New(helpers.InternalServerError))
+		return
+	}
+	helpers.SuccessResponse(c, view.ProgressView{
+		Results:      getProgressObjects(records),
+		TotalRecords: totalRecords,
+		Limit:        limit,
+		Offset:       offset,
+	}, 200)
+}
+
+// DeleteProgressHandler removes an item from continue watching without recording a watch
+func DeleteProgressHandler(c *gin.Context) {
+	progressID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid progress id in url param"))
+		return
+	}
+	userID, err := database.GetUserIDFromUsername(c.GetHeader("X-Username"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid user"))
+		return
+	}
+	err = database.DeleteProgress(userID, progressID)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	helpers.SuccessResponse(c, gin.H{"status": "success"}, 200)
+}
+
+// getResumeProgress returns the user's progress of a library item, for tv shows only that of seasonNumber
+func getResumeProgress(username string, libraryID int64, seasonNumber *int) (*[]view.ProgressObject, error) {
+	userID, err := database.GetUserIDFromUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	records, _, err := database.GetProgress(database.ProgressQuery{
+		UserID:       userID,
+		LibraryID:    &libraryID,
+		SeasonNumber: seasonNumber,
+	}, -1, -1)
+	if err != nil {
+		return nil, err
+	}
+	return getProgressObjects(records), nil
+}
+
+func getProgressObjects(records []database.ProgressGroup) *[]view.ProgressObject {
+	progressObjects := []view.ProgressObject{}
+	for _, item := range records {
+		progressObjects = append(progressObjects, view.ProgressObject{
+			ProgressID:    item.ProgressID,
+			LibraryID:     item.LibraryID,
+			MediaType:     item.MediaType,
+			MediaSource:   item.MediaSource,
+			SourceID:      item.SourceID,
+			MediaTitle:    item.MediaTitle,
+			ThumbnailURL:  item.ThumbnailURL,
+			SeasonNumber:  item.SeasonNumber,
+			EpisodeNumber: item.EpisodeNumber,
+			Position:      item.Position,
+			Duration:      item.Duration,
+			UpdatedAt:     item.UpdatedAt,
+		})
+	}
+	return &progressObjects
+}
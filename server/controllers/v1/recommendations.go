@@ -0,0 +1,57 @@
+package v1
+
+import (
+	"errors"
+	tmdb "github.com/cyruzin/golang-tmdb"
+	"github.com/gin-gonic/gin"
+	"hound/helpers"
+	"hound/model/database"
+	"hound/model/sources"
+	"hound/view"
+	"strconv"
+)
+
+const (
+	recommendationsDefaultLimit = 20
+	recommendationsMaxLimit     = 100
+)
+
+// GetRecommendationsHandler recommends movies and tv shows similar to what the user rated highly,
+// optional query params: media_type (movie, tvshow), limit
+func GetRecommendationsHandler(c *gin.Context) {
+	limit := recommendationsDefaultLimit
+	if c.Query("limit") != "" {
+		var err error
+		limit, err = strconv.Atoi(c.Query("limit"))
+		if err != nil || limit < 1 || limit > recommendationsMaxLimit {
+			helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid limit query param"))
+			return
+		}
+	}
+	userID, err := database.GetUserIDFromUsername(c.GetHeader("X-Username"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid user"))
+		return
+	}
+	recommendations, err := sources.GetRecommendationsTMDB(userID, c.Query("media_type"), limit)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	viewArray := []view.RecommendationObject{}
+	for _, item := range recommendations {
+		viewArray = append(viewArray, view.RecommendationObject{
+			MediaType:    item.MediaType,
+			MediaSource:  item.MediaSource,
+			SourceID:     item.SourceID,
+			MediaTitle:   item.Title,
+			Overview:     item.Overview,
+			ReleaseDate:  item.ReleaseDate,
+			ThumbnailURL: GetTMDBImageURL(item.PosterPath, tmdb.W300),
+			VoteAverage:  item.VoteAverage,
+			Score:        item.Score,
+			Reasons:      item.Reasons,
+		})
+	}
+	helpers.SuccessResponse(c, viewArray, 200)
+}
@@ -11,11 +11,58 @@ func SetupRoutes(r *gin.Engine) {
 	publicRoutes := r.Group("/api/v1/auth")
 	publicRoutes.POST("/register", RegistrationHandler)
 	publicRoutes.POST("/login", LoginHandler)
+	publicRoutes.POST("/refresh", RefreshHandler)
+	publicRoutes.POST("/logout", middlewares.JWTMiddleware, LogoutHandler)
+
+	// stream routes, auth token or signed url
+	streamRoutes := r.Group("/api/v1/stream")
+	streamRoutes.Use(middlewares.StreamAuthMiddleware)
+	streamRoutes.GET("/:fileID", StreamMediaFileHandler)
+	streamRoutes.HEAD("/:fileID", StreamMediaFileHandler)
+	streamRoutes.GET("/:fileID/subtitles/*name", GetSubtitleHandler)
+
+	// scrobble webhooks from players, per user webhook token
+	webhookRoutes := r.Group("/api/v1/webhooks")
+	webhookRoutes.POST("/plex", PlexWebhookHandler)
+	webhookRoutes.POST("/jellyfin", JellyfinWebhookHandler)
+	webhookRoutes.POST("/kodi", KodiWebhookHandler)
 
 	// private routes, auth required, everything else
 	privateRoutes := r.Group("/api/v1")
 	privateRoutes.Use(middlewares.JWTMiddleware)
 
+	/*
+		User Routes
+	 */
+	privateRoutes.GET("/me", GetProfileHandler)
+	privateRoutes.PATCH("/me", UpdateProfileHandler)
+	privateRoutes.DELETE("/me", DeleteAccountHandler)
+	privateRoutes.POST("/me/password", ChangePasswordHandler)
+	privateRoutes.POST("/me/webhook", GenerateWebhookTokenHandler)
+	privateRoutes.GET("/me/webhook", GetWebhookStatusHandler)
+	privateRoutes.DELETE("/me/webhook", DeleteWebhookTokenHandler)
+
+	/*
+		Admin Routes
+	 */
+	adminRoutes := privateRoutes.Group("/admin")
+	adminRoutes.Use(middlewares.AdminMiddleware)
+	adminRoutes.GET("/users", AdminListUsersHandler)
+	adminRoutes.POST("/users/:id/disable", AdminDisableUserHandler)
+	adminRoutes.POST("/users/:id/enable", AdminEnableUserHandler)
+	adminRoutes.POST("/users/:id/reset-password", AdminResetPasswordHandler)
+	adminRoutes.POST("/users/:id/promote", AdminPromoteUserHandler)
+	adminRoutes.POST("/users/:id/demote", AdminDemoteUserHandler)
+	adminRoutes.POST("/users/:id/logout", AdminForceLogoutHandler)
+	adminRoutes.POST("/media/scan", StartMediaScanHandler)
+	adminRoutes.GET("/media/scan", GetMediaScanHandler)
+	adminRoutes.GET("/media/files", GetMediaFilesHandler)
+	adminRoutes.POST("/media/files/:id/match", MatchMediaFileHandler)
+	adminRoutes.POST("/organizer/preview", PreviewOrganizerHandler)
+	adminRoutes.POST("/organizer/run", RunOrganizerHandler)
+	adminRoutes.GET("/organizer/operations", GetOrganizerOperationsHandler)
+	adminRoutes.POST("/organizer/operations/:id/undo", UndoOrganizerOperationHandler)
+
 	/*
 		General Routes
 	 */
@@ -24,18 +71,48 @@ func SetupRoutes(r *gin.Engine) {
 	privateRoutes.POST("/collection/:id", AddToCollectionHandler)
 	privateRoutes.GET("/collection/:id", GetCollectionContentsHandler)
 	privateRoutes.DELETE("/collection/:id", DeleteFromCollectionHandler)
+	privateRoutes.PATCH("/collection/:id", UpdateCollectionHandler)
+	privateRoutes.POST("/collection/:id/move", MoveCollectionItemHandler)
+	privateRoutes.POST("/collection/:id/batch", BatchCollectionHandler)
+	privateRoutes.POST("/collection/:id/follow", FollowCollectionHandler)
+	privateRoutes.DELETE("/collection/:id/follow", UnfollowCollectionHandler)
+	privateRoutes.GET("/collections/public", GetPublicCollectionsHandler)
+	privateRoutes.GET("/collection/invites", GetCollectionInvitesHandler)
+	privateRoutes.GET("/collection/:id/members", GetCollectionMembersHandler)
+	privateRoutes.POST("/collection/:id/members", InviteCollectionMemberHandler)
+	privateRoutes.POST("/collection/:id/members/accept", AcceptCollectionInviteHandler)
+	privateRoutes.DELETE("/collection/:id/members/:username", RemoveCollectionMemberHandler)
 	privateRoutes.GET("/collection/all", GetUserCollectionsHandler)
 	privateRoutes.POST("/collection/new", CreateCollectionHandler)
 	privateRoutes.DELETE("/collection/delete/:id", DeleteCollectionHandler)
 	privateRoutes.DELETE("/comments", DeleteCommentHandler)
+	privateRoutes.PUT("/comments/:id", UpdateCommentHandler)
+	privateRoutes.PATCH("/comments/:id", UpdateCommentHandler)
+	privateRoutes.GET("/comments/:id/edits", GetCommentEditsHandler)
+	privateRoutes.GET("/history", GetHistoryHandler)
+	privateRoutes.POST("/history", AddHistoryHandler)
+	privateRoutes.DELETE("/history", DeleteHistoryHandler)
+	privateRoutes.POST("/import", StartImportHandler)
+	privateRoutes.GET("/import", GetImportJobsHandler)
+	privateRoutes.GET("/import/:id", GetImportJobHandler)
+	privateRoutes.GET("/export", ExportHandler)
+	privateRoutes.GET("/stats", GetStatsHandler)
+	privateRoutes.GET("/recommendations", GetRecommendationsHandler)
+	privateRoutes.GET("/stream/:fileID/url", GetStreamURLHandler)
+	privateRoutes.POST("/progress", ReportProgressHandler)
+	privateRoutes.GET("/progress", GetContinueWatchingHandler)
+	privateRoutes.DELETE("/progress/:id", DeleteProgressHandler)
 
 	/*
 		TV Show Routes
 	 */
 	privateRoutes.GET("/tv/search", SearchTVShowHandler)
 	privateRoutes.GET("/tv/trending", GetTrendingTVShowsHandler)
+	privateRoutes.GET("/tv/upnext", GetUpNextHandler)
 	privateRoutes.GET("/tv/:id", GetTVShowFromIDHandler)
 	privateRoutes.GET("/tv/:id/season/:seasonNumber", GetTVSeasonHandler)
+	privateRoutes.POST("/tv/:id/watched", MarkShowWatchedHandler)
+	privateRoutes.DELETE("/tv/:id/watched", UnmarkShowWatchedHandler)
 	privateRoutes.GET("/tv/:id/comments", GetCommentsHandler)
 	privateRoutes.POST("/tv/:id/comments", PostCommentHandler)
 	/*
@@ -0,0 +1,32 @@
+package v1
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"hound/helpers"
+	"hound/model"
+)
+
+// GetStatsHandler returns the user's watch statistics, optionally filtered by start_date, end_date
+func GetStatsHandler(c *gin.Context) {
+	startDate, err := parseDateQuery(c.Query("start_date"), false)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	endDate, err := parseDateQuery(c.Query("end_date"), true)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	if startDate != nil && endDate != nil && startDate.After(*endDate) {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "start_date is after end_date"))
+		return
+	}
+	stats, err := model.GetUserStats(c.GetHeader("X-Username"), startDate, endDate)
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.InternalServerError), "Failed to get stats"))
+		return
+	}
+	helpers.SuccessResponse(c, stats, 200)
+}
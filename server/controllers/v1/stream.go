@@ -0,0 +1,148 @@
+package v1
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"hound/helpers"
+	"hound/model/database"
+	"hound/model/media"
+	"hound/view"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type StreamURLResponse struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// StreamMediaFileHandler serves a matched file with range support, authenticated with
+// the usual token or a signed url from GetStreamURLHandler
+func StreamMediaFileHandler(c *gin.Context) {
+	fileID, err := strconv.ParseInt(c.Param("fileID"), 10, 64)
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid file id in url param"))
+		return
+	}
+	userID, err := database.GetUserIDFromUsername(c.GetHeader("X-Username"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid user"))
+		return
+	}
+	file, osFile, err := media.OpenMediaFile(fileID)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	defer osFile.Close()
+	info, err := osFile.Stat()
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.InternalServerError), "Failed to stat media file"))
+		return
+	}
+	if c.Request.Method == http.MethodGet {
+		err = media.RecordStreamProgress(userID, file, media.ParseRangeStart(c.GetHeader("Range")))
+		if err != nil {
+			_ = helpers.LogErrorWithMessage(err, "Failed to record stream progress")
+		}
+	}
+	c.Header("Content-Type", media.GetMimeType(file.Path))
+	// ServeContent handles Range, If-Range and HEAD
+	http.ServeContent(c.Writer, c.Request, filepath.Base(file.Path), info.ModTime(), osFile)
+}
+
+// GetSubtitleHandler serves a sidecar subtitle of a file, SRT is converted to WebVTT unless ?format=srt.
+// Signed stream urls of the file work for its subtitles too
+func GetSubtitleHandler(c *gin.Context) {
+	fileID, err := strconv.ParseInt(c.Param("fileID"), 10, 64)
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid file id in url param"))
+		return
+	}
+	file, osFile, err := media.OpenMediaFile(fileID)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	_ = osFile.Close()
+	subtitle, err := media.FindSubtitle(file.Path, strings.TrimPrefix(c.Param("name"), "/"))
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	toVTT := c.Query("format") != media.SubtitleFormatSRT
+	data, err := media.ReadSubtitle(subtitle, toVTT)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	format := subtitle.Format
+	if toVTT && format == media.SubtitleFormatSRT {
+		format = media.SubtitleFormatVTT
+	}
+	c.Data(200, media.SubtitleMimeTypes[format]+"; charset=utf-8", data)
+}
+
+// GetStreamURLHandler returns a signed stream url for players that can't send the auth token
+func GetStreamURLHandler(c *gin.Context) {
+	fileID, err := strconv.ParseInt(c.Param("fileID"), 10, 64)
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid file id in url param"))
+		return
+	}
+	file, err := database.GetMediaFile(fileID)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	if file.LibraryID == nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Media file is not matched"))
+		return
+	}
+	streamURL, expiresAt := media.SignStreamURL(fileID, c.GetHeader("X-Username"))
+	helpers.SuccessResponse(c, StreamURLResponse{
+		URL:       streamURL,
+		ExpiresAt: expiresAt,
+	}, 200)
+}
+
+// getStreamableFiles lists the local files of a library item, for tv shows only those of seasonNumber
+func getStreamableFiles(libraryID int64, seasonNumber *int) (*[]view.StreamableFileObject, error) {
+	files, _, err := database.GetMediaFiles(database.MediaFileQuery{
+		LibraryID:    &libraryID,
+		SeasonNumber: seasonNumber,
+	}, -1, -1)
+	if err != nil {
+		return nil, err
+	}
+	viewArray := []view.StreamableFileObject{}
+	for _, file := range files {
+		streamURL := media.StreamAPIPath + strconv.FormatInt(file.FileID, 10)
+		subtitles := []view.SubtitleObject{}
+		for _, subtitle := range media.FindSubtitles(file.Path) {
+			subtitles = append(subtitles, view.SubtitleObject{
+				Name:     subtitle.Name,
+				Format:   subtitle.Format,
+				Language: subtitle.Language,
+				Forced:   subtitle.Forced,
+				SDH:      subtitle.SDH,
+				URL:      streamURL + "/subtitles/" + url.PathEscape(subtitle.Name),
+			})
+		}
+		viewArray = append(viewArray, view.StreamableFileObject{
+			FileID:        file.FileID,
+			FileName:      filepath.Base(file.Path),
+			Size:          file.Size,
+			MimeType:      media.GetMimeType(file.Path),
+			SeasonNumber:  file.SeasonNumber,
+			EpisodeNumber: file.EpisodeNumber,
+			StreamURL:     streamURL,
+			Subtitles:     subtitles,
+		})
+	}
+	return &viewArray, nil
+}
@@ -10,8 +10,17 @@ import (
 	"hound/view"
 	"strconv"
 	"strings"
+	"time"
 )
 
+// MarkShowWatchedRequest marks a show watched through season_number x episode_number,
+// the whole show if empty
+type MarkShowWatchedRequest struct {
+	SeasonNumber  *int      `json:"season_number"`
+	EpisodeNumber *int      `json:"episode_number"`
+	WatchedAt     time.Time `json:"watched_at"` // defaults to now
+}
+
 type AddLibraryRequest struct {
 	MediaSource string `json:"media_source" binding:"required,gt=0"`
 	SourceID    string `json:"source_id" binding:"required,gt=0"`
@@ -117,17 +126,19 @@ func GetTVShowFromIDHandler(c *gin.Context) {
 }
 
 func GetTrendingTVShowsHandler(c *gin.Context) {
-	// pagination locked for now
-	results, err := sources.GetTrendingTVShowsTMDB("1")
-	//results2, err := sources.GetTrendingTVShowsTMDB("2")
+	timeWindow, page, err := getTrendingParams(c)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	results, err := sources.GetTrendingTVShowsTMDB(timeWindow, page)
 	if err != nil {
 		_ = helpers.LogErrorWithMessage(err, "Error getting popular tv shows")
 		helpers.ErrorResponse(c, err)
 		return
 	}
-	//results.Results = append(results.Results, results2.Results...)
 	// convert url results
-	var viewArray []view.LibraryObject
+	viewArray := []view.LibraryObject{}
 	for _, item := range results.Results {
 		genreArray := sources.GetGenresMap(item.GenreIDs, database.MediaTypeTVShow)
 		thumbnailURL := GetTMDBImageURL(item.PosterPath, tmdb.W300)
@@ -144,7 +155,13 @@ func GetTrendingTVShowsHandler(c *gin.Context) {
 		}
 		viewArray = append(viewArray, viewObject)
 	}
-	helpers.SuccessResponse(c, viewArray, 200)
+	helpers.SuccessResponse(c, view.TrendingView{
+		Results:      &viewArray,
+		Page:         results.Page,
+		TotalPages:   results.TotalPages,
+		TotalResults: results.TotalResults,
+		TimeWindow:   timeWindow,
+	}, 200)
 }
 
 //func GetUserTVShowLibraryHandler(c *gin.Context) {
@@ -240,23 +257,124 @@ func GetTVSeasonHandler(c *gin.Context) {
 	libraryID, err := database.GetInternalLibraryID(database.MediaTypeTVShow, sources.SourceTMDB, strconv.Itoa(sourceID))
 	// if library id exists, retrieve watch history
 	if err == nil {
-		commentType := "history"
-		comments, err := GetCommentsCore(c.GetHeader("X-Username"), *libraryID, &commentType)
+		userID, err := database.GetUserIDFromUsername(c.GetHeader("X-Username"))
 		if err != nil {
 			helpers.ErrorResponse(c, err)
 			return
 		}
-		var filteredComments []view.CommentObject
-		for _, item := range *comments {
-			if strings.HasPrefix(item.TagData, "S" + strconv.Itoa(seasonNumber)) {
-				filteredComments = append(filteredComments, item)
-			}
+		records, _, err := database.GetHistory(database.HistoryQuery{
+			UserID:       userID,
+			LibraryID:    libraryID,
+			SeasonNumber: &seasonNumber,
+		}, -1, -1)
+		if err != nil {
+			helpers.ErrorResponse(c, err)
+			return
+		}
+		response.SeasonWatchInfo = getHistoryObjects(records)
+		response.Files, err = getStreamableFiles(*libraryID, &seasonNumber)
+		if err != nil {
+			helpers.ErrorResponse(c, err)
+			return
+		}
+		response.Progress, err = getResumeProgress(c.GetHeader("X-Username"), *libraryID, &seasonNumber)
+		if err != nil {
+			helpers.ErrorResponse(c, err)
+			return
 		}
-		response.SeasonWatchInfo = &filteredComments
 	}
 	helpers.SuccessResponse(c, response, 200)
 }
 
+// MarkShowWatchedHandler marks every aired episode of a show watched, up to an optional episode
+func MarkShowWatchedHandler(c *gin.Context) {
+	mediaSource, sourceID, err := ParseID(c.Param("id"))
+	if err != nil || mediaSource != sources.SourceTMDB {
+		helpers.ErrorResponse(c, errors.New(helpers.BadRequest))
+		return
+	}
+	body := MarkShowWatchedRequest{}
+	// empty body marks the whole show
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Failed to bind mark watched body"))
+			return
+		}
+	}
+	userID, err := database.GetUserIDFromUsername(c.GetHeader("X-Username"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid user"))
+		return
+	}
+	added, err := sources.MarkTVShowWatchedTMDB(userID, strconv.Itoa(sourceID), body.SeasonNumber, body.EpisodeNumber, body.WatchedAt)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	helpers.SuccessResponse(c, gin.H{"status": "success", "added": added}, 200)
+}
+
+// UnmarkShowWatchedHandler removes watches of a whole show, or one season with ?season=
+func UnmarkShowWatchedHandler(c *gin.Context) {
+	mediaSource, sourceID, err := ParseID(c.Param("id"))
+	if err != nil || mediaSource != sources.SourceTMDB {
+		helpers.ErrorResponse(c, errors.New(helpers.BadRequest))
+		return
+	}
+	var seasonNumber *int
+	if seasonQuery := c.Query("season"); seasonQuery != "" {
+		season, err := strconv.Atoi(seasonQuery)
+		if err != nil {
+			helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid season query param"))
+			return
+		}
+		seasonNumber = &season
+	}
+	userID, err := database.GetUserIDFromUsername(c.GetHeader("X-Username"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid user"))
+		return
+	}
+	removed, err := sources.UnmarkTVShowWatched(userID, mediaSource, strconv.Itoa(sourceID), seasonNumber)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	helpers.SuccessResponse(c, gin.H{"status": "success", "removed": removed}, 200)
+}
+
+// GetUpNextHandler returns the next unwatched aired episode of every show the user has
+// partially watched, most recent activity first
+func GetUpNextHandler(c *gin.Context) {
+	userID, err := database.GetUserIDFromUsername(c.GetHeader("X-Username"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid user"))
+		return
+	}
+	episodes, err := sources.GetUpNextTMDB(userID)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	viewArray := []view.UpNextObject{}
+	for _, item := range episodes {
+		viewArray = append(viewArray, view.UpNextObject{
+			MediaSource:   item.Show.MediaSource,
+			SourceID:      item.Show.SourceID,
+			MediaTitle:    item.Show.MediaTitle,
+			ThumbnailURL:  item.Show.ThumbnailURL,
+			SeasonNumber:  item.SeasonNumber,
+			EpisodeNumber: item.EpisodeNumber,
+			EpisodeTitle:  item.EpisodeTitle,
+			Overview:      item.Overview,
+			AirDate:       item.AirDate,
+			StillURL:      GetTMDBImageURL(item.StillPath, tmdb.W500),
+			LastWatchedAt: item.Show.LastWatchedAt,
+		})
+	}
+	helpers.SuccessResponse(c, viewArray, 200)
+}
+
 func GetTMDBImageURL(path string, size string) string {
 	if path == "" {
 		return ""
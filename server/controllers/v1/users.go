@@ -0,0 +1,170 @@
+package v1
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"hound/helpers"
+	"hound/model"
+	"hound/model/database"
+	"hound/view"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // timezone validation on images without zoneinfo
+)
+
+var (
+	languageRegex = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z]{2})?$`)
+	regionRegex   = regexp.MustCompile(`^[A-Z]{2}$`)
+)
+
+// UpdateProfileRequest only updates fields that are present
+type UpdateProfileRequest struct {
+	FirstName         *string `json:"first_name"`
+	LastName          *string `json:"last_name"`
+	DisplayName       *string `json:"display_name"`
+	AvatarURL         *string `json:"avatar_url"`
+	PreferredLanguage *string `json:"preferred_language"`
+	PreferredRegion   *string `json:"preferred_region"`
+	Timezone          *string `json:"timezone"`
+}
+
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password" binding:"required,gt=0"`
+	NewPassword string `json:"new_password" binding:"required,gte=8"`
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password" binding:"required,gt=0"`
+}
+
+func GetProfileHandler(c *gin.Context) {
+	user, err := database.GetUser(c.GetHeader("X-Username"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid user"))
+		return
+	}
+	helpers.SuccessResponse(c, getProfileView(user), 200)
+}
+
+func UpdateProfileHandler(c *gin.Context) {
+	body := UpdateProfileRequest{}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Failed to bind profile body"))
+		return
+	}
+	user, err := database.GetUser(c.GetHeader("X-Username"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid user"))
+		return
+	}
+	if body.FirstName != nil {
+		if strings.TrimSpace(*body.FirstName) == "" {
+			helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "First name cannot be empty"))
+			return
+		}
+		user.FirstName = *body.FirstName
+	}
+	if body.LastName != nil {
+		if strings.TrimSpace(*body.LastName) == "" {
+			helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Last name cannot be empty"))
+			return
+		}
+		user.LastName = *body.LastName
+	}
+	if body.DisplayName != nil {
+		user.UserMeta.DisplayName = *body.DisplayName
+	}
+	if body.AvatarURL != nil {
+		if *body.AvatarURL != "" {
+			parsed, err := url.ParseRequestURI(*body.AvatarURL)
+			if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+				helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid avatar url"))
+				return
+			}
+		}
+		user.UserMeta.AvatarURL = *body.AvatarURL
+	}
+	if body.PreferredLanguage != nil {
+		if *body.PreferredLanguage != "" && !languageRegex.MatchString(*body.PreferredLanguage) {
+			helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid preferred language"))
+			return
+		}
+		user.UserMeta.PreferredLanguage = *body.PreferredLanguage
+	}
+	if body.PreferredRegion != nil {
+		if *body.PreferredRegion != "" && !regionRegex.MatchString(*body.PreferredRegion) {
+			helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid preferred region"))
+			return
+		}
+		user.UserMeta.PreferredRegion = *body.PreferredRegion
+	}
+	if body.Timezone != nil {
+		if _, err := time.LoadLocation(*body.Timezone); *body.Timezone != "" && err != nil {
+			helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid timezone"))
+			return
+		}
+		user.UserMeta.Timezone = *body.Timezone
+	}
+	err = database.UpdateUserProfile(user.Id, user.FirstName, user.LastName, user.UserMeta)
+	if err != nil {
+		helpers.ErrorResponse(c, errors.New(helpers.InternalServerError))
+		return
+	}
+	user, err = database.GetUser(user.Username)
+	if err != nil {
+		helpers.ErrorResponse(c, errors.New(helpers.InternalServerError))
+		return
+	}
+	helpers.SuccessResponse(c, getProfileView(user), 200)
+}
+
+func ChangePasswordHandler(c *gin.Context) {
+	body := ChangePasswordRequest{}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Failed to bind password body"))
+		return
+	}
+	sessionID, err := strconv.ParseInt(c.GetHeader("X-Session-ID"), 10, 64)
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.Unauthorized), "Invalid session"))
+		return
+	}
+	err = model.ChangePassword(c.GetHeader("X-Username"), body.OldPassword, body.NewPassword, sessionID)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	helpers.SuccessResponse(c, gin.H{"status": "success"}, 200)
+}
+
+func DeleteAccountHandler(c *gin.Context) {
+	body := DeleteAccountRequest{}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Failed to bind delete account body"))
+		return
+	}
+	err := model.DeleteAccount(c.GetHeader("X-Username"), body.Password)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	c.SetCookie(accessTokenCookie, "", -1, "/", "", true, true)
+	c.SetCookie(refreshTokenCookie, "", -1, refreshTokenCookiePath, "", true, true)
+	helpers.SuccessResponse(c, gin.H{"status": "success"}, 200)
+}
+
+func getProfileView(user *database.User) view.UserProfileView {
+	return view.UserProfileView{
+		UserID:    user.Id,
+		Username:  user.Username,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		UserMeta:  user.UserMeta,
+		IsAdmin:   user.IsAdmin,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+	}
+}
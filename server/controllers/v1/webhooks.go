@@ -0,0 +1,158 @@
+package v1
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"hound/helpers"
+	"hound/model/database"
+	"hound/model/webhooks"
+	"io"
+	"net/url"
+	"time"
+)
+
+const webhooksAPIPath = "/api/v1/webhooks/"
+
+// WebhookTokenResponse is only returned when a token is generated, the token can't be retrieved later
+type WebhookTokenResponse struct {
+	Token     string            `json:"token"`
+	URLs      map[string]string `json:"urls"` // webhook path for each player, token included
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+type WebhookStatusResponse struct {
+	Enabled    bool       `json:"enabled"`
+	CreatedAt  *time.Time `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// PlexWebhookHandler receives plex webhooks, multipart forms with the json in the payload field
+func PlexWebhookHandler(c *gin.Context) {
+	userID, err := webhooks.Authenticate(c.Query("token"))
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	payload := c.PostForm("payload")
+	if payload == "" {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Missing payload field in plex webhook"))
+		return
+	}
+	event, err := webhooks.ParsePlex(payload)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	handleWebhookEvent(c, userID, event)
+}
+
+// JellyfinWebhookHandler receives json from the jellyfin webhook plugin
+func JellyfinWebhookHandler(c *gin.Context) {
+	userID, err := webhooks.Authenticate(c.Query("token"))
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Failed to read jellyfin webhook body"))
+		return
+	}
+	event, err := webhooks.ParseJellyfin(body)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	handleWebhookEvent(c, userID, event)
+}
+
+// KodiWebhookHandler receives the kodi webhook json, see webhooks.ParseKodi
+func KodiWebhookHandler(c *gin.Context) {
+	userID, err := webhooks.Authenticate(c.Query("token"))
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Failed to read kodi webhook body"))
+		return
+	}
+	event, err := webhooks.ParseKodi(body)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	handleWebhookEvent(c, userID, event)
+}
+
+// handleWebhookEvent records an event, ?account= ignores events from other player accounts
+func handleWebhookEvent(c *gin.Context, userID int64, event *webhooks.Event) {
+	result, err := webhooks.Handle(userID, event, c.Query("account"))
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	helpers.SuccessResponse(c, result, 200)
+}
+
+// GenerateWebhookTokenHandler creates the user's webhook token, replacing the previous one
+func GenerateWebhookTokenHandler(c *gin.Context) {
+	userID, err := database.GetUserIDFromUsername(c.GetHeader("X-Username"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid user"))
+		return
+	}
+	token, record, err := webhooks.GenerateToken(userID)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	query := url.Values{}
+	query.Set("token", token)
+	urls := map[string]string{}
+	for _, source := range []string{webhooks.SourcePlex, webhooks.SourceJellyfin, webhooks.SourceKodi} {
+		urls[source] = webhooksAPIPath + source + "?" + query.Encode()
+	}
+	helpers.SuccessResponse(c, WebhookTokenResponse{
+		Token:     token,
+		URLs:      urls,
+		CreatedAt: record.CreatedAt,
+	}, 200)
+}
+
+// GetWebhookStatusHandler reports whether the user has a webhook token, the token itself isn't shown
+func GetWebhookStatusHandler(c *gin.Context) {
+	userID, err := database.GetUserIDFromUsername(c.GetHeader("X-Username"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid user"))
+		return
+	}
+	record, err := database.GetWebhookToken(userID)
+	if err != nil {
+		helpers.ErrorResponse(c, errors.New(helpers.InternalServerError))
+		return
+	}
+	status := WebhookStatusResponse{}
+	if record != nil {
+		status.Enabled = true
+		status.CreatedAt = &record.CreatedAt
+		status.LastUsedAt = record.LastUsedAt
+	}
+	helpers.SuccessResponse(c, status, 200)
+}
+
+// DeleteWebhookTokenHandler revokes the user's webhook token
+func DeleteWebhookTokenHandler(c *gin.Context) {
+	userID, err := database.GetUserIDFromUsername(c.GetHeader("X-Username"))
+	if err != nil {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(err, "Invalid user"))
+		return
+	}
+	err = database.DeleteWebhookToken(userID)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	helpers.SuccessResponse(c, gin.H{"status": "success"}, 200)
+}
@@ -8,6 +8,7 @@ import (
 const InternalServerError = "internalServerError"
 const BadRequest = "badRequest"
 const Unauthorized = "unauthorized"
+const Forbidden = "forbidden"
 
 var (
 	InfoMsg  = Teal
@@ -38,6 +39,8 @@ func GetErrorStatusCode(err error) int {
 		statusCode = http.StatusBadRequest
 	case Unauthorized:
 		statusCode = http.StatusUnauthorized
+	case Forbidden:
+		statusCode = http.StatusForbidden
 	}
 	return statusCode
 }
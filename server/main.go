@@ -5,6 +5,7 @@ import (
 	"hound/controllers"
 	"hound/model"
 	"hound/model/database"
+	"hound/model/media"
 	"hound/model/sources"
 )
 
@@ -12,6 +13,10 @@ func main() {
 	config.InitializeConfig()
 	database.InstantiateDB()
 	model.InitializeCache()
+	model.BootstrapAdmin()
 	sources.InitializeSources()
+	sources.InitializeLibraryRefresher()
+	media.InitializeMediaScanner()
+	media.InitializeOrganizer()
 	controllers.SetupRoutes()
 }
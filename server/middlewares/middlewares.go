@@ -5,6 +5,8 @@ import (
 	"github.com/gin-gonic/gin"
 	"hound/helpers"
 	"hound/model"
+	"hound/model/media"
+	"strconv"
 	"strings"
 )
 
@@ -34,11 +36,43 @@ func JWTMiddleware(c *gin.Context) {
 		helpers.ErrorResponse(c, err)
 		return
 	}
-	// set headers from auth token, overwrite current headers
-	//c.Request.Header.Del("X-Username")
-	//c.Request.Header.Del("X-Client")
-	c.Request.Header.Add("X-Username", claims.Username)
-	c.Request.Header.Add("X-Client", claims.Client)
+	// reject tokens whose session was logged out or revoked
+	err = model.ValidateSession(claims)
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	// set headers from auth token, overwrite current headers so clients can't spoof them
+	c.Request.Header.Set("X-Username", claims.Username)
+	c.Request.Header.Set("X-Client", claims.Client)
+	c.Request.Header.Set("X-Session-ID", strconv.FormatInt(claims.SessionID, 10))
+	c.Next()
+}
+
+// StreamAuthMiddleware accepts signed stream urls (?user=&expires=&signature=) for players
+// that can't send the auth cookie or header, and falls back to JWTMiddleware
+func StreamAuthMiddleware(c *gin.Context) {
+	if c.Query("signature") == "" {
+		JWTMiddleware(c)
+		return
+	}
+	err := media.VerifyStreamSignature(c.Param("fileID"), c.Query("user"), c.Query("expires"), c.Query("signature"))
+	if err != nil {
+		helpers.ErrorResponse(c, err)
+		return
+	}
+	c.Request.Header.Set("X-Username", c.Query("user"))
+	c.Request.Header.Del("X-Client")
+	c.Request.Header.Del("X-Session-ID")
+	c.Next()
+}
+
+// AdminMiddleware must run after JWTMiddleware
+func AdminMiddleware(c *gin.Context) {
+	if !model.IsAdmin(c.GetHeader("X-Username")) {
+		helpers.ErrorResponse(c, helpers.LogErrorWithMessage(errors.New(helpers.Forbidden), "Admin privileges required"))
+		return
+	}
 	c.Next()
 }
 
@@ -46,7 +80,7 @@ func CORSMiddleware(c *gin.Context) {
 	c.Writer.Header().Set("Access-Control-Allow-Origin", "http://localhost:3000")
 	c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 	c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Client")
-	c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+	c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
 
 	if c.Request.Method == "OPTIONS" {
 		c.AbortWithStatus(204)
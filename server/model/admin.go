@@ -0,0 +1,117 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/bcrypt"
+	"hound/helpers"
+	"hound/model/database"
+)
+
+// BootstrapAdmin promotes auth.admin-username to admin on startup if that user exists
+func BootstrapAdmin() {
+	username := viper.GetString("auth.admin-username")
+	if username == "" {
+		return
+	}
+	user, err := database.GetUser(username)
+	if err != nil {
+		// user may register later, RegisterNewUser handles that case
+		return
+	}
+	if user.IsAdmin {
+		return
+	}
+	err = database.SetUserAdmin(user.Id, true)
+	if err != nil {
+		_ = helpers.LogErrorWithMessage(err, "Failed to promote configured admin "+username)
+		return
+	}
+	fmt.Println(helpers.InfoMsg("Promoted configured admin " + username))
+}
+
+func isConfiguredAdmin(username string) bool {
+	adminUsername := viper.GetString("auth.admin-username")
+	return adminUsername != "" && adminUsername == username
+}
+
+// IsAdmin returns true if the user exists, is an admin and is not disabled
+func IsAdmin(username string) bool {
+	user, err := database.GetUser(username)
+	if err != nil {
+		return false
+	}
+	return user.IsAdmin && !user.IsDisabled
+}
+
+// SetUserDisabled disables/enables an account, disabling also logs the user out everywhere
+func SetUserDisabled(userID int64, isDisabled bool) error {
+	if isDisabled {
+		err := checkNotLastAdmin(userID)
+		if err != nil {
+			return err
+		}
+	}
+	err := database.SetUserDisabled(userID, isDisabled)
+	if err != nil {
+		return err
+	}
+	if isDisabled {
+		return database.RevokeAllRefreshTokens(userID)
+	}
+	return nil
+}
+
+func SetUserAdmin(userID int64, isAdmin bool) error {
+	if !isAdmin {
+		err := checkNotLastAdmin(userID)
+		if err != nil {
+			return err
+		}
+	}
+	return database.SetUserAdmin(userID, isAdmin)
+}
+
+// ResetUserPassword sets a new password without verifying the old one and revokes all sessions
+func ResetUserPassword(userID int64, newPassword string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return helpers.LogErrorWithMessage(err, "Bcrypt failed to hash password")
+	}
+	if _, err := database.GetUsernameFromID(userID); err != nil {
+		return helpers.LogErrorWithMessage(err, "ResetUserPassword(): No user found with this ID")
+	}
+	err = database.UpdateUserPassword(userID, string(hashedPassword))
+	if err != nil {
+		return err
+	}
+	return database.RevokeAllRefreshTokens(userID)
+}
+
+// ForceLogout revokes every session of a user
+func ForceLogout(userID int64) error {
+	if _, err := database.GetUsernameFromID(userID); err != nil {
+		return helpers.LogErrorWithMessage(err, "ForceLogout(): No user found with this ID")
+	}
+	return database.RevokeAllRefreshTokens(userID)
+}
+
+// prevent locking everyone out of the admin api
+func checkNotLastAdmin(userID int64) error {
+	user, err := database.GetUserByID(userID)
+	if err != nil {
+		return helpers.LogErrorWithMessage(err, "No user found with this ID")
+	}
+	if !user.IsAdmin || user.IsDisabled {
+		return nil
+	}
+	admins, err := database.CountAdmins()
+	if err != nil {
+		return err
+	}
+	if admins <= 1 {
+		return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Cannot remove the last active admin")
+	}
+	return nil
+}
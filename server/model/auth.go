@@ -1,6 +1,9 @@
 package model
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/spf13/viper"
@@ -25,8 +28,9 @@ type LoginUser struct {
 }
 
 type JWTClaims struct {
-	Username string `json:"username"`
-	Client   string `json:"client"`
+	Username  string `json:"username"`
+	Client    string `json:"client"`
+	SessionID int64  `json:"session_id"` // refresh token id, checked for revocation
 	jwt.RegisteredClaims
 }
 
@@ -35,12 +39,18 @@ func RegisterNewUser(user *RegistrationUser) error {
 	if err != nil {
 		return helpers.LogErrorWithMessage(err, "Bcrypt failed to hash password")
 	}
+	// first registered user, or the configured admin username, becomes admin
+	userCount, err := database.CountUsers()
+	if err != nil {
+		return helpers.LogErrorWithMessage(err, "Failed to count users")
+	}
 	insertUser := database.User{
 		Username:       user.Username,
 		FirstName:      user.FirstName,
 		LastName:       user.LastName,
 		HashedPassword: string(hashedPassword),
 		UserMeta:       database.UserMeta{},
+		IsAdmin:        userCount == 0 || isConfiguredAdmin(user.Username),
 	}
 	userID, err := database.InsertUser(insertUser)
 	if err != nil {
@@ -61,22 +71,112 @@ func RegisterNewUser(user *RegistrationUser) error {
 	return nil
 }
 
-// GenerateAccessToken JWT access token
-func GenerateAccessToken(user LoginUser, client string) (string, error) {
-	jwtKey := []byte(os.Getenv("JWT_SECRET_KEY"))
+// AuthTokens is returned on login/refresh, expirations are expressed in seconds
+type AuthTokens struct {
+	Username               string
+	AccessToken            string
+	RefreshToken           string
+	AccessTokenExpiration  int
+	RefreshTokenExpiration int
+}
+
+// GenerateAccessToken verifies credentials and starts a new session for the client.
+// Any previous session on the same client is revoked
+func GenerateAccessToken(user LoginUser, client string) (*AuthTokens, error) {
 	dbUser, err := database.GetUser(user.Username)
 	if err != nil {
-		return "", helpers.LogErrorWithMessage(err, "Failed to fetch user from database")
+		return nil, helpers.LogErrorWithMessage(err, "Failed to fetch user from database")
 	}
 	err = bcrypt.CompareHashAndPassword([]byte(dbUser.HashedPassword), []byte(user.Password))
 	if err != nil {
-		return "", helpers.LogErrorWithMessage(err, "Failed to verify password (incorrect?)")
+		return nil, helpers.LogErrorWithMessage(err, "Failed to verify password (incorrect?)")
+	}
+	if dbUser.IsDisabled {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.Forbidden), "Account is disabled")
+	}
+	err = database.RevokeClientRefreshTokens(dbUser.Id, client)
+	if err != nil {
+		return nil, err
+	}
+	return createSession(dbUser.Id, dbUser.Username, client)
+}
+
+// RefreshAccessToken exchanges a refresh token for a new token pair, the old refresh token is revoked (rotation).
+// Presenting an already revoked token revokes every session on that client, the token was likely stolen
+func RefreshAccessToken(refreshToken string) (*AuthTokens, error) {
+	record, err := database.GetRefreshTokenByHash(hashRefreshToken(refreshToken))
+	if err != nil {
+		return nil, err
+	}
+	if record.IsRevoked {
+		_ = database.RevokeClientRefreshTokens(record.UserID, record.Client)
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.Unauthorized), "Refresh token reuse detected, sessions revoked")
+	}
+	if record.ExpiresAt.Before(time.Now()) {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.Unauthorized), "Refresh token expired")
+	}
+	dbUser, err := database.GetUserByID(record.UserID)
+	if err != nil {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.Unauthorized), "Refresh token user not found")
+	}
+	if dbUser.IsDisabled {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.Forbidden), "Account is disabled")
+	}
+	// the token is revoked before the new session is created, a concurrent refresh with the same token fails here
+	revoked, err := database.RevokeRefreshToken(record.TokenID)
+	if err != nil {
+		return nil, err
+	}
+	if !revoked {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.Unauthorized), "Refresh token already used")
+	}
+	return createSession(record.UserID, dbUser.Username, record.Client)
+}
+
+// RevokeSession logs out a single session, access tokens issued for it stop working immediately
+func RevokeSession(sessionID int64) error {
+	_, err := database.RevokeRefreshToken(sessionID)
+	return err
+}
+
+func createSession(userID int64, username string, client string) (*AuthTokens, error) {
+	refreshExpiration := viper.GetInt("auth.refresh-token-expiration")
+	refreshToken, err := generateRefreshToken()
+	if err != nil {
+		return nil, err
 	}
+	session := database.RefreshTokenRecord{
+		UserID:    userID,
+		Client:    client,
+		TokenHash: hashRefreshToken(refreshToken),
+		ExpiresAt: time.Now().Add(time.Duration(refreshExpiration) * time.Second),
+	}
+	err = database.InsertRefreshToken(&session)
+	if err != nil {
+		return nil, err
+	}
+	accessExpiration := viper.GetInt("auth.jwt-access-token-expiration")
+	accessToken, err := signAccessToken(username, client, session.TokenID, accessExpiration)
+	if err != nil {
+		return nil, err
+	}
+	return &AuthTokens{
+		Username:               username,
+		AccessToken:            accessToken,
+		RefreshToken:           refreshToken,
+		AccessTokenExpiration:  accessExpiration,
+		RefreshTokenExpiration: refreshExpiration,
+	}, nil
+}
+
+func signAccessToken(username string, client string, sessionID int64, expiration int) (string, error) {
+	jwtKey := []byte(os.Getenv("JWT_SECRET_KEY"))
 	// expiration time in seconds
-	expirationTime := time.Now().Add(time.Duration(viper.GetInt("auth.jwt-access-token-expiration")) * time.Second)
+	expirationTime := time.Now().Add(time.Duration(expiration) * time.Second)
 	claims := &JWTClaims{
-		Username: user.Username,
-		Client:   client,
+		Username:  username,
+		Client:    client,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 		},
@@ -90,6 +190,21 @@ func GenerateAccessToken(user LoginUser, client string) (string, error) {
 	return tokenString, nil
 }
 
+// refresh tokens are opaque random strings, only their hash is persisted
+func generateRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", helpers.LogErrorWithMessage(err, "Failed to generate refresh token")
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashRefreshToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
 func ParseAccessToken(token string) (*JWTClaims, error) {
 	jwtKey := []byte(os.Getenv("JWT_SECRET_KEY"))
 	claims := JWTClaims{}
@@ -104,3 +219,54 @@ func ParseAccessToken(token string) (*JWTClaims, error) {
 	}
 	return &claims, nil
 }
+
+// ValidateSession checks that the session an access token belongs to has not been revoked
+func ValidateSession(claims *JWTClaims) error {
+	active, err := database.IsSessionActive(claims.SessionID)
+	if err != nil {
+		return helpers.LogErrorWithMessage(errors.New(helpers.InternalServerError), "Failed to check session "+err.Error())
+	}
+	if !active {
+		return helpers.LogErrorWithMessage(errors.New(helpers.Unauthorized), "Session revoked or expired")
+	}
+	return nil
+}
+
+// ChangePassword re-verifies the old password before storing the new hash.
+// All other sessions are revoked, the calling session stays logged in
+func ChangePassword(username string, oldPassword string, newPassword string, sessionID int64) error {
+	dbUser, err := database.GetUser(username)
+	if err != nil {
+		return helpers.LogErrorWithMessage(err, "Failed to fetch user from database")
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(dbUser.HashedPassword), []byte(oldPassword))
+	if err != nil {
+		return helpers.LogErrorWithMessage(errors.New(helpers.Unauthorized), "Failed to verify old password")
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return helpers.LogErrorWithMessage(err, "Bcrypt failed to hash password")
+	}
+	err = database.UpdateUserPassword(dbUser.Id, string(hashedPassword))
+	if err != nil {
+		return err
+	}
+	return database.RevokeOtherRefreshTokens(dbUser.Id, sessionID)
+}
+
+// DeleteAccount re-verifies the password, then removes the user and all their data
+func DeleteAccount(username string, password string) error {
+	dbUser, err := database.GetUser(username)
+	if err != nil {
+		return helpers.LogErrorWithMessage(err, "Failed to fetch user from database")
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(dbUser.HashedPassword), []byte(password))
+	if err != nil {
+		return helpers.LogErrorWithMessage(errors.New(helpers.Unauthorized), "Failed to verify password")
+	}
+	err = checkNotLastAdmin(dbUser.Id)
+	if err != nil {
+		return err
+	}
+	return database.DeleteUser(dbUser.Id)
+}
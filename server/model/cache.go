@@ -24,6 +24,10 @@ func GetCache(key string) (interface{}, bool) {
 	return cacheObject.Get(key)
 }
 
+func DeleteCache(key string) {
+	cacheObject.Remove(key)
+}
+
 func UpdateOrSetCache(key string, value interface{}, ttl time.Duration) error {
 	cacheObject.Remove(key)
 	return SetCache(key, value, ttl)
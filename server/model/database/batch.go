@@ -0,0 +1,142 @@
+package database
+
+import (
+	"errors"
+	"hound/helpers"
+)
+
+const (
+	CollectionBatchAdd    = "add"
+	CollectionBatchRemove = "remove"
+	CollectionBatchMove   = "move"
+	CollectionBatchCopy   = "copy"
+)
+
+var (
+	errItemAlreadyInCollection = errors.New("item already in collection")
+	errItemNotInCollection     = errors.New("item not in collection")
+	errItemDuplicate           = errors.New("item listed more than once")
+)
+
+// BatchUpdateCollectionRelations applies action to every library id in one transaction.
+// add, remove work on collectionID, move and copy go from collectionID to targetCollectionID.
+// Returns one error per item (nil on success), if any item fails nothing is applied
+func BatchUpdateCollectionRelations(userID int64, action string, collectionID int64,
+	targetCollectionID *int64, libraryIDs []int64) ([]error, error) {
+	// copying only needs read access to the source collection
+	sourceRole := CollectionRoleEditor
+	if action == CollectionBatchCopy {
+		sourceRole = CollectionRoleViewer
+	}
+	collection, err := getCollectionWithRole(userID, collectionID, sourceRole)
+	if err != nil {
+		return nil, err
+	}
+	if collection.Rules != nil {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "BatchUpdateCollectionRelations(): Smart collections have no items to modify")
+	}
+	// collection items are written to
+	writeCollectionID := collectionID
+	switch action {
+	case CollectionBatchAdd, CollectionBatchRemove:
+	case CollectionBatchMove, CollectionBatchCopy:
+		if targetCollectionID == nil || *targetCollectionID == collectionID {
+			return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "BatchUpdateCollectionRelations(): Invalid target collection")
+		}
+		target, err := getCollectionWithRole(userID, *targetCollectionID, CollectionRoleEditor)
+		if err != nil {
+			return nil, err
+		}
+		if target.Rules != nil {
+			return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "BatchUpdateCollectionRelations(): Items can't be added to smart collections")
+		}
+		writeCollectionID = *targetCollectionID
+	default:
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "BatchUpdateCollectionRelations(): Invalid action")
+	}
+	session := databaseEngine.NewSession()
+	defer session.Close()
+	_ = session.Begin()
+	// new items go to the top of the collection, in request order
+	var top CollectionRelation
+	_, err = session.Table(collectionRelationsTable).Where("collection_id = ?", writeCollectionID).
+		OrderBy("position asc").Get(&top)
+	if err != nil {
+		_ = session.Rollback()
+		return nil, helpers.LogErrorWithMessage(err, "BatchUpdateCollectionRelations(): Failed to get positions")
+	}
+	position := top.Position - int64(len(libraryIDs))
+	itemErrors := make([]error, len(libraryIDs))
+	failed := false
+	seen := make(map[int64]bool)
+	for num, libraryID := range libraryIDs {
+		if seen[libraryID] {
+			itemErrors[num] = errItemDuplicate
+			failed = true
+			continue
+		}
+		seen[libraryID] = true
+		inSource, err := session.Table(collectionRelationsTable).Where("collection_id = ?", collectionID).
+			Where("library_id = ?", libraryID).Exist(new(CollectionRelation))
+		if err != nil {
+			_ = session.Rollback()
+			return nil, helpers.LogErrorWithMessage(err, "BatchUpdateCollectionRelations(): Failed to check collection relation")
+		}
+		if action == CollectionBatchAdd {
+			if inSource {
+				itemErrors[num] = errItemAlreadyInCollection
+				failed = true
+			}
+		} else if !inSource {
+			itemErrors[num] = errItemNotInCollection
+			failed = true
+			continue
+		}
+		if action == CollectionBatchMove || action == CollectionBatchCopy {
+			inTarget, err := session.Table(collectionRelationsTable).Where("collection_id = ?", writeCollectionID).
+				Where("library_id = ?", libraryID).Exist(new(CollectionRelation))
+			if err != nil {
+				_ = session.Rollback()
+				return nil, helpers.LogErrorWithMessage(err, "BatchUpdateCollectionRelations(): Failed to check collection relation")
+			}
+			if inTarget {
+				itemErrors[num] = errItemAlreadyInCollection
+				failed = true
+			}
+		}
+		if failed {
+			// keep validating the rest for the report, nothing will be written
+			continue
+		}
+		if action != CollectionBatchRemove {
+			_, err = session.Table(collectionRelationsTable).Insert(&CollectionRelation{
+				UserID:       userID,
+				LibraryID:    libraryID,
+				CollectionID: writeCollectionID,
+				Position:     position + int64(num),
+			})
+			if err != nil {
+				_ = session.Rollback()
+				return nil, helpers.LogErrorWithMessage(err, "BatchUpdateCollectionRelations(): Failed to insert collection relation")
+			}
+		}
+		if action == CollectionBatchRemove || action == CollectionBatchMove {
+			_, err = session.Table(collectionRelationsTable).Where("collection_id = ?", collectionID).
+				Where("library_id = ?", libraryID).Delete(new(CollectionRelation))
+			if err != nil {
+				_ = session.Rollback()
+				return nil, helpers.LogErrorWithMessage(err, "BatchUpdateCollectionRelations(): Failed to delete collection relation")
+			}
+		}
+	}
+	if failed {
+		_ = session.Rollback()
+		return itemErrors, nil
+	}
+	err = session.Commit()
+	if err != nil {
+		_ = session.Rollback()
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.InternalServerError), "BatchUpdateCollectionRelations(): error committing transaction")
+	}
+	return itemErrors, nil
+}
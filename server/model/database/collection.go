@@ -2,11 +2,14 @@ package database
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/go-sql-driver/mysql"
 	"hound/helpers"
+	"strings"
 	"time"
+	"xorm.io/xorm"
 )
 
 /*
@@ -53,21 +56,23 @@ type CollectionRelation struct {
 	UserID       int64     `xorm:"unique(primary) not null 'user_id'" json:"user_id"` // refers to users table ids
 	LibraryID    int64     `xorm:"unique(primary) not null 'library_id'" json:"library_id"`
 	CollectionID int64     `xorm:"unique(primary) not null 'collection_id'" json:"collection_id"`
+	Position     int64     `xorm:"not null default 0" json:"position"` // user defined order, ascending
 	CreatedAt    time.Time `xorm:"created" json:"created_at"`
 	UpdatedAt    time.Time `xorm:"updated" json:"updated_at"`
 }
 
 type CollectionRecord struct {
-	CollectionID    int64        `xorm:"pk autoincr 'collection_id'" json:"collection_id"`
-	CollectionTitle string       `xorm:"not null" json:"collection_title"` // my collection, etc.
-	Description     []byte       `json:"description"`
-	OwnerID         int64        `xorm:"not null 'owner_user_id'" json:"owner_user_id"`
-	IsPrimary       bool         `json:"is_primary"` // is the user's primary collection, not deletable
-	IsPublic        bool         `json:"is_public"`
-	Tags            *[]TagObject `json:"tags"`
-	ThumbnailURL    *string      `xorm:"'thumbnail_url'" json:"thumbnail_url"` // url for media thumbnails
-	CreatedAt       time.Time    `xorm:"created" json:"created_at"`
-	UpdatedAt       time.Time    `xorm:"updated" json:"updated_at"`
+	CollectionID    int64            `xorm:"pk autoincr 'collection_id'" json:"collection_id"`
+	CollectionTitle string           `xorm:"not null" json:"collection_title"` // my collection, etc.
+	Description     []byte           `json:"description"`
+	OwnerID         int64            `xorm:"not null 'owner_user_id'" json:"owner_user_id"`
+	IsPrimary       bool             `json:"is_primary"` // is the user's primary collection, not deletable
+	IsPublic        bool             `json:"is_public"`
+	Tags            *[]TagObject     `json:"tags"`
+	ThumbnailURL    *string          `xorm:"'thumbnail_url'" json:"thumbnail_url"` // url for media thumbnails
+	Rules           *CollectionRules `json:"rules"`                                // smart collection rules, nil for normal collections
+	CreatedAt       time.Time        `xorm:"created" json:"created_at"`
+	UpdatedAt       time.Time        `xorm:"updated" json:"updated_at"`
 }
 
 type LibraryGroup struct {
@@ -76,21 +81,40 @@ type LibraryGroup struct {
 	CollectionID  int64
 }
 
+const (
+	CollectionSortNewest       = "newest"
+	CollectionSortMostItems    = "most_items"
+	CollectionSortMostFollowed = "most_followed"
+)
+
 type CollectionRecordQuery struct {
 	CollectionID *int64
-	SearchQuery  *string
+	SearchQuery  *string // matches title or description
 	OwnerID      *int64
 	IsPrimary    *bool
 	IsPublic     *bool
-	Tags         *[]TagObject `json:"tags"`
+	Tags         *[]TagObject `json:"tags"` // matched by tag name, collection must have every tag
+	SortBy       *string      // newest (default), most_items, most_followed
+	MemberID     *int64       // collections owned by or shared with (accepted) this user
+}
+
+// UpdateCollectionRequest only updates fields that are present
+type UpdateCollectionRequest struct {
+	CollectionTitle *string          `json:"collection_title"`
+	Description     *string          `json:"description"`
+	IsPublic        *bool            `json:"is_public"`
+	Tags            *[]TagObject     `json:"tags"`
+	ThumbnailURL    *string          `json:"thumbnail_url"`
+	Rules           *CollectionRules `json:"rules"` // smart collections only, rules can't be added to normal collections
 }
 
 type CreateCollectionRequest struct {
-	OwnerID         int64  `json:"owner_id"`
-	CollectionTitle string `json:"collection_title"` // my collection, etc.
-	Description     string `json:"description"`
-	IsPrimary       bool   `json:"is_primary"` // is the user's primary collection, not deletable
-	IsPublic        bool   `json:"is_public"`
+	OwnerID         int64            `json:"owner_id"`
+	CollectionTitle string           `json:"collection_title"` // my collection, etc.
+	Description     string           `json:"description"`
+	IsPrimary       bool             `json:"is_primary"` // is the user's primary collection, not deletable
+	IsPublic        bool             `json:"is_public"`
+	Rules           *CollectionRules `json:"rules"` // creates a smart collection
 }
 
 func instantiateMediaTables() error {
@@ -111,16 +135,17 @@ func instantiateMediaTables() error {
 
 func GetCollectionRecords(userID int64, collectionID int64, limit int, offset int) ([]LibraryGroup, *CollectionRecord, int64, error) {
 	var libraryGroups []LibraryGroup
-	var collection CollectionRecord
-	found, err := databaseEngine.Table(collectionsTable).ID(collectionID).Get(&collection)
+	// public collections or collections shared with the user
+	collection, err := getCollectionWithRole(userID, collectionID, CollectionRoleViewer)
 	if err != nil {
 		return nil, nil, -1, err
 	}
-	if !found {
-		return nil, nil, -1, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "getCollectionRecords(): No collection with this ID")
-	}
-	if !collection.IsPublic && collection.OwnerID != userID {
-		return nil, nil, -1, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "user does not have access to collection")
+	if collection.Rules != nil {
+		libraryGroups, totalRecords, err := getSmartCollectionRecords(collection, limit, offset)
+		if err != nil {
+			return nil, nil, -1, err
+		}
+		return libraryGroups, collection, totalRecords, nil
 	}
 	sess := databaseEngine.Table(libraryTable)
 	if limit > 0 && offset >= 0 {
@@ -129,7 +154,7 @@ func GetCollectionRecords(userID int64, collectionID int64, limit int, offset in
 	err = sess.Where("collection_id = ?", collectionID).
 		Join("INNER", collectionRelationsTable,
 			fmt.Sprintf("%s.library_id = %s.library_id", libraryTable, collectionRelationsTable)).
-			OrderBy(fmt.Sprintf("%s.updated_at desc", collectionRelationsTable)).
+		OrderBy(fmt.Sprintf("%s.position asc, %s.updated_at desc", collectionRelationsTable, collectionRelationsTable)).
 		Find(&libraryGroups)
 	if err != nil {
 		return nil, nil, -1, err
@@ -139,7 +164,7 @@ func GetCollectionRecords(userID int64, collectionID int64, limit int, offset in
 	if err != nil {
 		return nil, nil, -1, err
 	}
-	return libraryGroups, &collection, totalRecords, nil
+	return libraryGroups, collection, totalRecords, nil
 }
 
 func InsertCollectionRelation(userID int64, libraryID int64, collectionID *int64) error {
@@ -155,26 +180,38 @@ func InsertCollectionRelation(userID int64, libraryID int64, collectionID *int64
 		}
 		collectionID = &collectionRecord.CollectionID
 	} else {
-		// check if collection exists in collections table
+		// check if collection exists in collections table and user is authorized to add to it
 		// TODO should ideally be covered by foreign key constraint, xorm does not handle sync with fk right now
-		var collectionRecord CollectionRecord
-		has, err := databaseEngine.Table(collectionsTable).ID(*collectionID).Get(&collectionRecord)
+		collection, err := getCollectionWithRole(userID, *collectionID, CollectionRoleEditor)
 		if err != nil {
 			return err
 		}
-		if !has {
-			return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Collection not found")
-		}
-		// check if user is authorized to add to collection
-		if collectionRecord.OwnerID != userID {
-			return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Collection - owner mismatch, unauthorized")
+		if collection.Rules != nil {
+			return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Items can't be added to smart collections")
 		}
 	}
+	// relations are unique per user, an item added by another editor is still a duplicate
+	exists, err := databaseEngine.Table(collectionRelationsTable).Where("collection_id = ?", *collectionID).
+		Where("library_id = ?", libraryID).Exist(new(CollectionRelation))
+	if err != nil {
+		return err
+	}
+	if exists {
+		return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Item already in collection")
+	}
+	// new items go to the top of the collection
+	var relation CollectionRelation
+	_, err = databaseEngine.Table(collectionRelationsTable).Where("collection_id = ?", *collectionID).
+		OrderBy("position asc").Get(&relation)
+	if err != nil {
+		return err
+	}
 	// insert record to db
-	_, err := databaseEngine.Table(collectionRelationsTable).Insert(CollectionRelation{
+	_, err = databaseEngine.Table(collectionRelationsTable).Insert(CollectionRelation{
 		UserID:       userID,
 		LibraryID:    libraryID,
 		CollectionID: *collectionID,
+		Position:     relation.Position - 1,
 	})
 	if err != nil {
 		var mysqlErr *mysql.MySQLError
@@ -186,21 +223,16 @@ func InsertCollectionRelation(userID int64, libraryID int64, collectionID *int64
 }
 
 func DeleteCollectionRelation(userID int64, libraryID int64, collectionID int64) error {
-	var collectionRecord CollectionRecord
-	has, err := databaseEngine.Table(collectionsTable).ID(collectionID).Get(&collectionRecord)
+	// check if user is authorized to remove from collection
+	collection, err := getCollectionWithRole(userID, collectionID, CollectionRoleEditor)
 	if err != nil {
 		return err
 	}
-	if !has {
-		return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Collection not found")
-	}
-	// check if user is authorized to add to collection
-	if collectionRecord.OwnerID != userID {
-		return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Collection - owner mismatch, unauthorized")
+	if collection.Rules != nil {
+		return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Items can't be removed from smart collections")
 	}
-	// if user authenticated, remove
+	// if user authenticated, remove, editors can remove items added by anyone
 	affected, err := databaseEngine.Table(collectionRelationsTable).Delete(&CollectionRelation{
-		UserID:       userID,
 		LibraryID:    libraryID,
 		CollectionID: collectionID,
 	})
@@ -224,6 +256,15 @@ func CreateCollection(record CreateCollectionRequest) (*int64, error) {
 			return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Primary col already exists")
 		}
 	}
+	if record.Rules != nil {
+		if record.IsPrimary {
+			return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Primary col can't be a smart collection")
+		}
+		err := ValidateCollectionRules(record.Rules)
+		if err != nil {
+			return nil, err
+		}
+	}
 	insert := CollectionRecord{
 		CollectionTitle: record.CollectionTitle,
 		Description:     []byte(record.Description),
@@ -232,6 +273,7 @@ func CreateCollection(record CreateCollectionRequest) (*int64, error) {
 		IsPublic:        record.IsPublic,
 		Tags:            nil,
 		ThumbnailURL:    nil,
+		Rules:           record.Rules,
 	}
 	_, err := databaseEngine.Table(collectionsTable).Insert(&insert)
 	if err != nil {
@@ -240,6 +282,111 @@ func CreateCollection(record CreateCollectionRequest) (*int64, error) {
 	return &insert.CollectionID, nil
 }
 
+// UpdateCollection updates collection metadata, requires the owner role
+func UpdateCollection(userID int64, collectionID int64, update UpdateCollectionRequest) error {
+	collectionRecord, err := getCollectionWithRole(userID, collectionID, CollectionRoleOwner)
+	if err != nil {
+		return err
+	}
+	if update.CollectionTitle != nil {
+		collectionRecord.CollectionTitle = *update.CollectionTitle
+	}
+	if update.Description != nil {
+		collectionRecord.Description = []byte(*update.Description)
+	}
+	if update.IsPublic != nil {
+		collectionRecord.IsPublic = *update.IsPublic
+	}
+	if update.Tags != nil {
+		collectionRecord.Tags = update.Tags
+	}
+	if update.Rules != nil {
+		if collectionRecord.Rules == nil {
+			return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "UpdateCollection(): Not a smart collection")
+		}
+		err = ValidateCollectionRules(update.Rules)
+		if err != nil {
+			return err
+		}
+		collectionRecord.Rules = update.Rules
+	}
+	if update.ThumbnailURL != nil {
+		// empty string clears the thumbnail
+		collectionRecord.ThumbnailURL = update.ThumbnailURL
+		if *update.ThumbnailURL == "" {
+			collectionRecord.ThumbnailURL = nil
+		}
+	}
+	_, err = databaseEngine.Table(collectionsTable).ID(collectionID).
+		Cols("collection_title", "description", "is_public", "tags", "thumbnail_url", "rules").
+		Update(collectionRecord)
+	if err != nil {
+		return helpers.LogErrorWithMessage(err, "UpdateCollection(): Failed to update collection")
+	}
+	return nil
+}
+
+// MoveCollectionRelation moves an item to position (0 is the top) and renumbers the collection
+func MoveCollectionRelation(userID int64, libraryID int64, collectionID int64, position int) error {
+	collection, err := getCollectionWithRole(userID, collectionID, CollectionRoleEditor)
+	if err != nil {
+		return err
+	}
+	if collection.Rules != nil {
+		return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Smart collections can't be reordered")
+	}
+	if position < 0 {
+		return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "MoveCollectionRelation(): Invalid position")
+	}
+	session := databaseEngine.NewSession()
+	defer session.Close()
+	_ = session.Begin()
+	var relations []CollectionRelation
+	err = session.Table(collectionRelationsTable).Where("collection_id = ?", collectionID).
+		OrderBy("position asc, updated_at desc").Find(&relations)
+	if err != nil {
+		_ = session.Rollback()
+		return helpers.LogErrorWithMessage(err, "MoveCollectionRelation(): Failed to get collection relations")
+	}
+	current := -1
+	for num, item := range relations {
+		if item.LibraryID == libraryID {
+			current = num
+			break
+		}
+	}
+	if current == -1 {
+		_ = session.Rollback()
+		return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "MoveCollectionRelation(): Item not in collection")
+	}
+	moved := relations[current]
+	relations = append(relations[:current], relations[current+1:]...)
+	if position > len(relations) {
+		position = len(relations)
+	}
+	relations = append(relations[:position], append([]CollectionRelation{moved}, relations[position:]...)...)
+	for num, item := range relations {
+		if item.Position == int64(num) {
+			continue
+		}
+		// keep updated_at, it's the tie breaker for unordered items
+		_, err = session.Table(collectionRelationsTable).NoAutoTime().
+			Where("collection_id = ?", collectionID).Where("library_id = ?", item.LibraryID).
+			Where("user_id = ?", item.UserID).Cols("position").
+			Update(&CollectionRelation{Position: int64(num)})
+		if err != nil {
+			_ = session.Rollback()
+			return helpers.LogErrorWithMessage(err, "MoveCollectionRelation(): Failed to update position")
+		}
+	}
+	err = session.Commit()
+	if err != nil {
+		_ = session.Rollback()
+		return helpers.LogErrorWithMessage(errors.New(helpers.InternalServerError), "MoveCollectionRelation(): error committing transaction")
+	}
+	return nil
+}
+
 func DeleteCollection(userID int64, collectionID int64) error {
 	session := databaseEngine.NewSession()
 	defer session.Close()
@@ -254,7 +401,7 @@ func DeleteCollection(userID int64, collectionID int64) error {
 	// primary collections can't be deleted
 	affected, err := session.Table(collectionsTable).Where("is_primary = ?", false).Delete(&CollectionRecord{
 		CollectionID: collectionID,
-		OwnerID: userID,
+		OwnerID:      userID,
 	})
 	if err != nil {
 		_ = session.Rollback()
@@ -264,6 +411,16 @@ func DeleteCollection(userID int64, collectionID int64) error {
 		_ = session.Rollback()
 		return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "DeleteCollection(): No collection found with this ID or invalid user")
 	}
+	_, err = session.Table(collectionFollowsTable).Delete(&CollectionFollow{CollectionID: collectionID})
+	if err != nil {
+		_ = session.Rollback()
+		return helpers.LogErrorWithMessage(err, "DeleteCollection(): Failed to delete collection follows")
+	}
+	_, err = session.Table(collectionMembersTable).Delete(&CollectionMember{CollectionID: collectionID})
+	if err != nil {
+		_ = session.Rollback()
+		return helpers.LogErrorWithMessage(err, "DeleteCollection(): Failed to delete collection members")
+	}
 	err = session.Commit()
 	if err != nil {
 		_ = session.Rollback()
@@ -274,18 +431,22 @@ func DeleteCollection(userID int64, collectionID int64) error {
 
 func SearchForCollection(record CollectionRecordQuery, limit int, offset int) ([]CollectionRecord, int, error) {
 	var records []CollectionRecord
-	sess := databaseEngine.Table(collectionsTable)
-	if record.OwnerID != nil {
-		sess = sess.Where("owner_user_id = ?", record.OwnerID)
-	}
-	if record.IsPrimary != nil {
-		sess = sess.Where("is_primary = ?", record.IsPrimary)
-	}
-	if record.CollectionID != nil {
-		sess = sess.Where("collection_id = ?", record.CollectionID)
-	}
-	if record.IsPublic != nil {
-		sess = sess.Where("is_public = ?", record.IsPublic)
+	sess := collectionQuerySession(record)
+	sortBy := CollectionSortNewest
+	if record.SortBy != nil && *record.SortBy != "" {
+		sortBy = *record.SortBy
+	}
+	switch sortBy {
+	case CollectionSortNewest:
+		sess = sess.OrderBy(fmt.Sprintf("%s.created_at desc", collectionsTable))
+	case CollectionSortMostItems:
+		sess = sess.OrderBy(fmt.Sprintf("(SELECT COUNT(*) FROM %s WHERE %s.collection_id = %s.collection_id) desc, %s.created_at desc",
+			collectionRelationsTable, collectionRelationsTable, collectionsTable, collectionsTable))
+	case CollectionSortMostFollowed:
+		sess = sess.OrderBy(fmt.Sprintf("(SELECT COUNT(*) FROM %s WHERE %s.collection_id = %s.collection_id) desc, %s.created_at desc",
+			collectionFollowsTable, collectionFollowsTable, collectionsTable, collectionsTable))
+	default:
+		return nil, 0, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "SearchForCollection(): Invalid sort")
 	}
 	if limit > 0 && offset >= 0 {
 		sess = sess.Limit(limit, offset)
@@ -295,10 +456,22 @@ func SearchForCollection(record CollectionRecordQuery, limit int, offset int) ([
 		return nil, 0, err
 	}
 	// restart session to get total count
-	sess = databaseEngine.Table(collectionsTable)
+	totalRecords, err := collectionQuerySession(record).Count(new(CollectionRecord))
+	if err != nil {
+		return nil, 0, err
+	}
+	return records, int(totalRecords), nil
+}
+
+func collectionQuerySession(record CollectionRecordQuery) *xorm.Session {
+	sess := databaseEngine.Table(collectionsTable)
 	if record.OwnerID != nil {
 		sess = sess.Where("owner_user_id = ?", record.OwnerID)
 	}
+	if record.MemberID != nil {
+		sess = sess.Where(fmt.Sprintf("(owner_user_id = ? OR collection_id IN (SELECT collection_id FROM %s WHERE user_id = ? AND is_accepted = ?))",
+			collectionMembersTable), *record.MemberID, *record.MemberID, true)
+	}
 	if record.IsPrimary != nil {
 		sess = sess.Where("is_primary = ?", record.IsPrimary)
 	}
@@ -308,11 +481,31 @@ func SearchForCollection(record CollectionRecordQuery, limit int, offset int) ([
 	if record.IsPublic != nil {
 		sess = sess.Where("is_public = ?", record.IsPublic)
 	}
-	totalRecords, err := sess.Count(new(CollectionRecord))
-	if err != nil {
-		return nil, 0, err
+	if record.SearchQuery != nil && *record.SearchQuery != "" {
+		pattern := "%" + escapeLike(*record.SearchQuery) + "%"
+		sess = sess.Where("(collection_title LIKE ? OR description LIKE ?)", pattern, pattern)
+	}
+	if record.Tags != nil {
+		// tags are stored as json, match on the serialized tag name
+		for _, tag := range *record.Tags {
+			tagJson, err := json.Marshal(tag.TagName)
+			if err != nil {
+				continue
+			}
+			sess = sess.Where("tags LIKE ?", "%\"TagName\":"+escapeLike(string(tagJson))+"%")
+		}
 	}
-	return records, int(totalRecords), nil
+	return sess
+}
+
+// CountCollectionItems returns the number of items in a collection
+func CountCollectionItems(collectionID int64) (int64, error) {
+	return databaseEngine.Table(collectionRelationsTable).Where("collection_id = ?", collectionID).
+		Count(new(CollectionRelation))
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(value)
 }
 
 func AddRecordToInternalLibrary(libraryRecord *LibraryRecord) (int64, error) {
@@ -327,7 +520,11 @@ func AddRecordToInternalLibrary(libraryRecord *LibraryRecord) (int64, error) {
 		// use existing SourceID
 		libraryID = existingRecords[0].LibraryID
 		if !bytes.Equal(existingRecords[0].FullData, libraryRecord.FullData) {
-			// TODO update db with new data
+			// source returned fresher data, update stored metadata
+			err := UpdateLibraryRecord(libraryID, libraryRecord)
+			if err != nil {
+				return -1, err
+			}
 		}
 	} else {
 		// insert media data to library table
@@ -340,6 +537,46 @@ func AddRecordToInternalLibrary(libraryRecord *LibraryRecord) (int64, error) {
 	return libraryID, nil
 }
 
+// UpdateLibraryRecord overwrites metadata fields of an existing library record, updated_at is always bumped
+func UpdateLibraryRecord(libraryID int64, libraryRecord *LibraryRecord) error {
+	_, err := databaseEngine.Table(libraryTable).ID(libraryID).
+		Cols("media_title", "release_date", "description", "full_data", "thumbnail_url", "tags").
+		Update(libraryRecord)
+	if err != nil {
+		return helpers.LogErrorWithMessage(err, "UpdateLibraryRecord(): Failed to update library record")
+	}
+	return nil
+}
+
+// TouchLibraryRecord bumps updated_at without changing metadata, used when a refresh fails
+// so the record moves to the back of the stale queue
+func TouchLibraryRecord(libraryID int64) error {
+	_, err := databaseEngine.Table(libraryTable).ID(libraryID).
+		Cols("updated_at").Update(&LibraryRecord{UpdatedAt: time.Now()})
+	if err != nil {
+		return helpers.LogErrorWithMessage(err, "TouchLibraryRecord(): Failed to update library record")
+	}
+	return nil
+}
+
+// GetStaleLibraryRecords returns records not updated since olderThan, oldest first.
+// Only identifying columns are loaded
+func GetStaleLibraryRecords(olderThan time.Time, limit int) ([]LibraryRecord, error) {
+	var records []LibraryRecord
+	sess := databaseEngine.Table(libraryTable).
+		Cols("library_id", "media_type", "media_source", "source_id", "updated_at").
+		Where("updated_at < ?", olderThan).
+		OrderBy("updated_at asc")
+	if limit > 0 {
+		sess = sess.Limit(limit)
+	}
+	err := sess.Find(&records)
+	if err != nil {
+		return nil, helpers.LogErrorWithMessage(err, "GetStaleLibraryRecords(): Failed to get library records")
+	}
+	return records, nil
+}
+
 func GetInternalLibraryID(mediaType string, mediaSource string, sourceID string) (*int64, error) {
 	var record LibraryRecord
 	has, err := databaseEngine.Table(libraryTable).Where("media_type = ?", mediaType).
@@ -354,3 +591,29 @@ func GetInternalLibraryID(mediaType string, mediaSource string, sourceID string)
 	}
 	return &record.LibraryID, nil
 }
+
+// GetLibraryRecords returns library records by id, in no particular order
+func GetLibraryRecords(libraryIDs []int64) ([]LibraryRecord, error) {
+	records := []LibraryRecord{}
+	if len(libraryIDs) == 0 {
+		return records, nil
+	}
+	err := databaseEngine.Table(libraryTable).In("library_id", libraryIDs).Find(&records)
+	if err != nil {
+		return nil, helpers.LogErrorWithMessage(err, "GetLibraryRecords(): Failed to get library records")
+	}
+	return records, nil
+}
+
+// GetCollectedLibraryIDs returns the distinct library ids in any collection the user owns
+func GetCollectedLibraryIDs(userID int64) ([]int64, error) {
+	var libraryIDs []int64
+	err := databaseEngine.Table(collectionRelationsTable).
+		Join("INNER", collectionsTable, fmt.Sprintf("%s.collection_id = %s.collection_id", collectionRelationsTable, collectionsTable)).
+		Where(fmt.Sprintf("%s.owner_user_id = ?", collectionsTable), userID).
+		Distinct(fmt.Sprintf("%s.library_id", collectionRelationsTable)).Find(&libraryIDs)
+	if err != nil {
+		return nil, helpers.LogErrorWithMessage(err, "GetCollectedLibraryIDs(): Failed to get collection items")
+	}
+	return libraryIDs, nil
+}
@@ -12,8 +12,10 @@ const (
 	commentTypeReview  = "review"
 	commentTypeNote    = "note"
 	commentTypeComment = "comment"
-	// watch history, play history, etc.
+	// legacy watch history, migrated to the history table on startup
 	commentTypeHistory = "history"
+	// previous versions of edited comments
+	commentEditsTable = "comment_edits"
 )
 
 type CommentRecord struct {
@@ -32,23 +34,159 @@ type CommentRecord struct {
 	UpdatedAt    time.Time `xorm:"updated" json:"updated_at"`
 }
 
+// CommentEditRecord is a snapshot of a comment taken right before it was edited
+type CommentEditRecord struct {
+	EditID       int64     `xorm:"pk autoincr 'edit_id'" json:"edit_id"`
+	CommentID    int64     `xorm:"not null index 'comment_id'" json:"comment_id"`
+	UserID       int64     `xorm:"not null index 'user_id'" json:"user_id"`
+	CommentType  string    `json:"comment_type"`
+	IsPrivate    bool      `json:"is_private"`
+	CommentTitle string    `json:"title"`
+	Comment      []byte    `json:"comment"`
+	TagData      string    `json:"tag_data"`
+	Score        int       `json:"score"`
+	StartDate    time.Time `json:"start_date"`
+	EndDate      time.Time `json:"end_date"`
+	EditedAt     time.Time `xorm:"created" json:"edited_at"`
+}
+
 func instantiateCommentTable() error {
 	err := databaseEngine.Table(commentsTable).Sync2(new(CommentRecord))
 	if err != nil {
 		return err
 	}
+	err = databaseEngine.Table(commentEditsTable).Sync2(new(CommentEditRecord))
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
 func AddComment(comment *CommentRecord) error {
-	if comment.CommentType != commentTypeReview && comment.CommentType != commentTypeComment &&
-		comment.CommentType != commentTypeNote && comment.CommentType != commentTypeHistory {
-		return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid comment type")
+	err := validateCommentType(comment.CommentType)
+	if err != nil {
+		return err
 	}
-	_, err := databaseEngine.Table(commentsTable).Insert(comment)
+	_, err = databaseEngine.Table(commentsTable).Insert(comment)
 	return err
 }
 
+// AddReviewIfMissing adds a review unless the user already reviewed the item. Used by imports
+func AddReviewIfMissing(userID int64, libraryID int64, score int, review string, reviewedAt time.Time) (bool, error) {
+	if score < 0 || score > 100 {
+		return false, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "AddReviewIfMissing(): Score must be between 0 and 100")
+	}
+	exists, err := databaseEngine.Table(commentsTable).Where("user_id = ?", userID).
+		Where("library_id = ?", libraryID).Where("comment_type = ?", commentTypeReview).Exist(new(CommentRecord))
+	if err != nil {
+		return false, helpers.LogErrorWithMessage(err, "AddReviewIfMissing(): Failed to check reviews")
+	}
+	if exists {
+		return false, nil
+	}
+	err = AddComment(&CommentRecord{
+		CommentType: commentTypeReview,
+		UserID:      userID,
+		LibraryID:   libraryID,
+		Comment:     []byte(review),
+		Score:       score,
+		StartDate:   reviewedAt,
+	})
+	if err != nil {
+		return false, helpers.LogErrorWithMessage(err, "AddReviewIfMissing(): Failed to add review")
+	}
+	return true, nil
+}
+
+func validateCommentType(commentType string) error {
+	if commentType != commentTypeReview && commentType != commentTypeComment &&
+		commentType != commentTypeNote {
+		return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid comment type")
+	}
+	return nil
+}
+
+func GetComment(commentID int64) (*CommentRecord, error) {
+	var comment CommentRecord
+	found, err := databaseEngine.Table(commentsTable).ID(commentID).Get(&comment)
+	if err != nil {
+		return nil, helpers.LogErrorWithMessage(err, "GetComment(): Failed to get comment")
+	}
+	if !found {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "GetComment(): No comment found with this ID")
+	}
+	return &comment, nil
+}
+
+// UpdateComment saves the current version of the comment to comment_edits and overwrites it
+// with comment. Only the owner can edit, created_at is kept
+func UpdateComment(userID int64, comment *CommentRecord) error {
+	err := validateCommentType(comment.CommentType)
+	if err != nil {
+		return err
+	}
+	if comment.Score < 0 || comment.Score > 100 {
+		return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "UpdateComment(): Score must be between 0 and 100")
+	}
+	session := databaseEngine.NewSession()
+	defer session.Close()
+	_ = session.Begin()
+	var previous CommentRecord
+	found, err := session.Table(commentsTable).ID(comment.CommentID).Get(&previous)
+	if err != nil {
+		_ = session.Rollback()
+		return helpers.LogErrorWithMessage(err, "UpdateComment(): Failed to get comment")
+	}
+	if !found {
+		_ = session.Rollback()
+		return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "UpdateComment(): No comment found with this ID")
+	}
+	if previous.UserID != userID {
+		_ = session.Rollback()
+		return helpers.LogErrorWithMessage(errors.New(helpers.Forbidden), "UpdateComment(): Comment belongs to another user")
+	}
+	_, err = session.Table(commentEditsTable).Insert(&CommentEditRecord{
+		CommentID:    previous.CommentID,
+		UserID:       previous.UserID,
+		CommentType:  previous.CommentType,
+		IsPrivate:    previous.IsPrivate,
+		CommentTitle: previous.CommentTitle,
+		Comment:      previous.Comment,
+		TagData:      previous.TagData,
+		Score:        previous.Score,
+		StartDate:    previous.StartDate,
+		EndDate:      previous.EndDate,
+	})
+	if err != nil {
+		_ = session.Rollback()
+		return helpers.LogErrorWithMessage(err, "UpdateComment(): Failed to save edit history")
+	}
+	_, err = session.Table(commentsTable).ID(comment.CommentID).
+		Cols("comment_type", "is_private", "comment_title", "comment", "tag_data", "score", "start_date", "end_date").
+		Update(comment)
+	if err != nil {
+		_ = session.Rollback()
+		return helpers.LogErrorWithMessage(err, "UpdateComment(): Failed to update comment")
+	}
+	err = session.Commit()
+	if err != nil {
+		_ = session.Rollback()
+		return helpers.LogErrorWithMessage(errors.New(helpers.InternalServerError), "UpdateComment(): error committing transaction")
+	}
+	return nil
+}
+
+// GetCommentEdits returns previous versions of a comment, newest first
+func GetCommentEdits(commentID int64) ([]CommentEditRecord, error) {
+	var edits []CommentEditRecord
+	err := databaseEngine.Table(commentEditsTable).Where("comment_id = ?", commentID).
+		OrderBy("edited_at desc, edit_id desc").Find(&edits)
+	if err != nil {
+		return nil, helpers.LogErrorWithMessage(err, "GetCommentEdits(): Failed to get comment edits")
+	}
+	return edits, nil
+}
+
 func AddCommentsBatch(comments *[]CommentRecord) error {
 	_, err := databaseEngine.Table(commentsTable).Insert(comments)
 	return err
@@ -56,12 +194,7 @@ func AddCommentsBatch(comments *[]CommentRecord) error {
 
 func GetComments(libraryID int64, commentType *string) (*[]CommentRecord, error) {
 	var comments []CommentRecord
-	sess := databaseEngine.Table(commentsTable).Where("library_id = ?", libraryID)
-	if *commentType == commentTypeHistory {
-		sess = sess.OrderBy("start_date desc")
-	} else {
-		sess = sess.OrderBy("updated_at desc")
-	}
+	sess := databaseEngine.Table(commentsTable).Where("library_id = ?", libraryID).OrderBy("updated_at desc")
 	if commentType != nil && *commentType != "" {
 		sess.Where("comment_type = ?", commentType)
 	}
@@ -83,6 +216,10 @@ func DeleteComment(userID int64, commentID int64) error {
 	if affected <= 0 {
 		return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "DeleteComment(): No comment found with this ID or invalid user")
 	}
+	_, err = databaseEngine.Table(commentEditsTable).Where("comment_id = ?", commentID).Delete(new(CommentEditRecord))
+	if err != nil {
+		return helpers.LogErrorWithMessage(err, "DeleteComment(): Failed to delete comment edits")
+	}
 	return nil
 }
 
@@ -96,6 +233,11 @@ func DeleteCommentBatch(userID int64, commentIDs []int64) error {
 			_ = session.Rollback()
 			return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "DeleteCommentBatch(): No comment found with this ID or invalid user")
 		}
+		_, err = session.Table(commentEditsTable).Where("comment_id = ?", item).Delete(new(CommentEditRecord))
+		if err != nil {
+			_ = session.Rollback()
+			return helpers.LogErrorWithMessage(err, "DeleteCommentBatch(): Failed to delete comment edits")
+		}
 	}
 	_ = session.Commit()
 	return nil
@@ -34,4 +34,36 @@ func InstantiateDB() {
 	if err != nil {
 		panic(err)
 	}
+	err = instantiateTokensTable()
+	if err != nil {
+		panic(err)
+	}
+	err = instantiateHistoryTable()
+	if err != nil {
+		panic(err)
+	}
+	err = instantiateFollowsTable()
+	if err != nil {
+		panic(err)
+	}
+	err = instantiateMembersTable()
+	if err != nil {
+		panic(err)
+	}
+	err = instantiateMediaFilesTable()
+	if err != nil {
+		panic(err)
+	}
+	err = instantiateOrganizerOperationsTable()
+	if err != nil {
+		panic(err)
+	}
+	err = instantiateProgressTable()
+	if err != nil {
+		panic(err)
+	}
+	err = instantiateWebhookTokensTable()
+	if err != nil {
+		panic(err)
+	}
 }
@@ -0,0 +1,199 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"hound/helpers"
+	"time"
+)
+
+/*
+	Export - reading a user's data in bulk for exports, and writing it back on
+	re-import. Imported rows keep their original timestamps
+*/
+
+// CollectionItemGroup is a collection relation joined with its library record
+type CollectionItemGroup struct {
+	CollectionRelation `xorm:"extends"`
+	MediaType          string `json:"media_type"`
+	MediaSource        string `json:"media_source"`
+	SourceID           string `xorm:"'source_id'" json:"source_id"`
+	MediaTitle         string `json:"media_title"`
+}
+
+// CommentGroup is a comment joined with its library record
+type CommentGroup struct {
+	CommentRecord `xorm:"extends"`
+	MediaType     string `json:"media_type"`
+	MediaSource   string `json:"media_source"`
+	SourceID      string `xorm:"'source_id'" json:"source_id"`
+	MediaTitle    string `json:"media_title"`
+}
+
+// GetOwnedCollectionItems returns the items of every collection the user owns, in collection order
+func GetOwnedCollectionItems(userID int64) ([]CollectionItemGroup, error) {
+	var items []CollectionItemGroup
+	err := databaseEngine.Table(collectionRelationsTable).
+		Select(fmt.Sprintf("%s.*, %s.media_type, %s.media_source, %s.source_id, %s.media_title",
+			collectionRelationsTable, libraryTable, libraryTable, libraryTable, libraryTable)).
+		Join("INNER", libraryTable, fmt.Sprintf("%s.library_id = %s.library_id", collectionRelationsTable, libraryTable)).
+		Join("INNER", collectionsTable, fmt.Sprintf("%s.collection_id = %s.collection_id", collectionRelationsTable, collectionsTable)).
+		Where(fmt.Sprintf("%s.owner_user_id = ?", collectionsTable), userID).
+		OrderBy(fmt.Sprintf("%s.collection_id asc, %s.position asc", collectionRelationsTable, collectionRelationsTable)).
+		Find(&items)
+	if err != nil {
+		return nil, helpers.LogErrorWithMessage(err, "GetOwnedCollectionItems(): Failed to get collection items")
+	}
+	return items, nil
+}
+
+// GetUserComments returns the user's reviews, notes and comments, oldest first
+func GetUserComments(userID int64) ([]CommentGroup, error) {
+	var comments []CommentGroup
+	err := databaseEngine.Table(commentsTable).
+		Select(fmt.Sprintf("%s.*, %s.media_type, %s.media_source, %s.source_id, %s.media_title",
+			commentsTable, libraryTable, libraryTable, libraryTable, libraryTable)).
+		Join("INNER", libraryTable, fmt.Sprintf("%s.library_id = %s.library_id", commentsTable, libraryTable)).
+		Where(fmt.Sprintf("%s.user_id = ?", commentsTable), userID).
+		In(fmt.Sprintf("%s.comment_type", commentsTable), commentTypeReview, commentTypeNote, commentTypeComment).
+		OrderBy(fmt.Sprintf("%s.created_at asc, %s.comment_id asc", commentsTable, commentsTable)).
+		Find(&comments)
+	if err != nil {
+		return nil, helpers.LogErrorWithMessage(err, "GetUserComments(): Failed to get comments")
+	}
+	return comments, nil
+}
+
+// GetUserReviews returns the user's reviews joined with their library records, optionally
+// only reviews created within a date range
+func GetUserReviews(userID int64, startDate *time.Time, endDate *time.Time) ([]CommentGroup, error) {
+	var reviews []CommentGroup
+	sess := databaseEngine.Table(commentsTable).
+		Select(fmt.Sprintf("%s.*, %s.media_type, %s.media_source, %s.source_id, %s.media_title",
+			commentsTable, libraryTable, libraryTable, libraryTable, libraryTable)).
+		Join("INNER", libraryTable, fmt.Sprintf("%s.library_id = %s.library_id", commentsTable, libraryTable)).
+		Where(fmt.Sprintf("%s.user_id = ?", commentsTable), userID).
+		Where(fmt.Sprintf("%s.comment_type = ?", commentsTable), commentTypeReview)
+	if startDate != nil {
+		sess = sess.Where(fmt.Sprintf("%s.created_at >= ?", commentsTable), *startDate)
+	}
+	if endDate != nil {
+		sess = sess.Where(fmt.Sprintf("%s.created_at <= ?", commentsTable), *endDate)
+	}
+	err := sess.Find(&reviews)
+	if err != nil {
+		return nil, helpers.LogErrorWithMessage(err, "GetUserReviews(): Failed to get reviews")
+	}
+	return reviews, nil
+}
+
+// ImportCollection returns the user's collection matching an exported one, creating it if missing.
+// Primary collections merge into the user's primary collection, others match on title and creation time
+func ImportCollection(record CollectionRecord) (int64, bool, error) {
+	var existing CollectionRecord
+	sess := databaseEngine.Table(collectionsTable).Where("owner_user_id = ?", record.OwnerID)
+	if record.IsPrimary {
+		sess = sess.Where("is_primary = ?", true)
+	} else {
+		sess = sess.Where("is_primary = ?", false).Where("collection_title = ?", record.CollectionTitle).
+			Where("created_at = ?", record.CreatedAt)
+	}
+	found, err := sess.Get(&existing)
+	if err != nil {
+		return -1, false, helpers.LogErrorWithMessage(err, "ImportCollection(): Failed to get collection")
+	}
+	if found {
+		return existing.CollectionID, false, nil
+	}
+	if record.IsPrimary {
+		return -1, false, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "ImportCollection(): User has no primary collection")
+	}
+	if record.Rules != nil {
+		err = ValidateCollectionRules(record.Rules)
+		if err != nil {
+			return -1, false, err
+		}
+	}
+	record.CollectionID = 0
+	setImportTimestamps(&record.CreatedAt, &record.UpdatedAt)
+	_, err = databaseEngine.Table(collectionsTable).NoAutoTime().Insert(&record)
+	if err != nil {
+		return -1, false, helpers.LogErrorWithMessage(err, "ImportCollection(): Failed to insert collection")
+	}
+	return record.CollectionID, true, nil
+}
+
+// ImportCollectionRelation adds an item to a collection at its exported position, unless already there
+func ImportCollectionRelation(relation CollectionRelation) (bool, error) {
+	exists, err := databaseEngine.Table(collectionRelationsTable).Where("collection_id = ?", relation.CollectionID).
+		Where("library_id = ?", relation.LibraryID).Exist(new(CollectionRelation))
+	if err != nil {
+		return false, helpers.LogErrorWithMessage(err, "ImportCollectionRelation(): Failed to check collection")
+	}
+	if exists {
+		return false, nil
+	}
+	setImportTimestamps(&relation.CreatedAt, &relation.UpdatedAt)
+	_, err = databaseEngine.Table(collectionRelationsTable).NoAutoTime().Insert(&relation)
+	if err != nil {
+		return false, helpers.LogErrorWithMessage(err, "ImportCollectionRelation(): Failed to insert relation")
+	}
+	return true, nil
+}
+
+// ImportComment adds a comment unless the user has one of the same type on the item created at the same time
+func ImportComment(comment CommentRecord) (bool, error) {
+	err := validateCommentType(comment.CommentType)
+	if err != nil {
+		return false, err
+	}
+	exists, err := databaseEngine.Table(commentsTable).Where("user_id = ?", comment.UserID).
+		Where("library_id = ?", comment.LibraryID).Where("comment_type = ?", comment.CommentType).
+		Where("created_at = ?", comment.CreatedAt).Exist(new(CommentRecord))
+	if err != nil {
+		return false, helpers.LogErrorWithMessage(err, "ImportComment(): Failed to check comments")
+	}
+	if exists {
+		return false, nil
+	}
+	comment.CommentID = 0
+	setImportTimestamps(&comment.CreatedAt, &comment.UpdatedAt)
+	_, err = databaseEngine.Table(commentsTable).NoAutoTime().Insert(&comment)
+	if err != nil {
+		return false, helpers.LogErrorWithMessage(err, "ImportComment(): Failed to insert comment")
+	}
+	return true, nil
+}
+
+// ImportHistoryRecord adds a watch as exported, keeping its rewatch number and notes,
+// unless the same episode (or movie, game) was already recorded at the same time
+func ImportHistoryRecord(record HistoryRecord) (bool, error) {
+	exists, err := whereEpisode(databaseEngine.Table(historyTable).
+		Where("user_id = ?", record.UserID).
+		Where("library_id = ?", record.LibraryID).
+		Where("watched_at = ?", record.WatchedAt),
+		record.SeasonNumber, record.EpisodeNumber).Exist(new(HistoryRecord))
+	if err != nil {
+		return false, helpers.LogErrorWithMessage(err, "ImportHistoryRecord(): Failed to check history")
+	}
+	if exists {
+		return false, nil
+	}
+	record.HistoryID = 0
+	setImportTimestamps(&record.CreatedAt, &record.UpdatedAt)
+	_, err = databaseEngine.Table(historyTable).NoAutoTime().Insert(&record)
+	if err != nil {
+		return false, helpers.LogErrorWithMessage(err, "ImportHistoryRecord(): Failed to insert history")
+	}
+	return true, nil
+}
+
+// setImportTimestamps fills timestamps missing from hand written import files
+func setImportTimestamps(createdAt *time.Time, updatedAt *time.Time) {
+	if createdAt.IsZero() {
+		*createdAt = time.Now()
+	}
+	if updatedAt.IsZero() {
+		*updatedAt = *createdAt
+	}
+}
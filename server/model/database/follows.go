@@ -0,0 +1,77 @@
+package database
+
+import (
+	"errors"
+	"github.com/go-sql-driver/mysql"
+	"hound/helpers"
+	"time"
+)
+
+const (
+	// users following public collections
+	collectionFollowsTable = "collection_follows"
+)
+
+type CollectionFollow struct {
+	UserID       int64     `xorm:"unique(primary) not null 'user_id'" json:"user_id"`
+	CollectionID int64     `xorm:"unique(primary) not null index 'collection_id'" json:"collection_id"`
+	CreatedAt    time.Time `xorm:"created" json:"created_at"`
+}
+
+func instantiateFollowsTable() error {
+	err := databaseEngine.Table(collectionFollowsTable).Sync2(new(CollectionFollow))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// FollowCollection follows a public collection, users can't follow their own collections
+func FollowCollection(userID int64, collectionID int64) error {
+	var collectionRecord CollectionRecord
+	has, err := databaseEngine.Table(collectionsTable).ID(collectionID).Get(&collectionRecord)
+	if err != nil {
+		return err
+	}
+	if !has || !collectionRecord.IsPublic {
+		return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "FollowCollection(): No public collection with this ID")
+	}
+	if collectionRecord.OwnerID == userID {
+		return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "FollowCollection(): Can't follow own collection")
+	}
+	_, err = databaseEngine.Table(collectionFollowsTable).Insert(&CollectionFollow{
+		UserID:       userID,
+		CollectionID: collectionID,
+	})
+	if err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+			return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Already following collection")
+		}
+	}
+	return err
+}
+
+func UnfollowCollection(userID int64, collectionID int64) error {
+	affected, err := databaseEngine.Table(collectionFollowsTable).Delete(&CollectionFollow{
+		UserID:       userID,
+		CollectionID: collectionID,
+	})
+	if err != nil {
+		return helpers.LogErrorWithMessage(err, "UnfollowCollection(): Failed to unfollow collection")
+	}
+	if affected <= 0 {
+		return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "UnfollowCollection(): Not following collection")
+	}
+	return nil
+}
+
+func CountCollectionFollowers(collectionID int64) (int64, error) {
+	return databaseEngine.Table(collectionFollowsTable).Where("collection_id = ?", collectionID).
+		Count(new(CollectionFollow))
+}
+
+func IsFollowingCollection(userID int64, collectionID int64) (bool, error) {
+	return databaseEngine.Table(collectionFollowsTable).Where("user_id = ?", userID).
+		Where("collection_id = ?", collectionID).Exist(new(CollectionFollow))
+}
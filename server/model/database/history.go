@@ -1,16 +1,347 @@
 package database
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"hound/helpers"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+	"xorm.io/xorm"
+)
 
 const (
-	// for comments, notes, reviews
-	historyTable = "comment"
+	// watch/play history, one row per watch of a movie, game or episode
+	historyTable = "history"
 )
 
+var historyTagDataRegex = regexp.MustCompile(`^S(\d+)(?:E(\d+))?$`)
+
 type HistoryRecord struct {
-	HistoryID int64     `xorm:"pk autoincr 'history_id'" json:"id"`
-	UserID    int64     `xorm:"'user_id'" json:"user_id"`
-	LibraryID int64     `xorm:"'library_id'" json:"library_id"`
-	TagData   string    `json:"tag_data"` // extra tag info, eg. season, episode
-	CreatedAt time.Time `xorm:"created" json:"created_at"`
+	HistoryID     int64     `xorm:"pk autoincr 'history_id'" json:"id"`
+	UserID        int64     `xorm:"not null index 'user_id'" json:"user_id"`
+	LibraryID     int64     `xorm:"not null index 'library_id'" json:"library_id"`
+	SeasonNumber  *int      `json:"season_number"`  // null for movies, games
+	EpisodeNumber *int      `json:"episode_number"` // null for movies, games
+	WatchedAt     time.Time `xorm:"not null index" json:"watched_at"`
+	RewatchNumber int       `xorm:"not null default 0" json:"rewatch_number"` // 0 on first watch, incremented on every rewatch
+	Notes         []byte    `json:"notes"`
+	CreatedAt     time.Time `xorm:"created" json:"created_at"`
+	UpdatedAt     time.Time `xorm:"updated" json:"updated_at"`
+}
+
+// HistoryGroup is a history record joined with its library record
+type HistoryGroup struct {
+	HistoryRecord `xorm:"extends"`
+	MediaType     string  `json:"media_type"`
+	MediaSource   string  `json:"media_source"`
+	SourceID      string  `xorm:"'source_id'" json:"source_id"`
+	MediaTitle    string  `json:"media_title"`
+	ThumbnailURL  *string `xorm:"'thumbnail_url'" json:"thumbnail_url"`
+}
+
+// HistoryQuery filters history, nil fields are ignored
+type HistoryQuery struct {
+	UserID       int64
+	LibraryID    *int64
+	MediaType    *string
+	SeasonNumber *int
+	StartDate    *time.Time
+	EndDate      *time.Time
+}
+
+func instantiateHistoryTable() error {
+	err := databaseEngine.Table(historyTable).Sync2(new(HistoryRecord))
+	if err != nil {
+		return err
+	}
+	return migrateHistoryComments()
+}
+
+// AddHistoryRecords inserts watches in one transaction, assigning rewatch numbers
+func AddHistoryRecords(records []HistoryRecord) error {
+	session := databaseEngine.NewSession()
+	defer session.Close()
+	_ = session.Begin()
+	err := addHistoryRecordsSession(session, records)
+	if err != nil {
+		_ = session.Rollback()
+		return err
+	}
+	err = session.Commit()
+	if err != nil {
+		_ = session.Rollback()
+		return helpers.LogErrorWithMessage(errors.New(helpers.InternalServerError), "AddHistoryRecords(): error committing transaction")
+	}
+	return nil
+}
+
+func addHistoryRecordsSession(session *xorm.Session, records []HistoryRecord) error {
+	for num := range records {
+		previousWatches, err := whereEpisode(session.Table(historyTable).
+			Where("user_id = ?", records[num].UserID).
+			Where("library_id = ?", records[num].LibraryID),
+			records[num].SeasonNumber, records[num].EpisodeNumber).Count(new(HistoryRecord))
+		if err != nil {
+			return helpers.LogErrorWithMessage(err, "AddHistoryRecords(): Failed to count previous watches")
+		}
+		records[num].RewatchNumber = int(previousWatches)
+		_, err = session.Table(historyTable).Insert(&records[num])
+		if err != nil {
+			return helpers.LogErrorWithMessage(err, "AddHistoryRecords(): Failed to insert history")
+		}
+	}
+	return nil
+}
+
+// AddHistoryRecordIfMissing adds a watch unless the same episode (or movie, game) was already
+// recorded at the exact same time. Used by imports so re-importing a file adds nothing
+func AddHistoryRecordIfMissing(record HistoryRecord) (bool, error) {
+	exists, err := whereEpisode(databaseEngine.Table(historyTable).
+		Where("user_id = ?", record.UserID).
+		Where("library_id = ?", record.LibraryID).
+		Where("watched_at = ?", record.WatchedAt),
+		record.SeasonNumber, record.EpisodeNumber).Exist(new(HistoryRecord))
+	if err != nil {
+		return false, helpers.LogErrorWithMessage(err, "AddHistoryRecordIfMissing(): Failed to check history")
+	}
+	if exists {
+		return false, nil
+	}
+	err = AddHistoryRecords([]HistoryRecord{record})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func GetHistory(query HistoryQuery, limit int, offset int) ([]HistoryGroup, int64, error) {
+	var records []HistoryGroup
+	sess := historyQuerySession(query).
+		Select(fmt.Sprintf("%s.*, %s.media_type, %s.media_source, %s.source_id, %s.media_title, %s.thumbnail_url",
+			historyTable, libraryTable, libraryTable, libraryTable, libraryTable, libraryTable)).
+		OrderBy(fmt.Sprintf("%s.watched_at desc, %s.history_id desc", historyTable, historyTable))
+	if limit > 0 && offset >= 0 {
+		sess = sess.Limit(limit, offset)
+	}
+	err := sess.Find(&records)
+	if err != nil {
+		return nil, -1, helpers.LogErrorWithMessage(err, "GetHistory(): Failed to get history")
+	}
+	totalRecords, err := historyQuerySession(query).Count(new(HistoryRecord))
+	if err != nil {
+		return nil, -1, helpers.LogErrorWithMessage(err, "GetHistory(): Failed to count history")
+	}
+	return records, totalRecords, nil
+}
+
+func historyQuerySession(query HistoryQuery) *xorm.Session {
+	sess := databaseEngine.Table(historyTable).
+		Join("INNER", libraryTable, fmt.Sprintf("%s.library_id = %s.library_id", historyTable, libraryTable)).
+		Where(fmt.Sprintf("%s.user_id = ?", historyTable), query.UserID)
+	if query.LibraryID != nil {
+		sess = sess.Where(fmt.Sprintf("%s.library_id = ?", historyTable), *query.LibraryID)
+	}
+	if query.MediaType != nil {
+		sess = sess.Where(fmt.Sprintf("%s.media_type = ?", libraryTable), *query.MediaType)
+	}
+	if query.SeasonNumber != nil {
+		sess = sess.Where(fmt.Sprintf("%s.season_number = ?", historyTable), *query.SeasonNumber)
+	}
+	if query.StartDate != nil {
+		sess = sess.Where(fmt.Sprintf("%s.watched_at >= ?", historyTable), *query.StartDate)
+	}
+	if query.EndDate != nil {
+		sess = sess.Where(fmt.Sprintf("%s.watched_at <= ?", historyTable), *query.EndDate)
+	}
+	return sess
+}
+
+// DeleteHistory deletes all ids or none, ids must belong to userID
+func DeleteHistory(userID int64, historyIDs []int64) error {
+	session := databaseEngine.NewSession()
+	defer session.Close()
+	_ = session.Begin()
+	for _, item := range historyIDs {
+		affected, err := session.Table(historyTable).Delete(&HistoryRecord{UserID: userID, HistoryID: item})
+		if err != nil || affected <= 0 {
+			_ = session.Rollback()
+			return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "DeleteHistory(): No history found with this ID or invalid user")
+		}
+	}
+	err := session.Commit()
+	if err != nil {
+		_ = session.Rollback()
+		return helpers.LogErrorWithMessage(errors.New(helpers.InternalServerError), "DeleteHistory(): error committing transaction")
+	}
+	return nil
+}
+
+// matches rows for the same episode, or rows without episode data for movies, games
+func whereEpisode(sess *xorm.Session, seasonNumber *int, episodeNumber *int) *xorm.Session {
+	if seasonNumber == nil {
+		sess = sess.Where("season_number IS NULL")
+	} else {
+		sess = sess.Where("season_number = ?", *seasonNumber)
+	}
+	if episodeNumber == nil {
+		sess = sess.Where("episode_number IS NULL")
+	} else {
+		sess = sess.Where("episode_number = ?", *episodeNumber)
+	}
+	return sess
+}
+
+// migrateHistoryComments moves legacy history rows (comments with comment_type = "history"
+// and TagData like S1E3) into the history table. Runs on startup, no-op once migrated
+func migrateHistoryComments() error {
+	var comments []CommentRecord
+	err := databaseEngine.Table(commentsTable).Where("comment_type = ?", commentTypeHistory).Find(&comments)
+	if err != nil {
+		return err
+	}
+	if len(comments) == 0 {
+		return nil
+	}
+	// oldest first so rewatch numbers are assigned in watch order
+	sort.SliceStable(comments, func(i, j int) bool {
+		return getLegacyWatchDate(comments[i]).Before(getLegacyWatchDate(comments[j]))
+	})
+	var records []HistoryRecord
+	var commentIDs []int64
+	for _, comment := range comments {
+		record := HistoryRecord{
+			UserID:    comment.UserID,
+			LibraryID: comment.LibraryID,
+			WatchedAt: getLegacyWatchDate(comment),
+			Notes:     comment.Comment,
+		}
+		if comment.TagData != "" {
+			seasonNumber, episodeNumber, ok := ParseHistoryTagData(comment.TagData)
+			if !ok {
+				_ = helpers.LogErrorWithMessage(errors.New(helpers.BadRequest),
+					"migrateHistoryComments(): skipping unparseable tag data "+comment.TagData)
+				continue
+			}
+			record.SeasonNumber = seasonNumber
+			record.EpisodeNumber = episodeNumber
+		}
+		records = append(records, record)
+		commentIDs = append(commentIDs, comment.CommentID)
+	}
+	session := databaseEngine.NewSession()
+	defer session.Close()
+	_ = session.Begin()
+	err = addHistoryRecordsSession(session, records)
+	if err != nil {
+		_ = session.Rollback()
+		return err
+	}
+	_, err = session.Table(commentsTable).In("comment_id", commentIDs).Delete(new(CommentRecord))
+	if err != nil {
+		_ = session.Rollback()
+		return err
+	}
+	err = session.Commit()
+	if err != nil {
+		_ = session.Rollback()
+		return err
+	}
+	fmt.Println(helpers.InfoMsg(fmt.Sprintf("Migrated %d history comments to history table", len(records))))
+	return nil
+}
+
+func getLegacyWatchDate(comment CommentRecord) time.Time {
+	if comment.StartDate.IsZero() {
+		return comment.CreatedAt
+	}
+	return comment.StartDate
+}
+
+// ParseHistoryTagData parses legacy tag data, S1 (whole season) or S1E3
+func ParseHistoryTagData(tagData string) (*int, *int, bool) {
+	match := historyTagDataRegex.FindStringSubmatch(tagData)
+	if match == nil {
+		return nil, nil, false
+	}
+	seasonNumber, _ := strconv.Atoi(match[1])
+	if match[2] == "" {
+		return &seasonNumber, nil, true
+	}
+	episodeNumber, _ := strconv.Atoi(match[2])
+	return &seasonNumber, &episodeNumber, true
+}
+
+// ShowActivity is a show the user has watched episodes of, with its watched
+// episodes and the time of the latest watch
+type ShowActivity struct {
+	LibraryID       int64 `xorm:"'library_id'"`
+	MediaSource     string
+	SourceID        string `xorm:"'source_id'"`
+	MediaTitle      string
+	ThumbnailURL    *string `xorm:"'thumbnail_url'"`
+	LastWatchedAt   time.Time
+	WatchedEpisodes []HistoryRecord `xorm:"-"`
+}
+
+// GetShowActivity returns every tv show with episode history for a user, most recent activity first
+func GetShowActivity(userID int64) ([]ShowActivity, error) {
+	var shows []ShowActivity
+	err := databaseEngine.Table(historyTable).
+		Join("INNER", libraryTable, fmt.Sprintf("%s.library_id = %s.library_id", historyTable, libraryTable)).
+		Select(fmt.Sprintf("%s.library_id, %s.media_source, %s.source_id, %s.media_title, %s.thumbnail_url, MAX(%s.watched_at) AS last_watched_at",
+			historyTable, libraryTable, libraryTable, libraryTable, libraryTable, historyTable)).
+		Where(fmt.Sprintf("%s.user_id = ?", historyTable), userID).
+		Where(fmt.Sprintf("%s.media_type = ?", libraryTable), MediaTypeTVShow).
+		Where(fmt.Sprintf("%s.episode_number IS NOT NULL", historyTable)).
+		GroupBy(fmt.Sprintf("%s.library_id, %s.media_source, %s.source_id, %s.media_title, %s.thumbnail_url",
+			historyTable, libraryTable, libraryTable, libraryTable, libraryTable)).
+		OrderBy("last_watched_at desc").
+		Find(&shows)
+	if err != nil {
+		return nil, helpers.LogErrorWithMessage(err, "GetShowActivity(): Failed to get show activity")
+	}
+	for num := range shows {
+		err = databaseEngine.Table(historyTable).Where("user_id = ?", userID).
+			Where("library_id = ?", shows[num].LibraryID).Where("episode_number IS NOT NULL").
+			Find(&shows[num].WatchedEpisodes)
+		if err != nil {
+			return nil, helpers.LogErrorWithMessage(err, "GetShowActivity(): Failed to get watched episodes")
+		}
+	}
+	return shows, nil
+}
+
+// DeleteShowHistory removes every watch of a show, or of one season if seasonNumber is set.
+// Returns the number of deleted rows
+func DeleteShowHistory(userID int64, libraryID int64, seasonNumber *int) (int64, error) {
+	session := databaseEngine.NewSession()
+	defer session.Close()
+	_ = session.Begin()
+	sess := session.Table(historyTable).Where("user_id = ?", userID).Where("library_id = ?", libraryID)
+	if seasonNumber != nil {
+		sess = sess.Where("season_number = ?", *seasonNumber)
+	}
+	affected, err := sess.Delete(new(HistoryRecord))
+	if err != nil {
+		_ = session.Rollback()
+		return -1, helpers.LogErrorWithMessage(err, "DeleteShowHistory(): Failed to delete history")
+	}
+	err = session.Commit()
+	if err != nil {
+		_ = session.Rollback()
+		return -1, helpers.LogErrorWithMessage(errors.New(helpers.InternalServerError), "DeleteShowHistory(): error committing transaction")
+	}
+	return affected, nil
+}
+
+// GetWatchedLibraryIDs returns the distinct library ids the user has any history for
+func GetWatchedLibraryIDs(userID int64) ([]int64, error) {
+	var libraryIDs []int64
+	err := databaseEngine.Table(historyTable).Where("user_id = ?", userID).Distinct("library_id").Find(&libraryIDs)
+	if err != nil {
+		return nil, helpers.LogErrorWithMessage(err, "GetWatchedLibraryIDs(): Failed to get history")
+	}
+	return libraryIDs, nil
 }
@@ -0,0 +1,164 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hound/helpers"
+	"time"
+	"xorm.io/xorm"
+)
+
+/*
+	Media files - video files found under the configured library roots,
+	linked to library records once matched
+*/
+
+const (
+	mediaFilesTable = "media_files"
+	// parsed, no match found on the source
+	MediaFileStatusUnmatched = "unmatched"
+	// matched automatically from the file name
+	MediaFileStatusMatched = "matched"
+	// matched by an admin, kept on rescans
+	MediaFileStatusManual = "manual"
+)
+
+type MediaFile struct {
+	FileID        int64     `xorm:"pk autoincr 'file_id'" json:"file_id"`
+	Path          string    `xorm:"varchar(4096) not null" json:"path"`
+	PathHash      string    `xorm:"char(64) unique not null 'path_hash'" json:"-"` // sha256 of path, paths are too long to index
+	LibraryRoot   string    `xorm:"varchar(4096) not null" json:"library_root"`
+	Size          int64     `xorm:"not null" json:"size"`
+	ModTime       time.Time `xorm:"not null 'mod_time'" json:"mod_time"`
+	LibraryID     *int64    `xorm:"index 'library_id'" json:"library_id"` // null until matched
+	MediaType     string    `json:"media_type"`                           // movie or tvshow, parsed from the file name
+	ParsedTitle   string    `json:"parsed_title"`
+	ParsedYear    *int      `json:"parsed_year"`
+	SeasonNumber  *int      `json:"season_number"`
+	EpisodeNumber *int      `json:"episode_number"`
+	MatchStatus   string    `xorm:"not null index" json:"match_status"`
+	CreatedAt     time.Time `xorm:"created" json:"created_at"`
+	UpdatedAt     time.Time `xorm:"updated" json:"updated_at"`
+}
+
+// MediaFileQuery filters media files, nil fields are ignored
+type MediaFileQuery struct {
+	MatchStatus  *string
+	LibraryID    *int64
+	SeasonNumber *int
+}
+
+func instantiateMediaFilesTable() error {
+	err := databaseEngine.Table(mediaFilesTable).Sync2(new(MediaFile))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func HashMediaPath(path string) string {
+	hash := sha256.Sum256([]byte(path))
+	return hex.EncodeToString(hash[:])
+}
+
+// GetAllMediaFiles returns every known file, used by scans to find changed and removed files
+func GetAllMediaFiles() ([]MediaFile, error) {
+	var files []MediaFile
+	err := databaseEngine.Table(mediaFilesTable).Find(&files)
+	if err != nil {
+		return nil, helpers.LogErrorWithMessage(err, "GetAllMediaFiles(): Failed to get media files")
+	}
+	return files, nil
+}
+
+func GetMediaFile(fileID int64) (*MediaFile, error) {
+	var file MediaFile
+	found, err := databaseEngine.Table(mediaFilesTable).ID(fileID).Get(&file)
+	if err != nil {
+		return nil, helpers.LogErrorWithMessage(err, "GetMediaFile(): Failed to get media file")
+	}
+	if !found {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "GetMediaFile(): No media file with this id")
+	}
+	return &file, nil
+}
+
+// GetMediaFiles lists media files by path
+func GetMediaFiles(query MediaFileQuery, limit int, offset int) ([]MediaFile, int64, error) {
+	var files []MediaFile
+	sess := mediaFileQuerySession(query).OrderBy("path asc")
+	if limit > 0 && offset >= 0 {
+		sess = sess.Limit(limit, offset)
+	}
+	err := sess.Find(&files)
+	if err != nil {
+		return nil, -1, helpers.LogErrorWithMessage(err, "GetMediaFiles(): Failed to get media files")
+	}
+	totalRecords, err := mediaFileQuerySession(query).Count(new(MediaFile))
+	if err != nil {
+		return nil, -1, helpers.LogErrorWithMessage(err, "GetMediaFiles(): Failed to count media files")
+	}
+	return files, totalRecords, nil
+}
+
+func mediaFileQuerySession(query MediaFileQuery) *xorm.Session {
+	sess := databaseEngine.Table(mediaFilesTable)
+	if query.MatchStatus != nil {
+		sess = sess.Where("match_status = ?", *query.MatchStatus)
+	}
+	if query.LibraryID != nil {
+		sess = sess.Where("library_id = ?", *query.LibraryID)
+	}
+	if query.SeasonNumber != nil {
+		sess = sess.Where("season_number = ?", *query.SeasonNumber)
+	}
+	return sess
+}
+
+// UpsertMediaFile inserts a new file or overwrites a known one, matched on path
+func UpsertMediaFile(file *MediaFile) error {
+	file.PathHash = HashMediaPath(file.Path)
+	if file.FileID == 0 {
+		_, err := databaseEngine.Table(mediaFilesTable).Insert(file)
+		if err != nil {
+			return helpers.LogErrorWithMessage(err, "UpsertMediaFile(): Failed to insert media file")
+		}
+		return nil
+	}
+	_, err := databaseEngine.Table(mediaFilesTable).ID(file.FileID).AllCols().Omit("file_id", "created_at").
+		Nullable("library_id", "parsed_year", "season_number", "episode_number").Update(file)
+	if err != nil {
+		return helpers.LogErrorWithMessage(err, "UpsertMediaFile(): Failed to update media file")
+	}
+	return nil
+}
+
+// SetMediaFileMatch links a file to a library record, for tv shows season and episode are required
+func SetMediaFileMatch(fileID int64, libraryID int64, mediaType string, seasonNumber *int, episodeNumber *int, status string) error {
+	_, err := databaseEngine.Table(mediaFilesTable).ID(fileID).
+		Cols("library_id", "media_type", "season_number", "episode_number", "match_status").
+		Nullable("season_number", "episode_number").Update(&MediaFile{
+		LibraryID:     &libraryID,
+		MediaType:     mediaType,
+		SeasonNumber:  seasonNumber,
+		EpisodeNumber: episodeNumber,
+		MatchStatus:   status,
+	})
+	if err != nil {
+		return helpers.LogErrorWithMessage(err, "SetMediaFileMatch(): Failed to update media file")
+	}
+	return nil
+}
+
+// DeleteMediaFiles removes files that are no longer on disk
+func DeleteMediaFiles(fileIDs []int64) error {
+	if len(fileIDs) == 0 {
+		return nil
+	}
+	_, err := databaseEngine.Table(mediaFilesTable).In("file_id", fileIDs).Delete(new(MediaFile))
+	if err != nil {
+		return helpers.LogErrorWithMessage(err, "DeleteMediaFiles(): Failed to delete media files")
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package database
+
+import (
+	"errors"
+	"hound/helpers"
+	"time"
+)
+
+/*
+	Collection members - users a collection is shared with. The collection's OwnerID
+	always has the owner role, other members are invited and must accept first
+		viewer - can view the collection, even if private
+		editor - can also add, remove and reorder items
+		owner - can also edit collection metadata and manage members. Only the collection's
+			OwnerID can grant, change or revoke the owner role
+*/
+
+const (
+	collectionMembersTable = "collection_members"
+	CollectionRoleViewer   = "viewer"
+	CollectionRoleEditor   = "editor"
+	CollectionRoleOwner    = "owner"
+)
+
+var collectionRoleRanks = map[string]int{
+	CollectionRoleViewer: 1,
+	CollectionRoleEditor: 2,
+	CollectionRoleOwner:  3,
+}
+
+type CollectionMember struct {
+	CollectionID int64     `xorm:"unique(primary) not null 'collection_id'" json:"collection_id"`
+	UserID       int64     `xorm:"unique(primary) not null index 'user_id'" json:"user_id"`
+	Role         string    `xorm:"not null" json:"role"`
+	InvitedBy    int64     `xorm:"'invited_by'" json:"invited_by"`
+	IsAccepted   bool      `xorm:"not null default false" json:"is_accepted"`
+	CreatedAt    time.Time `xorm:"created" json:"created_at"`
+	UpdatedAt    time.Time `xorm:"updated" json:"updated_at"`
+}
+
+func instantiateMembersTable() error {
+	err := databaseEngine.Table(collectionMembersTable).Sync2(new(CollectionMember))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func IsValidCollectionRole(role string) bool {
+	_, ok := collectionRoleRanks[role]
+	return ok
+}
+
+// GetCollectionRole returns the user's role in the collection, empty if the user is not an accepted member
+func GetCollectionRole(userID int64, collection *CollectionRecord) (string, error) {
+	if collection.OwnerID == userID {
+		return CollectionRoleOwner, nil
+	}
+	var member CollectionMember
+	found, err := databaseEngine.Table(collectionMembersTable).Where("collection_id = ?", collection.CollectionID).
+		Where("user_id = ?", userID).Where("is_accepted = ?", true).Get(&member)
+	if err != nil {
+		return "", helpers.LogErrorWithMessage(err, "GetCollectionRole(): Failed to get collection member")
+	}
+	if !found {
+		return "", nil
+	}
+	return member.Role, nil
+}
+
+// checkCollectionRole errors if the user's role is lower than minRole. Public collections can be viewed by anyone
+func checkCollectionRole(userID int64, collection *CollectionRecord, minRole string) error {
+	if minRole == CollectionRoleViewer && collection.IsPublic {
+		return nil
+	}
+	role, err := GetCollectionRole(userID, collection)
+	if err != nil {
+		return err
+	}
+	if collectionRoleRanks[role] < collectionRoleRanks[minRole] {
+		return helpers.LogErrorWithMessage(errors.New(helpers.Forbidden), "Collection - insufficient role, unauthorized")
+	}
+	return nil
+}
+
+// getCollectionWithRole loads a collection and checks the user has at least minRole
+func getCollectionWithRole(userID int64, collectionID int64, minRole string) (*CollectionRecord, error) {
+	var collectionRecord CollectionRecord
+	has, err := databaseEngine.Table(collectionsTable).ID(collectionID).Get(&collectionRecord)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Collection not found")
+	}
+	err = checkCollectionRole(userID, &collectionRecord, minRole)
+	if err != nil {
+		return nil, err
+	}
+	return &collectionRecord, nil
+}
+
+// InviteCollectionMember invites a user with a role, inviting an existing member changes their role.
+// Requires the owner role, granting or changing the owner role requires owning the collection
+func InviteCollectionMember(userID int64, collectionID int64, inviteeID int64, role string) error {
+	if !IsValidCollectionRole(role) {
+		return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "InviteCollectionMember(): Invalid role")
+	}
+	collection, err := getCollectionWithRole(userID, collectionID, CollectionRoleOwner)
+	if err != nil {
+		return err
+	}
+	if collection.OwnerID == inviteeID {
+		return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "InviteCollectionMember(): User already owns collection")
+	}
+	var member CollectionMember
+	found, err := databaseEngine.Table(collectionMembersTable).Where("collection_id = ?", collectionID).
+		Where("user_id = ?", inviteeID).Get(&member)
+	if err != nil {
+		return helpers.LogErrorWithMessage(err, "InviteCollectionMember(): Failed to get collection member")
+	}
+	if (role == CollectionRoleOwner || found && member.Role == CollectionRoleOwner) && collection.OwnerID != userID {
+		return helpers.LogErrorWithMessage(errors.New(helpers.Forbidden), "InviteCollectionMember(): Only the collection owner can manage owners")
+	}
+	if found {
+		_, err = databaseEngine.Table(collectionMembersTable).Where("collection_id = ?", collectionID).
+			Where("user_id = ?", inviteeID).Cols("role").Update(&CollectionMember{Role: role})
+		if err != nil {
+			return helpers.LogErrorWithMessage(err, "InviteCollectionMember(): Failed to update role")
+		}
+		return nil
+	}
+	_, err = databaseEngine.Table(collectionMembersTable).Insert(&CollectionMember{
+		CollectionID: collectionID,
+		UserID:       inviteeID,
+		Role:         role,
+		InvitedBy:    userID,
+	})
+	if err != nil {
+		return helpers.LogErrorWithMessage(err, "InviteCollectionMember(): Failed to insert collection member")
+	}
+	return nil
+}
+
+// AcceptCollectionInvite accepts a pending invite of the user
+func AcceptCollectionInvite(userID int64, collectionID int64) error {
+	var member CollectionMember
+	found, err := databaseEngine.Table(collectionMembersTable).Where("collection_id = ?", collectionID).
+		Where("user_id = ?", userID).Get(&member)
+	if err != nil {
+		return helpers.LogErrorWithMessage(err, "AcceptCollectionInvite(): Failed to get invite")
+	}
+	if !found || member.IsAccepted {
+		return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "AcceptCollectionInvite(): No pending invite for this collection")
+	}
+	_, err = databaseEngine.Table(collectionMembersTable).Where("collection_id = ?", collectionID).
+		Where("user_id = ?", userID).Cols("is_accepted").Update(&CollectionMember{IsAccepted: true})
+	if err != nil {
+		return helpers.LogErrorWithMessage(err, "AcceptCollectionInvite(): Failed to accept invite")
+	}
+	return nil
+}
+
+// RemoveCollectionMember removes a member or invite. Members can remove themselves (leave, decline),
+// removing others requires the owner role, removing owners requires owning the collection
+func RemoveCollectionMember(userID int64, collectionID int64, memberID int64) error {
+	if userID != memberID {
+		collection, err := getCollectionWithRole(userID, collectionID, CollectionRoleOwner)
+		if err != nil {
+			return err
+		}
+		var member CollectionMember
+		found, err := databaseEngine.Table(collectionMembersTable).Where("collection_id = ?", collectionID).
+			Where("user_id = ?", memberID).Get(&member)
+		if err != nil {
+			return helpers.LogErrorWithMessage(err, "RemoveCollectionMember(): Failed to get collection member")
+		}
+		if found && member.Role == CollectionRoleOwner && collection.OwnerID != userID {
+			return helpers.LogErrorWithMessage(errors.New(helpers.Forbidden), "RemoveCollectionMember(): Only the collection owner can remove owners")
+		}
+	}
+	affected, err := databaseEngine.Table(collectionMembersTable).Delete(&CollectionMember{
+		CollectionID: collectionID,
+		UserID:       memberID,
+	})
+	if err != nil {
+		return helpers.LogErrorWithMessage(err, "RemoveCollectionMember(): Failed to remove member")
+	}
+	if affected <= 0 {
+		return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "RemoveCollectionMember(): User is not a member")
+	}
+	return nil
+}
+
+// GetCollectionMembers lists members of a collection, requires an accepted membership or owning it,
+// public collections aren't enough. Pending invites are only listed to the owner role
+func GetCollectionMembers(userID int64, collectionID int64) ([]CollectionMember, error) {
+	var collection CollectionRecord
+	has, err := databaseEngine.Table(collectionsTable).ID(collectionID).Get(&collection)
+	if err != nil {
+		return nil, helpers.LogErrorWithMessage(err, "GetCollectionMembers(): Failed to get collection")
+	}
+	if !has {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Collection not found")
+	}
+	role, err := GetCollectionRole(userID, &collection)
+	if err != nil {
+		return nil, err
+	}
+	if role == "" {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.Forbidden), "GetCollectionMembers(): Not a member of this collection")
+	}
+	var members []CollectionMember
+	sess := databaseEngine.Table(collectionMembersTable).Where("collection_id = ?", collectionID)
+	if role != CollectionRoleOwner {
+		sess = sess.Where("is_accepted = ?", true)
+	}
+	err = sess.OrderBy("created_at asc").Find(&members)
+	if err != nil {
+		return nil, helpers.LogErrorWithMessage(err, "GetCollectionMembers(): Failed to get members")
+	}
+	return members, nil
+}
+
+// GetPendingCollectionInvites lists invites the user hasn't accepted yet
+func GetPendingCollectionInvites(userID int64) ([]CollectionMember, error) {
+	var invites []CollectionMember
+	err := databaseEngine.Table(collectionMembersTable).Where("user_id = ?", userID).
+		Where("is_accepted = ?", false).OrderBy("created_at desc").Find(&invites)
+	if err != nil {
+		return nil, helpers.LogErrorWithMessage(err, "GetPendingCollectionInvites(): Failed to get invites")
+	}
+	return invites, nil
+}
@@ -0,0 +1,150 @@
+package database
+
+import (
+	"errors"
+	"hound/helpers"
+	"time"
+	"xorm.io/xorm"
+)
+
+/*
+	Organizer operations - log of files the download organizer copied, linked or moved
+	out of the inbox, kept so operations can be undone and files aren't organized twice
+*/
+
+const (
+	organizerOperationsTable = "organizer_operations"
+	// file was copied, linked or moved to its destination
+	OrganizerStatusDone = "done"
+	// destination existed and organizer.conflict is skip
+	OrganizerStatusSkipped = "skipped"
+	// no tmdb match for the file name
+	OrganizerStatusUnmatched = "unmatched"
+	// done, then reverted
+	OrganizerStatusUndone = "undone"
+)
+
+type OrganizerOperation struct {
+	OperationID     int64      `xorm:"pk autoincr 'operation_id'" json:"operation_id"`
+	SourcePath      string     `xorm:"varchar(4096) not null" json:"source_path"`
+	SourcePathHash  string     `xorm:"char(64) not null index 'source_path_hash'" json:"-"`
+	SourceSize      int64      `xorm:"not null" json:"source_size"`
+	SourceModTime   time.Time  `xorm:"not null 'source_mod_time'" json:"source_mod_time"` // second precision
+	DestinationRoot string     `xorm:"varchar(4096)" json:"destination_root"`
+	DestinationPath string     `xorm:"varchar(4096)" json:"destination_path"`
+	BackupPath      string     `xorm:"varchar(4096)" json:"backup_path"` // replaced destination, restored on undo
+	Mode            string     `xorm:"not null" json:"mode"`             // copy, hardlink or move
+	Status          string     `xorm:"not null index" json:"status"`
+	Message         string     `xorm:"text" json:"message"`
+	LibraryID       *int64     `xorm:"'library_id'" json:"library_id"`
+	MediaType       string     `json:"media_type"`
+	SeasonNumber    *int       `json:"season_number"`
+	EpisodeNumber   *int       `json:"episode_number"`
+	UndoneAt        *time.Time `json:"undone_at"`
+	CreatedAt       time.Time  `xorm:"created" json:"created_at"`
+	UpdatedAt       time.Time  `xorm:"updated" json:"updated_at"`
+}
+
+// OrganizerOperationQuery filters the operation log, nil fields are ignored
+type OrganizerOperationQuery struct {
+	Status *string
+}
+
+func instantiateOrganizerOperationsTable() error {
+	err := databaseEngine.Table(organizerOperationsTable).Sync2(new(OrganizerOperation))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func AddOrganizerOperation(operation *OrganizerOperation) error {
+	operation.SourcePathHash = HashMediaPath(operation.SourcePath)
+	// DATETIME columns don't store fractional seconds
+	operation.SourceModTime = operation.SourceModTime.Truncate(time.Second)
+	_, err := databaseEngine.Table(organizerOperationsTable).Insert(operation)
+	if err != nil {
+		return helpers.LogErrorWithMessage(err, "AddOrganizerOperation(): Failed to insert organizer operation")
+	}
+	return nil
+}
+
+// IsOrganizerFileHandled checks whether this version of an inbox file is in the log.
+// Failed operations aren't logged, so they are retried
+func IsOrganizerFileHandled(sourcePath string, size int64, modTime time.Time) (bool, error) {
+	var operations []OrganizerOperation
+	err := databaseEngine.Table(organizerOperationsTable).
+		Where("source_path_hash = ?", HashMediaPath(sourcePath)).
+		Where("source_size = ?", size).
+		Cols("source_mod_time").Find(&operations)
+	if err != nil {
+		return false, helpers.LogErrorWithMessage(err, "IsOrganizerFileHandled(): Failed to check organizer operations")
+	}
+	// compared here, a time in the where clause keeps its fractional seconds and is sent in the driver's time zone
+	for _, operation := range operations {
+		if operation.SourceModTime.Equal(modTime.Truncate(time.Second)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func GetOrganizerOperation(operationID int64) (*OrganizerOperation, error) {
+	var operation OrganizerOperation
+	found, err := databaseEngine.Table(organizerOperationsTable).ID(operationID).Get(&operation)
+	if err != nil {
+		return nil, helpers.LogErrorWithMessage(err, "GetOrganizerOperation(): Failed to get organizer operation")
+	}
+	if !found {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "GetOrganizerOperation(): No organizer operation with this id")
+	}
+	return &operation, nil
+}
+
+// GetOrganizerOperations lists the operation log, newest first
+func GetOrganizerOperations(query OrganizerOperationQuery, limit int, offset int) ([]OrganizerOperation, int64, error) {
+	var operations []OrganizerOperation
+	sess := organizerOperationQuerySession(query).OrderBy("operation_id desc")
+	if limit > 0 && offset >= 0 {
+		sess = sess.Limit(limit, offset)
+	}
+	err := sess.Find(&operations)
+	if err != nil {
+		return nil, -1, helpers.LogErrorWithMessage(err, "GetOrganizerOperations(): Failed to get organizer operations")
+	}
+	totalRecords, err := organizerOperationQuerySession(query).Count(new(OrganizerOperation))
+	if err != nil {
+		return nil, -1, helpers.LogErrorWithMessage(err, "GetOrganizerOperations(): Failed to count organizer operations")
+	}
+	return operations, totalRecords, nil
+}
+
+func organizerOperationQuerySession(query OrganizerOperationQuery) *xorm.Session {
+	sess := databaseEngine.Table(organizerOperationsTable)
+	if query.Status != nil {
+		sess = sess.Where("status = ?", *query.Status)
+	}
+	return sess
+}
+
+func SetOrganizerOperationUndone(operationID int64) error {
+	now := time.Now()
+	_, err := databaseEngine.Table(organizerOperationsTable).ID(operationID).
+		Cols("status", "undone_at").Update(&OrganizerOperation{
+		Status:   OrganizerStatusUndone,
+		UndoneAt: &now,
+	})
+	if err != nil {
+		return helpers.LogErrorWithMessage(err, "SetOrganizerOperationUndone(): Failed to update organizer operation")
+	}
+	return nil
+}
+
+// DeleteOrganizerOperation removes an operation from the log, the files aren't touched
+func DeleteOrganizerOperation(operationID int64) error {
+	_, err := databaseEngine.Table(organizerOperationsTable).ID(operationID).Delete(new(OrganizerOperation))
+	if err != nil {
+		return helpers.LogErrorWithMessage(err, "DeleteOrganizerOperation(): Failed to delete organizer operation")
+	}
+	return nil
+}
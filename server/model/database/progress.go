@@ -0,0 +1,162 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"hound/helpers"
+	"time"
+	"xorm.io/xorm"
+)
+
+const (
+	// playback position of movies and episodes the user started but hasn't finished,
+	// one row per user and item, removed once the watch is recorded in history
+	progressTable = "playback_progress"
+)
+
+type ProgressRecord struct {
+	ProgressID    int64     `xorm:"pk autoincr 'progress_id'" json:"id"`
+	UserID        int64     `xorm:"not null index 'user_id'" json:"user_id"`
+	LibraryID     int64     `xorm:"not null index 'library_id'" json:"library_id"`
+	SeasonNumber  *int      `json:"season_number"`            // null for movies
+	EpisodeNumber *int      `json:"episode_number"`           // null for movies
+	Position      int       `xorm:"not null" json:"position"` // seconds
+	Duration      int       `xorm:"not null" json:"duration"` // seconds
+	CreatedAt     time.Time `xorm:"created" json:"created_at"`
+	UpdatedAt     time.Time `xorm:"updated index" json:"updated_at"`
+}
+
+// ProgressGroup is a progress record joined with its library record
+type ProgressGroup struct {
+	ProgressRecord `xorm:"extends"`
+	MediaType      string  `json:"media_type"`
+	MediaSource    string  `json:"media_source"`
+	SourceID       string  `xorm:"'source_id'" json:"source_id"`
+	MediaTitle     string  `json:"media_title"`
+	ThumbnailURL   *string `xorm:"'thumbnail_url'" json:"thumbnail_url"`
+}
+
+// ProgressQuery filters progress, nil fields are ignored
+type ProgressQuery struct {
+	UserID       int64
+	LibraryID    *int64
+	SeasonNumber *int
+}
+
+func instantiateProgressTable() error {
+	err := databaseEngine.Table(progressTable).Sync2(new(ProgressRecord))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SetProgress stores the position of a movie or episode, replacing the previous one.
+// The user's row is locked so concurrent reports, eg. a stream and a webhook, can't both insert
+func SetProgress(record ProgressRecord) error {
+	session := databaseEngine.NewSession()
+	defer session.Close()
+	_ = session.Begin()
+	_, err := session.Table(usersTable).ID(record.UserID).ForUpdate().Get(new(UserXorm))
+	if err != nil {
+		_ = session.Rollback()
+		return helpers.LogErrorWithMessage(err, "SetProgress(): Failed to lock user")
+	}
+	var existing ProgressRecord
+	found, err := whereEpisode(session.Table(progressTable).
+		Where("user_id = ?", record.UserID).
+		Where("library_id = ?", record.LibraryID),
+		record.SeasonNumber, record.EpisodeNumber).Get(&existing)
+	if err != nil {
+		_ = session.Rollback()
+		return helpers.LogErrorWithMessage(err, "SetProgress(): Failed to get progress")
+	}
+	if found {
+		_, err = session.Table(progressTable).ID(existing.ProgressID).
+			Cols("position", "duration").Update(&record)
+	} else {
+		_, err = session.Table(progressTable).Insert(&record)
+	}
+	if err != nil {
+		_ = session.Rollback()
+		return helpers.LogErrorWithMessage(err, "SetProgress(): Failed to save progress")
+	}
+	err = session.Commit()
+	if err != nil {
+		_ = session.Rollback()
+		return helpers.LogErrorWithMessage(errors.New(helpers.InternalServerError), "SetProgress(): error committing transaction")
+	}
+	return nil
+}
+
+// CompleteProgress removes the progress of a finished item and records the watch, in one transaction
+func CompleteProgress(record HistoryRecord) error {
+	session := databaseEngine.NewSession()
+	defer session.Close()
+	_ = session.Begin()
+	_, err := whereEpisode(session.Table(progressTable).
+		Where("user_id = ?", record.UserID).
+		Where("library_id = ?", record.LibraryID),
+		record.SeasonNumber, record.EpisodeNumber).Delete(new(ProgressRecord))
+	if err != nil {
+		_ = session.Rollback()
+		return helpers.LogErrorWithMessage(err, "CompleteProgress(): Failed to delete progress")
+	}
+	err = addHistoryRecordsSession(session, []HistoryRecord{record})
+	if err != nil {
+		_ = session.Rollback()
+		return err
+	}
+	err = session.Commit()
+	if err != nil {
+		_ = session.Rollback()
+		return helpers.LogErrorWithMessage(errors.New(helpers.InternalServerError), "CompleteProgress(): error committing transaction")
+	}
+	return nil
+}
+
+// GetProgress lists in-progress items, most recently played first
+func GetProgress(query ProgressQuery, limit int, offset int) ([]ProgressGroup, int64, error) {
+	var records []ProgressGroup
+	sess := progressQuerySession(query).
+		Select(fmt.Sprintf("%s.*, %s.media_type, %s.media_source, %s.source_id, %s.media_title, %s.thumbnail_url",
+			progressTable, libraryTable, libraryTable, libraryTable, libraryTable, libraryTable)).
+		OrderBy(fmt.Sprintf("%s.updated_at desc, %s.progress_id desc", progressTable, progressTable))
+	if limit > 0 && offset >= 0 {
+		sess = sess.Limit(limit, offset)
+	}
+	err := sess.Find(&records)
+	if err != nil {
+		return nil, -1, helpers.LogErrorWithMessage(err, "GetProgress(): Failed to get progress")
+	}
+	totalRecords, err := progressQuerySession(query).Count(new(ProgressRecord))
+	if err != nil {
+		return nil, -1, helpers.LogErrorWithMessage(err, "GetProgress(): Failed to count progress")
+	}
+	return records, totalRecords, nil
+}
+
+func progressQuerySession(query ProgressQuery) *xorm.Session {
+	sess := databaseEngine.Table(progressTable).
+		Join("INNER", libraryTable, fmt.Sprintf("%s.library_id = %s.library_id", progressTable, libraryTable)).
+		Where(fmt.Sprintf("%s.user_id = ?", progressTable), query.UserID)
+	if query.LibraryID != nil {
+		sess = sess.Where(fmt.Sprintf("%s.library_id = ?", progressTable), *query.LibraryID)
+	}
+	if query.SeasonNumber != nil {
+		sess = sess.Where(fmt.Sprintf("%s.season_number = ?", progressTable), *query.SeasonNumber)
+	}
+	return sess
+}
+
+// DeleteProgress removes an item from continue watching, the id must belong to userID
+func DeleteProgress(userID int64, progressID int64) error {
+	affected, err := databaseEngine.Table(progressTable).Delete(&ProgressRecord{UserID: userID, ProgressID: progressID})
+	if err != nil {
+		return helpers.LogErrorWithMessage(err, "DeleteProgress(): Failed to delete progress")
+	}
+	if affected <= 0 {
+		return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "DeleteProgress(): No progress found with this ID or invalid user")
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hound/helpers"
+	"strconv"
+	"xorm.io/xorm"
+)
+
+/*
+	Smart collections - collections with rules instead of collection_relations rows.
+	Items are the owner's library records matching all rules, evaluated at query time against
+	the collection owner's reviews, history and library
+*/
+
+// CollectionRules are the rules of a smart collection, nil fields are ignored
+type CollectionRules struct {
+	MediaType      *string  `json:"media_type,omitempty"`       // tvshow, movie, game
+	Genres         []string `json:"genres,omitempty"`           // tag names, item must have every genre
+	ReleaseYearMin *int     `json:"release_year_min,omitempty"` // inclusive
+	ReleaseYearMax *int     `json:"release_year_max,omitempty"` // inclusive
+	ScoreMin       *int     `json:"score_min,omitempty"`        // owner's review score, 0-100
+	ScoreMax       *int     `json:"score_max,omitempty"`
+	Watched        *bool    `json:"watched,omitempty"`    // owner has any history for the item
+	InLibrary      *bool    `json:"in_library,omitempty"` // item is in the owner's primary collection
+	// tv shows: owner watched as many episodes as the show has (specials excluded),
+	// movies and games: same as watched
+	Finished *bool `json:"finished,omitempty"`
+}
+
+// ValidateCollectionRules checks rule values are in range
+func ValidateCollectionRules(rules *CollectionRules) error {
+	if rules.MediaType != nil && *rules.MediaType != MediaTypeTVShow && *rules.MediaType != MediaTypeMovie &&
+		*rules.MediaType != MediaTypeGame {
+		return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid rule media_type")
+	}
+	if rules.ScoreMin != nil && (*rules.ScoreMin < 0 || *rules.ScoreMin > 100) ||
+		rules.ScoreMax != nil && (*rules.ScoreMax < 0 || *rules.ScoreMax > 100) {
+		return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Rule score must be between 0 and 100")
+	}
+	if rules.ScoreMin != nil && rules.ScoreMax != nil && *rules.ScoreMin > *rules.ScoreMax {
+		return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Rule score_min is greater than score_max")
+	}
+	if rules.ReleaseYearMin != nil && rules.ReleaseYearMax != nil && *rules.ReleaseYearMin > *rules.ReleaseYearMax {
+		return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Rule release_year_min is greater than release_year_max")
+	}
+	return nil
+}
+
+// getSmartCollectionRecords returns library records matching the collection's rules, ordered by title
+func getSmartCollectionRecords(collection *CollectionRecord, limit int, offset int) ([]LibraryGroup, int64, error) {
+	var libraryGroups []LibraryGroup
+	sess := smartCollectionSession(collection).
+		OrderBy(fmt.Sprintf("%s.media_title asc, %s.library_id asc", libraryTable, libraryTable))
+	if limit > 0 && offset >= 0 {
+		sess = sess.Limit(limit, offset)
+	}
+	err := sess.Find(&libraryGroups)
+	if err != nil {
+		return nil, -1, helpers.LogErrorWithMessage(err, "getSmartCollectionRecords(): Failed to evaluate rules")
+	}
+	totalRecords, err := smartCollectionSession(collection).Count(new(LibraryRecord))
+	if err != nil {
+		return nil, -1, helpers.LogErrorWithMessage(err, "getSmartCollectionRecords(): Failed to count records")
+	}
+	for num := range libraryGroups {
+		libraryGroups[num].UserID = collection.OwnerID
+		libraryGroups[num].CollectionID = collection.CollectionID
+	}
+	return libraryGroups, totalRecords, nil
+}
+
+func smartCollectionSession(collection *CollectionRecord) *xorm.Session {
+	rules := collection.Rules
+	ownerID := collection.OwnerID
+	// the library table is shared by every user, only the owner's items are candidates:
+	// items in the owner's collections, in their history, or they commented on
+	sess := databaseEngine.Table(libraryTable).
+		Where(fmt.Sprintf("(EXISTS (SELECT 1 FROM %s INNER JOIN %s ON %s.collection_id = %s.collection_id WHERE %s.library_id = %s.library_id AND %s.owner_user_id = ?) "+
+			"OR EXISTS (SELECT 1 FROM %s WHERE %s.library_id = %s.library_id AND %s.user_id = ?) "+
+			"OR EXISTS (SELECT 1 FROM %s WHERE %s.library_id = %s.library_id AND %s.user_id = ?))",
+			collectionRelationsTable, collectionsTable, collectionRelationsTable, collectionsTable, collectionRelationsTable, libraryTable, collectionsTable,
+			historyTable, historyTable, libraryTable, historyTable,
+			commentsTable, commentsTable, libraryTable, commentsTable), ownerID, ownerID, ownerID)
+	if rules.MediaType != nil {
+		sess = sess.Where(fmt.Sprintf("%s.media_type = ?", libraryTable), *rules.MediaType)
+	}
+	// tags are stored as json, match on the serialized tag name
+	for _, genre := range rules.Genres {
+		genreJson, err := json.Marshal(genre)
+		if err != nil {
+			continue
+		}
+		sess = sess.Where(fmt.Sprintf("%s.tags LIKE ?", libraryTable),
+			"%\"TagName\":"+escapeLike(string(genreJson))+"%")
+	}
+	// release dates are YYYY-MM-DD
+	if rules.ReleaseYearMin != nil {
+		sess = sess.Where(fmt.Sprintf("%s.release_date >= ?", libraryTable), strconv.Itoa(*rules.ReleaseYearMin))
+	}
+	if rules.ReleaseYearMax != nil {
+		sess = sess.Where(fmt.Sprintf("%s.release_date != ''", libraryTable)).
+			Where(fmt.Sprintf("%s.release_date < ?", libraryTable), strconv.Itoa(*rules.ReleaseYearMax+1))
+	}
+	if rules.ScoreMin != nil || rules.ScoreMax != nil {
+		scoreMin, scoreMax := 0, 100
+		if rules.ScoreMin != nil {
+			scoreMin = *rules.ScoreMin
+		}
+		if rules.ScoreMax != nil {
+			scoreMax = *rules.ScoreMax
+		}
+		sess = sess.Where(fmt.Sprintf("EXISTS (SELECT 1 FROM %s WHERE %s.library_id = %s.library_id AND %s.user_id = ? AND %s.comment_type = ? AND %s.score BETWEEN ? AND ?)",
+			commentsTable, commentsTable, libraryTable, commentsTable, commentsTable, commentsTable),
+			ownerID, commentTypeReview, scoreMin, scoreMax)
+	}
+	if rules.Watched != nil {
+		sess = sess.Where(fmt.Sprintf("%s EXISTS (SELECT 1 FROM %s WHERE %s.library_id = %s.library_id AND %s.user_id = ?)",
+			notPrefix(*rules.Watched), historyTable, historyTable, libraryTable, historyTable), ownerID)
+	}
+	if rules.InLibrary != nil {
+		sess = sess.Where(fmt.Sprintf("%s EXISTS (SELECT 1 FROM %s INNER JOIN %s ON %s.collection_id = %s.collection_id WHERE %s.library_id = %s.library_id AND %s.owner_user_id = ? AND %s.is_primary = ?)",
+			notPrefix(*rules.InLibrary), collectionRelationsTable, collectionsTable, collectionRelationsTable, collectionsTable,
+			collectionRelationsTable, libraryTable, collectionsTable, collectionsTable), ownerID, true)
+	}
+	if rules.Finished != nil {
+		// distinct non-special episodes watched compared to the episode count in the source data,
+		// movies and games are finished once watched
+		finished := fmt.Sprintf("(CASE WHEN %s.media_type = ? THEN "+
+			"(SELECT COUNT(DISTINCT %s.season_number, %s.episode_number) FROM %s WHERE %s.library_id = %s.library_id AND %s.user_id = ? AND %s.season_number > 0) "+
+			">= CAST(JSON_UNQUOTE(JSON_EXTRACT(CONVERT(%s.full_data USING utf8mb4), '$.number_of_episodes')) AS UNSIGNED) "+
+			"ELSE EXISTS (SELECT 1 FROM %s WHERE %s.library_id = %s.library_id AND %s.user_id = ?) END)",
+			libraryTable, historyTable, historyTable, historyTable, historyTable, libraryTable, historyTable, historyTable,
+			libraryTable, historyTable, historyTable, libraryTable, historyTable)
+		if *rules.Finished {
+			sess = sess.Where(finished, MediaTypeTVShow, ownerID, ownerID)
+		} else {
+			sess = sess.Where("NOT "+finished, MediaTypeTVShow, ownerID, ownerID)
+		}
+	}
+	return sess
+}
+
+func notPrefix(value bool) string {
+	if value {
+		return ""
+	}
+	return "NOT"
+}
@@ -0,0 +1,108 @@
+package database
+
+import (
+	"errors"
+	"hound/helpers"
+	"time"
+)
+
+const refreshTokensTable = "refresh_tokens"
+
+// RefreshTokenRecord is a login session, one active session per user per client (X-Client).
+// access tokens carry the TokenID as their session id so revoking the row revokes them too
+type RefreshTokenRecord struct {
+	TokenID   int64     `xorm:"pk autoincr 'token_id'" json:"token_id"`
+	UserID    int64     `xorm:"not null index 'user_id'" json:"user_id"`
+	Client    string    `xorm:"not null" json:"client"`
+	TokenHash string    `xorm:"not null unique" json:"-"` // sha256 of the refresh token, raw token is never stored
+	ExpiresAt time.Time `json:"expires_at"`
+	IsRevoked bool      `xorm:"not null default false" json:"is_revoked"`
+	CreatedAt time.Time `xorm:"created" json:"created_at"`
+	UpdatedAt time.Time `xorm:"updated" json:"updated_at"`
+}
+
+func instantiateTokensTable() error {
+	err := databaseEngine.Table(refreshTokensTable).Sync2(new(RefreshTokenRecord))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func InsertRefreshToken(record *RefreshTokenRecord) error {
+	_, err := databaseEngine.Table(refreshTokensTable).Insert(record)
+	if err != nil {
+		return helpers.LogErrorWithMessage(err, "InsertRefreshToken(): Failed to insert refresh token")
+	}
+	return nil
+}
+
+func GetRefreshTokenByHash(tokenHash string) (*RefreshTokenRecord, error) {
+	var record RefreshTokenRecord
+	found, err := databaseEngine.Table(refreshTokensTable).Where("token_hash = ?", tokenHash).Get(&record)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.Unauthorized), "GetRefreshTokenByHash(): No matching refresh token")
+	}
+	return &record, nil
+}
+
+// IsSessionActive returns true if the session exists, is not revoked and has not expired
+func IsSessionActive(tokenID int64) (bool, error) {
+	var record RefreshTokenRecord
+	found, err := databaseEngine.Table(refreshTokensTable).ID(tokenID).Get(&record)
+	if err != nil {
+		return false, err
+	}
+	if !found {
+		return false, nil
+	}
+	return !record.IsRevoked && record.ExpiresAt.After(time.Now()), nil
+}
+
+// RevokeRefreshToken revokes a session, revoked is false if it was already revoked.
+// Only one of concurrent calls for the same token gets revoked = true
+func RevokeRefreshToken(tokenID int64) (bool, error) {
+	affected, err := databaseEngine.Table(refreshTokensTable).ID(tokenID).
+		Where("is_revoked = ?", false).Cols("is_revoked").
+		Update(&RefreshTokenRecord{IsRevoked: true})
+	if err != nil {
+		return false, helpers.LogErrorWithMessage(err, "RevokeRefreshToken(): Failed to revoke token")
+	}
+	return affected == 1, nil
+}
+
+// RevokeClientRefreshTokens revokes every active session of a user on a client
+func RevokeClientRefreshTokens(userID int64, client string) error {
+	_, err := databaseEngine.Table(refreshTokensTable).Where("user_id = ?", userID).
+		Where("client = ?", client).Where("is_revoked = ?", false).Cols("is_revoked").
+		Update(&RefreshTokenRecord{IsRevoked: true})
+	if err != nil {
+		return helpers.LogErrorWithMessage(err, "RevokeClientRefreshTokens(): Failed to revoke tokens")
+	}
+	return nil
+}
+
+// RevokeAllRefreshTokens logs a user out of every client
+func RevokeAllRefreshTokens(userID int64) error {
+	_, err := databaseEngine.Table(refreshTokensTable).Where("user_id = ?", userID).
+		Where("is_revoked = ?", false).Cols("is_revoked").
+		Update(&RefreshTokenRecord{IsRevoked: true})
+	if err != nil {
+		return helpers.LogErrorWithMessage(err, "RevokeAllRefreshTokens(): Failed to revoke tokens")
+	}
+	return nil
+}
+
+// RevokeOtherRefreshTokens logs a user out of every session except keepTokenID
+func RevokeOtherRefreshTokens(userID int64, keepTokenID int64) error {
+	_, err := databaseEngine.Table(refreshTokensTable).Where("user_id = ?", userID).
+		Where("token_id != ?", keepTokenID).Where("is_revoked = ?", false).Cols("is_revoked").
+		Update(&RefreshTokenRecord{IsRevoked: true})
+	if err != nil {
+		return helpers.LogErrorWithMessage(err, "RevokeOtherRefreshTokens(): Failed to revoke tokens")
+	}
+	return nil
+}
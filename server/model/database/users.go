@@ -3,15 +3,21 @@ package database
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"hound/helpers"
 	"time"
+	"xorm.io/xorm"
 )
 
 const usersTable = "users"
 
+// UserMeta stores profile settings, serialized to users.user_meta
 type UserMeta struct {
-	Test1 string
-	Test2 string
+	DisplayName       string `json:"display_name"`
+	AvatarURL         string `json:"avatar_url"`
+	PreferredLanguage string `json:"preferred_language"` // eg. en, en-US
+	PreferredRegion   string `json:"preferred_region"`   // ISO 3166-1 code, eg. US
+	Timezone          string `json:"timezone"`           // IANA name, eg. America/New_York
 }
 
 type User struct {
@@ -21,6 +27,8 @@ type User struct {
 	LastName       string
 	HashedPassword string
 	UserMeta       UserMeta
+	IsAdmin        bool
+	IsDisabled     bool
 	CreatedAt      time.Time
 	UpdatedAt      time.Time
 }
@@ -32,6 +40,8 @@ type UserXorm struct {
 	LastName       string
 	HashedPassword string
 	UserMeta       []byte
+	IsAdmin        bool      `xorm:"not null default false"`
+	IsDisabled     bool      `xorm:"not null default false"` // disabled users can't log in
 	CreatedAt      time.Time `xorm:"created"`
 	UpdatedAt      time.Time `xorm:"updated"`
 }
@@ -55,6 +65,7 @@ func InsertUser(user User) (*int64, error) {
 		LastName:       user.LastName,
 		HashedPassword: user.HashedPassword,
 		UserMeta:       userMetaBytes,
+		IsAdmin:        user.IsAdmin,
 	}
 	_, err = databaseEngine.Table(usersTable).Insert(&userXorm)
 	if err != nil {
@@ -72,8 +83,12 @@ func GetUser(username string) (*User, error) {
 	if err != nil {
 		return nil, err
 	}
+	return convertUserXorm(&userXorm)
+}
+
+func convertUserXorm(userXorm *UserXorm) (*User, error) {
 	var userMeta UserMeta
-	err = json.Unmarshal(userXorm.UserMeta, &userMeta)
+	err := json.Unmarshal(userXorm.UserMeta, &userMeta)
 	if err != nil {
 		return nil, err
 	}
@@ -84,6 +99,8 @@ func GetUser(username string) (*User, error) {
 		LastName:       userXorm.LastName,
 		HashedPassword: userXorm.HashedPassword,
 		UserMeta:       userMeta,
+		IsAdmin:        userXorm.IsAdmin,
+		IsDisabled:     userXorm.IsDisabled,
 		CreatedAt:      userXorm.CreatedAt,
 		UpdatedAt:      userXorm.UpdatedAt,
 	}
@@ -108,4 +125,229 @@ func GetUsernameFromID(userID int64) (string, error) {
 		return "", err
 	}
 	return userXorm.Username, nil
-}
\ No newline at end of file
+}
+
+func GetUserByID(userID int64) (*User, error) {
+	username, err := GetUsernameFromID(userID)
+	if err != nil {
+		return nil, err
+	}
+	return GetUser(username)
+}
+
+func UpdateUserProfile(userID int64, firstName string, lastName string, userMeta UserMeta) error {
+	userMetaBytes, err := json.Marshal(userMeta)
+	if err != nil {
+		return err
+	}
+	_, err = databaseEngine.Table(usersTable).ID(userID).Cols("first_name", "last_name", "user_meta").
+		Update(&UserXorm{
+			FirstName: firstName,
+			LastName:  lastName,
+			UserMeta:  userMetaBytes,
+		})
+	if err != nil {
+		return helpers.LogErrorWithMessage(err, "UpdateUserProfile(): Failed to update user")
+	}
+	return nil
+}
+
+func UpdateUserPassword(userID int64, hashedPassword string) error {
+	_, err := databaseEngine.Table(usersTable).ID(userID).Cols("hashed_password").
+		Update(&UserXorm{HashedPassword: hashedPassword})
+	if err != nil {
+		return helpers.LogErrorWithMessage(err, "UpdateUserPassword(): Failed to update password")
+	}
+	return nil
+}
+
+// DeleteUser removes a user and everything they own in one transaction
+func DeleteUser(userID int64) error {
+	session := databaseEngine.NewSession()
+	defer session.Close()
+	_ = session.Begin()
+	_, err := session.Table(commentsTable).Where("user_id = ?", userID).Delete(new(CommentRecord))
+	if err != nil {
+		_ = session.Rollback()
+		return helpers.LogErrorWithMessage(err, "DeleteUser(): Failed to delete comments")
+	}
+	_, err = session.Table(commentEditsTable).Where("user_id = ?", userID).Delete(new(CommentEditRecord))
+	if err != nil {
+		_ = session.Rollback()
+		return helpers.LogErrorWithMessage(err, "DeleteUser(): Failed to delete comment edits")
+	}
+	_, err = session.Table(historyTable).Where("user_id = ?", userID).Delete(new(HistoryRecord))
+	if err != nil {
+		_ = session.Rollback()
+		return helpers.LogErrorWithMessage(err, "DeleteUser(): Failed to delete history")
+	}
+	_, err = session.Table(progressTable).Where("user_id = ?", userID).Delete(new(ProgressRecord))
+	if err != nil {
+		_ = session.Rollback()
+		return helpers.LogErrorWithMessage(err, "DeleteUser(): Failed to delete playback progress")
+	}
+	// every relation inside the user's collections
+	_, err = session.Table(collectionRelationsTable).
+		Where(fmt.Sprintf("collection_id IN (SELECT collection_id FROM %s WHERE owner_user_id = ?)", collectionsTable), userID).
+		Delete(new(CollectionRelation))
+	if err != nil {
+		_ = session.Rollback()
+		return helpers.LogErrorWithMessage(err, "DeleteUser(): Failed to delete collection relations")
+	}
+	// items the user added to collections shared with them stay, they now belong to the collection owner
+	err = reassignCollectionRelationsSession(session, userID)
+	if err != nil {
+		_ = session.Rollback()
+		return err
+	}
+	// follows by the user, and follows of the user's collections
+	_, err = session.Table(collectionFollowsTable).
+		Where(fmt.Sprintf("user_id = ? OR collection_id IN (SELECT collection_id FROM %s WHERE owner_user_id = ?)", collectionsTable), userID, userID).
+		Delete(new(CollectionFollow))
+	if err != nil {
+		_ = session.Rollback()
+		return helpers.LogErrorWithMessage(err, "DeleteUser(): Failed to delete collection follows")
+	}
+	// memberships of the user, and members of the user's collections
+	_, err = session.Table(collectionMembersTable).
+		Where(fmt.Sprintf("user_id = ? OR collection_id IN (SELECT collection_id FROM %s WHERE owner_user_id = ?)", collectionsTable), userID, userID).
+		Delete(new(CollectionMember))
+	if err != nil {
+		_ = session.Rollback()
+		return helpers.LogErrorWithMessage(err, "DeleteUser(): Failed to delete collection members")
+	}
+	_, err = session.Table(collectionsTable).Where("owner_user_id = ?", userID).Delete(new(CollectionRecord))
+	if err != nil {
+		_ = session.Rollback()
+		return helpers.LogErrorWithMessage(err, "DeleteUser(): Failed to delete collections")
+	}
+	_, err = session.Table(refreshTokensTable).Where("user_id = ?", userID).Delete(new(RefreshTokenRecord))
+	if err != nil {
+		_ = session.Rollback()
+		return helpers.LogErrorWithMessage(err, "DeleteUser(): Failed to delete sessions")
+	}
+	_, err = session.Table(webhookTokensTable).Where("user_id = ?", userID).Delete(new(WebhookTokenRecord))
+	if err != nil {
+		_ = session.Rollback()
+		return helpers.LogErrorWithMessage(err, "DeleteUser(): Failed to delete webhook token")
+	}
+	affected, err := session.Table(usersTable).ID(userID).Delete(new(UserXorm))
+	if err != nil || affected <= 0 {
+		_ = session.Rollback()
+		return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "DeleteUser(): No user found with this ID")
+	}
+	err = session.Commit()
+	if err != nil {
+		_ = session.Rollback()
+		return helpers.LogErrorWithMessage(errors.New(helpers.InternalServerError), "DeleteUser(): error committing transaction")
+	}
+	return nil
+}
+
+// reassignCollectionRelationsSession moves the user's relations in other users' collections to the
+// collection owners, relations the owner already has for the same item are dropped
+func reassignCollectionRelationsSession(session *xorm.Session, userID int64) error {
+	var relations []CollectionRelation
+	err := session.Table(collectionRelationsTable).Where("user_id = ?", userID).Find(&relations)
+	if err != nil {
+		return helpers.LogErrorWithMessage(err, "DeleteUser(): Failed to get collection relations")
+	}
+	owners := map[int64]int64{}
+	for _, relation := range relations {
+		ownerID, ok := owners[relation.CollectionID]
+		if !ok {
+			var collection CollectionRecord
+			found, err := session.Table(collectionsTable).ID(relation.CollectionID).Cols("owner_user_id").Get(&collection)
+			if err != nil {
+				return helpers.LogErrorWithMessage(err, "DeleteUser(): Failed to get collection")
+			}
+			if found {
+				ownerID = collection.OwnerID
+			}
+			owners[relation.CollectionID] = ownerID
+		}
+		exists := false
+		if ownerID > 0 {
+			exists, err = session.Table(collectionRelationsTable).Where("user_id = ?", ownerID).
+				Where("library_id = ?", relation.LibraryID).
+				Where("collection_id = ?", relation.CollectionID).Exist(new(CollectionRelation))
+			if err != nil {
+				return helpers.LogErrorWithMessage(err, "DeleteUser(): Failed to check collection relations")
+			}
+		}
+		query := session.Table(collectionRelationsTable).Where("user_id = ?", userID).
+			Where("library_id = ?", relation.LibraryID).
+			Where("collection_id = ?", relation.CollectionID)
+		if ownerID <= 0 || exists {
+			_, err = query.Delete(new(CollectionRelation))
+		} else {
+			// keep updated_at, it's the tie breaker for unordered items
+			_, err = query.Cols("user_id").NoAutoTime().Update(&CollectionRelation{UserID: ownerID})
+		}
+		if err != nil {
+			return helpers.LogErrorWithMessage(err, "DeleteUser(): Failed to reassign collection relations")
+		}
+	}
+	return nil
+}
+
+func CountUsers() (int64, error) {
+	return databaseEngine.Table(usersTable).Count(new(UserXorm))
+}
+
+func CountAdmins() (int64, error) {
+	return databaseEngine.Table(usersTable).Where("is_admin = ?", true).
+		Where("is_disabled = ?", false).Count(new(UserXorm))
+}
+
+// ListUsers returns users ordered by id, -1 limit/offset means no limit
+func ListUsers(limit int, offset int) ([]User, int64, error) {
+	var usersXorm []UserXorm
+	sess := databaseEngine.Table(usersTable).OrderBy("id asc")
+	if limit > 0 && offset >= 0 {
+		sess = sess.Limit(limit, offset)
+	}
+	err := sess.Find(&usersXorm)
+	if err != nil {
+		return nil, -1, helpers.LogErrorWithMessage(err, "ListUsers(): Failed to list users")
+	}
+	var users []User
+	for num := range usersXorm {
+		user, err := convertUserXorm(&usersXorm[num])
+		if err != nil {
+			return nil, -1, err
+		}
+		users = append(users, *user)
+	}
+	totalRecords, err := CountUsers()
+	if err != nil {
+		return nil, -1, err
+	}
+	return users, totalRecords, nil
+}
+
+func SetUserAdmin(userID int64, isAdmin bool) error {
+	// check existence first, mysql reports 0 affected rows when nothing changed
+	if _, err := GetUsernameFromID(userID); err != nil {
+		return helpers.LogErrorWithMessage(err, "SetUserAdmin(): No user found with this ID")
+	}
+	_, err := databaseEngine.Table(usersTable).ID(userID).Cols("is_admin").
+		Update(&UserXorm{IsAdmin: isAdmin})
+	if err != nil {
+		return helpers.LogErrorWithMessage(err, "SetUserAdmin(): Failed to update user")
+	}
+	return nil
+}
+
+func SetUserDisabled(userID int64, isDisabled bool) error {
+	// check existence first, mysql reports 0 affected rows when nothing changed
+	if _, err := GetUsernameFromID(userID); err != nil {
+		return helpers.LogErrorWithMessage(err, "SetUserDisabled(): No user found with this ID")
+	}
+	_, err := databaseEngine.Table(usersTable).ID(userID).Cols("is_disabled").
+		Update(&UserXorm{IsDisabled: isDisabled})
+	if err != nil {
+		return helpers.LogErrorWithMessage(err, "SetUserDisabled(): Failed to update user")
+	}
+	return nil
+}
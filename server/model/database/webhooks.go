@@ -0,0 +1,103 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"hound/helpers"
+	"time"
+)
+
+/*
+	Webhook tokens - authenticate scrobble webhooks from Plex, Jellyfin and Kodi.
+	Players can't log in, so each user gets one long lived token to put in the webhook url
+*/
+
+const webhookTokensTable = "webhook_tokens"
+
+type WebhookTokenRecord struct {
+	TokenID    int64      `xorm:"pk autoincr 'token_id'" json:"-"`
+	UserID     int64      `xorm:"not null unique 'user_id'" json:"user_id"`
+	TokenHash  string     `xorm:"char(64) not null unique" json:"-"` // sha256 of the webhook token, raw token is never stored
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `xorm:"created" json:"created_at"`
+}
+
+func instantiateWebhookTokensTable() error {
+	err := databaseEngine.Table(webhookTokensTable).Sync2(new(WebhookTokenRecord))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SetWebhookToken stores the user's webhook token, replacing the previous one
+func SetWebhookToken(userID int64, tokenHash string) (*WebhookTokenRecord, error) {
+	session := databaseEngine.NewSession()
+	defer session.Close()
+	_ = session.Begin()
+	_, err := session.Table(webhookTokensTable).Where("user_id = ?", userID).Delete(new(WebhookTokenRecord))
+	if err != nil {
+		_ = session.Rollback()
+		return nil, helpers.LogErrorWithMessage(err, "SetWebhookToken(): Failed to delete webhook token")
+	}
+	record := WebhookTokenRecord{
+		UserID:    userID,
+		TokenHash: tokenHash,
+	}
+	_, err = session.Table(webhookTokensTable).Insert(&record)
+	if err != nil {
+		_ = session.Rollback()
+		return nil, helpers.LogErrorWithMessage(err, "SetWebhookToken(): Failed to insert webhook token")
+	}
+	err = session.Commit()
+	if err != nil {
+		_ = session.Rollback()
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.InternalServerError), "SetWebhookToken(): error committing transaction")
+	}
+	return &record, nil
+}
+
+// GetWebhookToken returns the user's webhook token record, nil if the user has none
+func GetWebhookToken(userID int64) (*WebhookTokenRecord, error) {
+	var record WebhookTokenRecord
+	found, err := databaseEngine.Table(webhookTokensTable).Where("user_id = ?", userID).Get(&record)
+	if err != nil {
+		return nil, helpers.LogErrorWithMessage(err, "GetWebhookToken(): Failed to get webhook token")
+	}
+	if !found {
+		return nil, nil
+	}
+	return &record, nil
+}
+
+func DeleteWebhookToken(userID int64) error {
+	affected, err := databaseEngine.Table(webhookTokensTable).Where("user_id = ?", userID).Delete(new(WebhookTokenRecord))
+	if err != nil {
+		return helpers.LogErrorWithMessage(err, "DeleteWebhookToken(): Failed to delete webhook token")
+	}
+	if affected <= 0 {
+		return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "DeleteWebhookToken(): No webhook token for this user")
+	}
+	return nil
+}
+
+// GetUserIDFromWebhookToken returns the owner of a webhook token, disabled users are rejected
+func GetUserIDFromWebhookToken(tokenHash string) (int64, error) {
+	var record WebhookTokenRecord
+	found, err := databaseEngine.Table(webhookTokensTable).
+		Join("INNER", usersTable, fmt.Sprintf("%s.user_id = %s.id", webhookTokensTable, usersTable)).
+		Where(fmt.Sprintf("%s.token_hash = ?", webhookTokensTable), tokenHash).
+		Where(fmt.Sprintf("%s.is_disabled = ?", usersTable), false).
+		Cols(fmt.Sprintf("%s.token_id", webhookTokensTable), fmt.Sprintf("%s.user_id", webhookTokensTable)).
+		Get(&record)
+	if err != nil {
+		return -1, helpers.LogErrorWithMessage(err, "GetUserIDFromWebhookToken(): Failed to get webhook token")
+	}
+	if !found {
+		return -1, helpers.LogErrorWithMessage(errors.New(helpers.Unauthorized), "GetUserIDFromWebhookToken(): Invalid webhook token")
+	}
+	now := time.Now()
+	_, _ = databaseEngine.Table(webhookTokensTable).ID(record.TokenID).Cols("last_used_at").
+		Update(&WebhookTokenRecord{LastUsedAt: &now})
+	return record.UserID, nil
+}
@@ -0,0 +1,308 @@
+package exports
+
+import (
+	"archive/zip"
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"hound/helpers"
+	"hound/model/database"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+	Export - a user's collections, collection items, comments and watch history.
+	The zip holds export.json (documented by schema.json, re-importable with the
+	"hound" import source) and the same data flattened into CSVs
+*/
+
+// SchemaVersion is bumped on breaking changes to the export format
+const SchemaVersion = 1
+
+//go:embed schema.json
+var schemaJSON []byte
+
+type HoundExport struct {
+	SchemaVersion int                `json:"schema_version"`
+	ExportedAt    time.Time          `json:"exported_at"`
+	Username      string             `json:"username"`
+	Collections   []ExportCollection `json:"collections"`
+	Comments      []ExportComment    `json:"comments"`
+	History       []ExportHistory    `json:"history"`
+}
+
+// ExportMedia identifies a library item across instances
+type ExportMedia struct {
+	MediaType   string `json:"media_type"`
+	MediaSource string `json:"media_source"`
+	SourceID    string `json:"source_id"`
+	MediaTitle  string `json:"media_title"` // informational, not used on import
+}
+
+type ExportCollection struct {
+	CollectionID int64                     `json:"collection_id"` // id on the exporting instance
+	Title        string                    `json:"title"`
+	Description  string                    `json:"description"`
+	IsPrimary    bool                      `json:"is_primary"`
+	IsPublic     bool                      `json:"is_public"`
+	Tags         *[]database.TagObject     `json:"tags"`
+	ThumbnailURL *string                   `json:"thumbnail_url"`
+	Rules        *database.CollectionRules `json:"rules"`
+	CreatedAt    time.Time                 `json:"created_at"`
+	UpdatedAt    time.Time                 `json:"updated_at"`
+	Items        []ExportCollectionItem    `json:"items"`
+}
+
+type ExportCollectionItem struct {
+	ExportMedia
+	Position  int64     `json:"position"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type ExportComment struct {
+	ExportMedia
+	CommentType string    `json:"comment_type"` // review, note, comment
+	Title       string    `json:"title"`
+	Comment     string    `json:"comment"`
+	TagData     string    `json:"tag_data"`
+	Score       int       `json:"score"`
+	IsPrivate   bool      `json:"is_private"`
+	StartDate   time.Time `json:"start_date"`
+	EndDate     time.Time `json:"end_date"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type ExportHistory struct {
+	ExportMedia
+	SeasonNumber  *int      `json:"season_number"`
+	EpisodeNumber *int      `json:"episode_number"`
+	WatchedAt     time.Time `json:"watched_at"`
+	RewatchNumber int       `json:"rewatch_number"`
+	Notes         string    `json:"notes"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// GetUserExport collects everything the user owns
+func GetUserExport(userID int64, username string) (*HoundExport, error) {
+	collections, _, err := database.SearchForCollection(database.CollectionRecordQuery{OwnerID: &userID}, -1, -1)
+	if err != nil {
+		return nil, helpers.LogErrorWithMessage(err, "GetUserExport(): Failed to get collections")
+	}
+	items, err := database.GetOwnedCollectionItems(userID)
+	if err != nil {
+		return nil, err
+	}
+	comments, err := database.GetUserComments(userID)
+	if err != nil {
+		return nil, err
+	}
+	history, _, err := database.GetHistory(database.HistoryQuery{UserID: userID}, -1, -1)
+	if err != nil {
+		return nil, err
+	}
+	export := HoundExport{
+		SchemaVersion: SchemaVersion,
+		ExportedAt:    time.Now().UTC(),
+		Username:      username,
+		Collections:   []ExportCollection{},
+		Comments:      []ExportComment{},
+		History:       []ExportHistory{},
+	}
+	collectionIndexes := map[int64]int{}
+	for _, item := range collections {
+		collectionIndexes[item.CollectionID] = len(export.Collections)
+		export.Collections = append(export.Collections, ExportCollection{
+			CollectionID: item.CollectionID,
+			Title:        item.CollectionTitle,
+			Description:  string(item.Description),
+			IsPrimary:    item.IsPrimary,
+			IsPublic:     item.IsPublic,
+			Tags:         item.Tags,
+			ThumbnailURL: item.ThumbnailURL,
+			Rules:        item.Rules,
+			CreatedAt:    item.CreatedAt,
+			UpdatedAt:    item.UpdatedAt,
+			Items:        []ExportCollectionItem{},
+		})
+	}
+	for _, item := range items {
+		num, ok := collectionIndexes[item.CollectionID]
+		if !ok {
+			continue
+		}
+		export.Collections[num].Items = append(export.Collections[num].Items, ExportCollectionItem{
+			ExportMedia: ExportMedia{item.MediaType, item.MediaSource, item.SourceID, item.MediaTitle},
+			Position:    item.Position,
+			CreatedAt:   item.CreatedAt,
+			UpdatedAt:   item.UpdatedAt,
+		})
+	}
+	for _, item := range comments {
+		export.Comments = append(export.Comments, ExportComment{
+			ExportMedia: ExportMedia{item.MediaType, item.MediaSource, item.SourceID, item.MediaTitle},
+			CommentType: item.CommentType,
+			Title:       item.CommentTitle,
+			Comment:     string(item.Comment),
+			TagData:     item.TagData,
+			Score:       item.Score,
+			IsPrivate:   item.IsPrivate,
+			StartDate:   item.StartDate,
+			EndDate:     item.EndDate,
+			CreatedAt:   item.CreatedAt,
+			UpdatedAt:   item.UpdatedAt,
+		})
+	}
+	// oldest first, so rewatch numbers read in order
+	for num := len(history) - 1; num >= 0; num-- {
+		item := history[num]
+		export.History = append(export.History, ExportHistory{
+			ExportMedia:   ExportMedia{item.MediaType, item.MediaSource, item.SourceID, item.MediaTitle},
+			SeasonNumber:  item.SeasonNumber,
+			EpisodeNumber: item.EpisodeNumber,
+			WatchedAt:     item.WatchedAt,
+			RewatchNumber: item.RewatchNumber,
+			Notes:         string(item.Notes),
+			CreatedAt:     item.CreatedAt,
+			UpdatedAt:     item.UpdatedAt,
+		})
+	}
+	return &export, nil
+}
+
+// ParseExport reads an export.json, or the export zip itself
+func ParseExport(data []byte) (*HoundExport, error) {
+	if reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data))); err == nil {
+		file, err := reader.Open("export.json")
+		if err != nil {
+			return nil, errors.New("zip has no export.json")
+		}
+		defer file.Close()
+		data, err = io.ReadAll(file)
+		if err != nil {
+			return nil, errors.New("failed to read export.json")
+		}
+	}
+	var export HoundExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, errors.New("invalid export json")
+	}
+	if export.SchemaVersion < 1 || export.SchemaVersion > SchemaVersion {
+		return nil, errors.New("unsupported schema_version " + strconv.Itoa(export.SchemaVersion))
+	}
+	return &export, nil
+}
+
+// WriteExportZip writes export.json, schema.json and the CSVs
+func WriteExportZip(w io.Writer, export *HoundExport) error {
+	archive := zip.NewWriter(w)
+	file, err := archive.Create("export.json")
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err = encoder.Encode(export); err != nil {
+		return err
+	}
+	file, err = archive.Create("schema.json")
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(schemaJSON); err != nil {
+		return err
+	}
+	for _, table := range exportTables(export) {
+		file, err = archive.Create(table.name)
+		if err != nil {
+			return err
+		}
+		writer := csv.NewWriter(file)
+		if err = writer.WriteAll(table.rows); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+type csvTable struct {
+	name string
+	rows [][]string
+}
+
+func exportTables(export *HoundExport) []csvTable {
+	collections := [][]string{{"collection_id", "title", "description", "is_primary", "is_public", "tags",
+		"thumbnail_url", "rules", "created_at", "updated_at"}}
+	items := [][]string{{"collection_id", "media_type", "media_source", "source_id", "media_title", "position",
+		"created_at", "updated_at"}}
+	for _, collection := range export.Collections {
+		var tags []string
+		if collection.Tags != nil {
+			for _, tag := range *collection.Tags {
+				tags = append(tags, tag.TagName)
+			}
+		}
+		rules := ""
+		if collection.Rules != nil {
+			encoded, _ := json.Marshal(collection.Rules)
+			rules = string(encoded)
+		}
+		collectionID := strconv.FormatInt(collection.CollectionID, 10)
+		collections = append(collections, []string{collectionID, collection.Title, collection.Description,
+			strconv.FormatBool(collection.IsPrimary), strconv.FormatBool(collection.IsPublic), strings.Join(tags, ";"),
+			stringValue(collection.ThumbnailURL), rules, formatTime(collection.CreatedAt), formatTime(collection.UpdatedAt)})
+		for _, item := range collection.Items {
+			items = append(items, []string{collectionID, item.MediaType, item.MediaSource, item.SourceID, item.MediaTitle,
+				strconv.FormatInt(item.Position, 10), formatTime(item.CreatedAt), formatTime(item.UpdatedAt)})
+		}
+	}
+	comments := [][]string{{"media_type", "media_source", "source_id", "media_title", "comment_type", "title",
+		"comment", "tag_data", "score", "is_private", "start_date", "end_date", "created_at", "updated_at"}}
+	for _, item := range export.Comments {
+		comments = append(comments, []string{item.MediaType, item.MediaSource, item.SourceID, item.MediaTitle,
+			item.CommentType, item.Title, item.Comment, item.TagData, strconv.Itoa(item.Score),
+			strconv.FormatBool(item.IsPrivate), formatTime(item.StartDate), formatTime(item.EndDate),
+			formatTime(item.CreatedAt), formatTime(item.UpdatedAt)})
+	}
+	history := [][]string{{"media_type", "media_source", "source_id", "media_title", "season_number",
+		"episode_number", "watched_at", "rewatch_number", "notes"}}
+	for _, item := range export.History {
+		history = append(history, []string{item.MediaType, item.MediaSource, item.SourceID, item.MediaTitle,
+			intValue(item.SeasonNumber), intValue(item.EpisodeNumber), formatTime(item.WatchedAt),
+			strconv.Itoa(item.RewatchNumber), item.Notes})
+	}
+	return []csvTable{
+		{"collections.csv", collections},
+		{"collection_items.csv", items},
+		{"comments.csv", comments},
+		{"history.csv", history},
+	}
+}
+
+func formatTime(value time.Time) string {
+	if value.IsZero() {
+		return ""
+	}
+	return value.UTC().Format(time.RFC3339)
+}
+
+func stringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+func intValue(value *int) string {
+	if value == nil {
+		return ""
+	}
+	return strconv.Itoa(*value)
+}
@@ -0,0 +1,191 @@
+package imports
+
+import (
+	"errors"
+	"hound/model/database"
+	"hound/model/exports"
+	"hound/model/sources"
+)
+
+/*
+	Hound exports - export.json or the export zip from GET /api/v1/export. Items are
+	identified by media source ids so nothing is searched, and rows keep their
+	original timestamps. Rows are numbered in file order: collections with their
+	items, then comments, then history
+*/
+
+func countHoundRows(export *exports.HoundExport) int {
+	count := len(export.Comments) + len(export.History)
+	for _, collection := range export.Collections {
+		count += 1 + len(collection.Items)
+	}
+	return count
+}
+
+func runHoundJob(job *Job, export *exports.HoundExport) {
+	importer := newImporter(job)
+	line := 0
+	for _, collection := range export.Collections {
+		line++
+		collectionID, result, err := importer.importHoundCollection(collection)
+		recordResult(job, UnmatchedRow{Line: line, Title: "collection: " + collection.Title}, result, err)
+		for _, item := range collection.Items {
+			line++
+			var result *rowResult
+			itemErr := errors.New("collection was not imported")
+			if err == nil {
+				result, itemErr = importer.importHoundCollectionItem(collectionID, item)
+			}
+			recordResult(job, UnmatchedRow{Line: line, Title: item.MediaTitle}, result, itemErr)
+		}
+	}
+	for _, comment := range export.Comments {
+		line++
+		result, err := importer.importHoundComment(comment)
+		recordResult(job, UnmatchedRow{Line: line, Title: comment.MediaTitle}, result, err)
+	}
+	for _, history := range export.History {
+		line++
+		result, err := importer.importHoundHistory(history)
+		recordResult(job, UnmatchedRow{Line: line, Title: history.MediaTitle}, result, err)
+	}
+	finishJob(job)
+}
+
+func (imp *importer) importHoundCollection(collection exports.ExportCollection) (int64, *rowResult, error) {
+	if collection.Title == "" {
+		return -1, nil, errors.New("collection has no title")
+	}
+	if collection.Rules != nil && collection.IsPrimary {
+		return -1, nil, errors.New("primary collection can't have rules")
+	}
+	if collection.Rules != nil && database.ValidateCollectionRules(collection.Rules) != nil {
+		return -1, nil, errors.New("invalid collection rules")
+	}
+	result := &rowResult{dryRun: imp.dryRun}
+	if imp.dryRun {
+		return -1, result, nil
+	}
+	collectionID, added, err := database.ImportCollection(database.CollectionRecord{
+		CollectionTitle: collection.Title,
+		Description:     []byte(collection.Description),
+		OwnerID:         imp.userID,
+		IsPrimary:       collection.IsPrimary,
+		IsPublic:        collection.IsPublic,
+		Tags:            collection.Tags,
+		ThumbnailURL:    collection.ThumbnailURL,
+		Rules:           collection.Rules,
+		CreatedAt:       collection.CreatedAt,
+		UpdatedAt:       collection.UpdatedAt,
+	})
+	if err != nil {
+		return -1, nil, errors.New("failed to add collection")
+	}
+	if added {
+		result.collectionsAdded++
+	}
+	return collectionID, result, nil
+}
+
+func (imp *importer) importHoundCollectionItem(collectionID int64, item exports.ExportCollectionItem) (*rowResult, error) {
+	libraryID, result, err := imp.resolveHoundMedia(item.ExportMedia)
+	if err != nil || imp.dryRun {
+		return result, err
+	}
+	added, err := database.ImportCollectionRelation(database.CollectionRelation{
+		UserID:       imp.userID,
+		LibraryID:    libraryID,
+		CollectionID: collectionID,
+		Position:     item.Position,
+		CreatedAt:    item.CreatedAt,
+		UpdatedAt:    item.UpdatedAt,
+	})
+	if err != nil {
+		return nil, errors.New("failed to add collection item")
+	}
+	if added {
+		result.collectionItemsAdded++
+	}
+	return result, nil
+}
+
+func (imp *importer) importHoundComment(comment exports.ExportComment) (*rowResult, error) {
+	if comment.Score < 0 || comment.Score > 100 {
+		return nil, errors.New("score must be between 0 and 100")
+	}
+	libraryID, result, err := imp.resolveHoundMedia(comment.ExportMedia)
+	if err != nil || imp.dryRun {
+		return result, err
+	}
+	added, err := database.ImportComment(database.CommentRecord{
+		CommentType:  comment.CommentType,
+		UserID:       imp.userID,
+		LibraryID:    libraryID,
+		IsPrivate:    comment.IsPrivate,
+		CommentTitle: comment.Title,
+		Comment:      []byte(comment.Comment),
+		TagData:      comment.TagData,
+		Score:        comment.Score,
+		StartDate:    comment.StartDate,
+		EndDate:      comment.EndDate,
+		CreatedAt:    comment.CreatedAt,
+		UpdatedAt:    comment.UpdatedAt,
+	})
+	if err != nil {
+		return nil, errors.New("failed to add comment")
+	}
+	if added {
+		result.commentsAdded++
+	}
+	return result, nil
+}
+
+func (imp *importer) importHoundHistory(history exports.ExportHistory) (*rowResult, error) {
+	if history.WatchedAt.IsZero() {
+		return nil, errors.New("history has no watched_at")
+	}
+	if (history.SeasonNumber == nil) != (history.EpisodeNumber == nil) {
+		return nil, errors.New("history needs both season_number and episode_number")
+	}
+	libraryID, result, err := imp.resolveHoundMedia(history.ExportMedia)
+	if err != nil || imp.dryRun {
+		return result, err
+	}
+	added, err := database.ImportHistoryRecord(database.HistoryRecord{
+		UserID:        imp.userID,
+		LibraryID:     libraryID,
+		SeasonNumber:  history.SeasonNumber,
+		EpisodeNumber: history.EpisodeNumber,
+		WatchedAt:     history.WatchedAt,
+		RewatchNumber: history.RewatchNumber,
+		Notes:         []byte(history.Notes),
+		CreatedAt:     history.CreatedAt,
+		UpdatedAt:     history.UpdatedAt,
+	})
+	if err != nil {
+		return nil, errors.New("failed to add history")
+	}
+	if added {
+		result.historyAdded++
+	}
+	return result, nil
+}
+
+// resolveHoundMedia checks an item's source and, unless dry running, gets its library id
+func (imp *importer) resolveHoundMedia(media exports.ExportMedia) (int64, *rowResult, error) {
+	if media.SourceID == "" {
+		return -1, nil, errors.New("no source_id")
+	}
+	if _, err := sources.GetSourceForMediaType(media.MediaType, media.MediaSource); err != nil {
+		return -1, nil, errors.New("invalid media_type or media_source")
+	}
+	result := &rowResult{dryRun: imp.dryRun}
+	if imp.dryRun {
+		return -1, result, nil
+	}
+	libraryID, err := imp.getLibraryID(media.MediaType, media.MediaSource, media.SourceID)
+	if err != nil {
+		return -1, nil, err
+	}
+	return libraryID, result, nil
+}
@@ -0,0 +1,93 @@
+package imports
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"hound/model/database"
+	"strconv"
+	"strings"
+)
+
+/*
+	IMDb exports - ratings.csv (Const, Your Rating, Date Rated, Title, URL, Title Type, ..., Year).
+	Ratings are 1-10, rated items are not counted as watched
+*/
+
+var imdbTitleTypes = map[string]string{
+	"movie":        database.MediaTypeMovie,
+	"tvMovie":      database.MediaTypeMovie,
+	"video":        database.MediaTypeMovie,
+	"short":        database.MediaTypeMovie,
+	"tvSeries":     database.MediaTypeTVShow,
+	"tvMiniSeries": database.MediaTypeTVShow,
+	"tvEpisode":    database.MediaTypeTVShow,
+}
+
+func parseIMDb(data []byte) ([]ImportRow, error) {
+	records, columns, err := readCSV(data, "Const", "Your Rating", "Title")
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]ImportRow, 0, len(records))
+	for num, record := range records {
+		line := num + 2
+		row := ImportRow{
+			Line:   line,
+			Title:  csvField(record, columns, "Title"),
+			IMDbID: csvField(record, columns, "Const"),
+		}
+		// unknown title types (video games, podcasts) are reported as unmatched
+		row.MediaType = imdbTitleTypes[csvField(record, columns, "Title Type")]
+		if year := csvField(record, columns, "Year"); year != "" {
+			row.Year, _ = strconv.Atoi(year)
+		}
+		rating, err := strconv.Atoi(csvField(record, columns, "Your Rating"))
+		if err != nil || rating < 1 || rating > 10 {
+			return nil, errors.New("invalid rating on line " + itoa(line))
+		}
+		score := rating * 10
+		row.Score = &score
+		row.RatedAt, err = parseCSVDate(csvField(record, columns, "Date Rated"))
+		if err != nil {
+			return nil, errors.New("invalid date on line " + itoa(line))
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// readCSV reads a csv file with a header row, columns maps header names to indexes
+func readCSV(data []byte, required ...string) ([][]string, map[string]int, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, nil, errors.New("invalid csv")
+	}
+	if len(records) == 0 {
+		return nil, nil, errors.New("empty file")
+	}
+	columns := map[string]int{}
+	for num, name := range records[0] {
+		columns[strings.TrimSpace(name)] = num
+	}
+	for _, name := range required {
+		if _, ok := columns[name]; !ok {
+			return nil, nil, errors.New("missing column " + name)
+		}
+	}
+	return records[1:], columns, nil
+}
+
+func csvField(record []string, columns map[string]int, name string) string {
+	num, ok := columns[name]
+	if !ok || num >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[num])
+}
+
+func itoa(value int) string {
+	return strconv.Itoa(value)
+}
@@ -0,0 +1,358 @@
+package imports
+
+import (
+	"errors"
+	"fmt"
+	"hound/helpers"
+	"hound/model/database"
+	"hound/model/exports"
+	"hound/model/sources"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/*
+	Imports - watch history and ratings from other services. Files are parsed into
+	ImportRows when uploaded, rows are then resolved to tmdb ids and written to
+	history and reviews in a background job
+*/
+
+const (
+	SourceTrakt      = "trakt"
+	SourceLetterboxd = "letterboxd"
+	SourceIMDb       = "imdb"
+	// hound exports, see exports.HoundExport
+	SourceHound = "hound"
+)
+
+const (
+	JobStatusRunning   = "running"
+	JobStatusCompleted = "completed"
+)
+
+// finished jobs are kept in memory for this long
+const jobRetention = 24 * time.Hour
+
+// ImportRow is one watch and/or rating parsed from an export file
+type ImportRow struct {
+	Line          int
+	MediaType     string // movie or tvshow
+	Title         string
+	Year          int
+	IMDbID        string
+	TMDBID        int
+	SeasonNumber  *int
+	EpisodeNumber *int
+	WatchedAt     *time.Time
+	Score         *int // 0-100
+	RatedAt       time.Time
+	Review        string
+	Error         string // set if the row can't be imported, it is reported as unmatched
+}
+
+type UnmatchedRow struct {
+	Line   int    `json:"line"`
+	Title  string `json:"title"`
+	Year   int    `json:"year,omitempty"`
+	Reason string `json:"reason"`
+}
+
+type Job struct {
+	JobID         int64  `json:"job_id"`
+	UserID        int64  `json:"-"`
+	Source        string `json:"source"`
+	DryRun        bool   `json:"dry_run"`
+	Status        string `json:"status"`
+	TotalRows     int    `json:"total_rows"`
+	ProcessedRows int    `json:"processed_rows"`
+	MatchedRows   int    `json:"matched_rows"`
+	HistoryAdded  int    `json:"history_added"`
+	ReviewsAdded  int    `json:"reviews_added"`
+	// hound imports only
+	CollectionsAdded     int            `json:"collections_added,omitempty"`
+	CollectionItemsAdded int            `json:"collection_items_added,omitempty"`
+	CommentsAdded        int            `json:"comments_added,omitempty"` // reviews, notes and comments
+	SkippedRows          int            `json:"skipped_rows"`             // already imported
+	Unmatched            []UnmatchedRow `json:"unmatched"`
+	CreatedAt            time.Time      `json:"created_at"`
+	FinishedAt           *time.Time     `json:"finished_at"`
+}
+
+var (
+	jobs      = map[int64]*Job{}
+	jobsMutex sync.Mutex
+	lastJobID int64
+)
+
+// StartImport parses an export file and imports it in the background.
+// Parse errors are returned right away, row errors are reported on the job
+func StartImport(userID int64, source string, data []byte, dryRun bool) (*Job, error) {
+	var run func(job *Job)
+	var totalRows int
+	if source == SourceHound {
+		export, err := exports.ParseExport(data)
+		if err != nil {
+			return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Failed to parse hound file: "+err.Error())
+		}
+		totalRows = countHoundRows(export)
+		run = func(job *Job) { runHoundJob(job, export) }
+	} else {
+		rows, err := ParseFile(source, data)
+		if err != nil {
+			return nil, err
+		}
+		totalRows = len(rows)
+		run = func(job *Job) { runJob(job, rows) }
+	}
+	jobsMutex.Lock()
+	pruneJobs()
+	lastJobID++
+	job := &Job{
+		JobID:     lastJobID,
+		UserID:    userID,
+		Source:    source,
+		DryRun:    dryRun,
+		Status:    JobStatusRunning,
+		TotalRows: totalRows,
+		Unmatched: []UnmatchedRow{},
+		CreatedAt: time.Now(),
+	}
+	jobs[job.JobID] = job
+	snapshot := *job
+	jobsMutex.Unlock()
+	go run(job)
+	return &snapshot, nil
+}
+
+// ParseFile parses an export file of a source into rows
+func ParseFile(source string, data []byte) ([]ImportRow, error) {
+	var rows []ImportRow
+	var err error
+	switch source {
+	case SourceTrakt:
+		rows, err = parseTrakt(data)
+	case SourceLetterboxd:
+		rows, err = parseLetterboxd(data)
+	case SourceIMDb:
+		rows, err = parseIMDb(data)
+	default:
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid import source")
+	}
+	if err != nil {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Failed to parse "+source+" file: "+err.Error())
+	}
+	return rows, nil
+}
+
+// GetJob returns a copy of the job, only to the user that started it
+func GetJob(userID int64, jobID int64) (*Job, error) {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+	job, ok := jobs[jobID]
+	if !ok || job.UserID != userID {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "No import job with this ID")
+	}
+	snapshot := *job
+	snapshot.Unmatched = append([]UnmatchedRow{}, job.Unmatched...)
+	return &snapshot, nil
+}
+
+// GetJobs returns the user's jobs, newest first. Unmatched rows are left out
+func GetJobs(userID int64) []Job {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+	ret := []Job{}
+	for id := lastJobID; id > 0; id-- {
+		job, ok := jobs[id]
+		if !ok || job.UserID != userID {
+			continue
+		}
+		snapshot := *job
+		snapshot.Unmatched = nil
+		ret = append(ret, snapshot)
+	}
+	return ret
+}
+
+// must hold jobsMutex
+func pruneJobs() {
+	for id, job := range jobs {
+		if job.FinishedAt != nil && time.Since(*job.FinishedAt) > jobRetention {
+			delete(jobs, id)
+		}
+	}
+}
+
+func runJob(job *Job, rows []ImportRow) {
+	importer := newImporter(job)
+	for _, row := range rows {
+		result, err := importer.importRow(row)
+		recordResult(job, UnmatchedRow{Line: row.Line, Title: row.Title, Year: row.Year}, result, err)
+	}
+	finishJob(job)
+}
+
+func newImporter(job *Job) *importer {
+	return &importer{
+		userID:     job.UserID,
+		dryRun:     job.DryRun,
+		matches:    map[string]*sources.TMDBMatch{},
+		libraryIDs: map[string]int64{},
+	}
+}
+
+// recordResult adds a processed row to the job's counts, row is reported if err is set
+func recordResult(job *Job, row UnmatchedRow, result *rowResult, err error) {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+	job.ProcessedRows++
+	if err != nil {
+		row.Reason = err.Error()
+		job.Unmatched = append(job.Unmatched, row)
+		return
+	}
+	job.MatchedRows++
+	job.HistoryAdded += result.historyAdded
+	job.ReviewsAdded += result.reviewsAdded
+	job.CollectionsAdded += result.collectionsAdded
+	job.CollectionItemsAdded += result.collectionItemsAdded
+	job.CommentsAdded += result.commentsAdded
+	if result.skipped() {
+		job.SkippedRows++
+	}
+}
+
+func finishJob(job *Job) {
+	jobsMutex.Lock()
+	now := time.Now()
+	job.Status = JobStatusCompleted
+	job.FinishedAt = &now
+	jobsMutex.Unlock()
+	fmt.Println(helpers.InfoMsg(fmt.Sprintf("Import job %d finished, %d/%d rows matched", job.JobID, job.MatchedRows, job.TotalRows)))
+}
+
+type importer struct {
+	userID     int64
+	dryRun     bool
+	matches    map[string]*sources.TMDBMatch // resolved rows by imdb id, tmdb id or title
+	libraryIDs map[string]int64              // library ids by media type and tmdb id
+}
+
+type rowResult struct {
+	historyAdded         int
+	reviewsAdded         int
+	collectionsAdded     int
+	collectionItemsAdded int
+	commentsAdded        int
+	dryRun               bool
+}
+
+// skipped is true if the row matched, but everything was imported before
+func (result *rowResult) skipped() bool {
+	return !result.dryRun && result.historyAdded == 0 && result.reviewsAdded == 0 && result.collectionsAdded == 0 &&
+		result.collectionItemsAdded == 0 && result.commentsAdded == 0
+}
+
+func (imp *importer) importRow(row ImportRow) (*rowResult, error) {
+	if row.Error != "" {
+		return nil, errors.New(row.Error)
+	}
+	match, err := imp.resolve(row)
+	if err != nil {
+		return nil, err
+	}
+	seasonNumber, episodeNumber := row.SeasonNumber, row.EpisodeNumber
+	// imdb episode ids resolve to the show and episode
+	if match.SeasonNumber != nil && seasonNumber == nil {
+		seasonNumber, episodeNumber = match.SeasonNumber, match.EpisodeNumber
+	}
+	if row.Score != nil && episodeNumber != nil {
+		return nil, errors.New("episode ratings are not supported")
+	}
+	if match.MediaType == database.MediaTypeTVShow && row.WatchedAt != nil && episodeNumber == nil {
+		return nil, errors.New("show watched without an episode")
+	}
+	result := &rowResult{dryRun: imp.dryRun}
+	if imp.dryRun {
+		return result, nil
+	}
+	libraryID, err := imp.getLibraryID(match.MediaType, sources.SourceTMDB, strconv.Itoa(match.TMDBID))
+	if err != nil {
+		return nil, err
+	}
+	if row.WatchedAt != nil {
+		added, err := database.AddHistoryRecordIfMissing(database.HistoryRecord{
+			UserID:        imp.userID,
+			LibraryID:     libraryID,
+			SeasonNumber:  seasonNumber,
+			EpisodeNumber: episodeNumber,
+			WatchedAt:     *row.WatchedAt,
+		})
+		if err != nil {
+			return nil, errors.New("failed to add history")
+		}
+		if added {
+			result.historyAdded++
+		}
+	}
+	if row.Score != nil {
+		added, err := database.AddReviewIfMissing(imp.userID, libraryID, *row.Score, row.Review, row.RatedAt)
+		if err != nil {
+			return nil, errors.New("failed to add rating")
+		}
+		if added {
+			result.reviewsAdded++
+		}
+	}
+	return result, nil
+}
+
+// resolve finds the tmdb item of a row by tmdb id, imdb id, then title and year
+func (imp *importer) resolve(row ImportRow) (*sources.TMDBMatch, error) {
+	var key string
+	if row.TMDBID > 0 && row.MediaType != "" {
+		return &sources.TMDBMatch{MediaType: row.MediaType, TMDBID: row.TMDBID}, nil
+	} else if row.IMDbID != "" {
+		key = "imdb:" + row.IMDbID
+	} else if row.Title != "" && row.MediaType != "" {
+		key = fmt.Sprintf("title:%s:%s:%d", row.MediaType, row.Title, row.Year)
+	} else {
+		return nil, errors.New("no id or title")
+	}
+	match, ok := imp.matches[key]
+	if !ok {
+		var err error
+		if row.IMDbID != "" {
+			match, err = sources.FindByIMDbIDTMDB(row.IMDbID)
+		} else {
+			match, err = sources.SearchByTitleTMDB(row.MediaType, row.Title, row.Year)
+		}
+		if err != nil {
+			return nil, errors.New("tmdb lookup failed")
+		}
+		imp.matches[key] = match
+	}
+	if match == nil {
+		return nil, errors.New("no match on tmdb")
+	}
+	return match, nil
+}
+
+// getLibraryID returns the library id of an item, fetching it from its source if it isn't in the library yet
+func (imp *importer) getLibraryID(mediaType string, mediaSource string, sourceID string) (int64, error) {
+	key := mediaType + ":" + mediaSource + ":" + sourceID
+	if libraryID, ok := imp.libraryIDs[key]; ok {
+		return libraryID, nil
+	}
+	record, err := sources.GetLibraryObject(mediaType, mediaSource, sourceID)
+	if err != nil {
+		return -1, errors.New("failed to get item from " + mediaSource)
+	}
+	libraryID, err := database.AddRecordToInternalLibrary(record)
+	if err != nil {
+		return -1, errors.New("failed to add item to library")
+	}
+	imp.libraryIDs[key] = libraryID
+	return libraryID, nil
+}
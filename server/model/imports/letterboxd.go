@@ -0,0 +1,75 @@
+package imports
+
+import (
+	"errors"
+	"hound/model/database"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+	Letterboxd exports - diary.csv (Date, Name, Year, Letterboxd URI, Rating, Rewatch, Tags, Watched Date)
+	and ratings.csv (Date, Name, Year, Letterboxd URI, Rating). Ratings are 0.5-5 stars.
+	Letterboxd has no external ids, movies are matched by title and year
+*/
+
+func parseLetterboxd(data []byte) ([]ImportRow, error) {
+	records, columns, err := readCSV(data, "Name", "Year", "Rating")
+	if err != nil {
+		return nil, err
+	}
+	// diary entries have a watched date, ratings only the date rated
+	_, isDiary := columns["Watched Date"]
+	rows := make([]ImportRow, 0, len(records))
+	for num, record := range records {
+		line := num + 2
+		row := ImportRow{
+			Line:      line,
+			MediaType: database.MediaTypeMovie,
+			Title:     csvField(record, columns, "Name"),
+		}
+		if year := csvField(record, columns, "Year"); year != "" {
+			row.Year, err = strconv.Atoi(year)
+			if err != nil {
+				return nil, errors.New("invalid year on line " + itoa(line))
+			}
+		}
+		date, err := parseCSVDate(csvField(record, columns, "Date"))
+		if err != nil {
+			return nil, errors.New("invalid date on line " + itoa(line))
+		}
+		if rating := csvField(record, columns, "Rating"); rating != "" {
+			stars, err := strconv.ParseFloat(rating, 64)
+			if err != nil || stars < 0.5 || stars > 5 {
+				return nil, errors.New("invalid rating on line " + itoa(line))
+			}
+			score := int(stars * 20)
+			row.Score = &score
+			row.RatedAt = date
+		}
+		if isDiary {
+			watchedAt, err := parseCSVDate(csvField(record, columns, "Watched Date"))
+			if err != nil {
+				return nil, errors.New("invalid watched date on line " + itoa(line))
+			}
+			if watchedAt.IsZero() {
+				watchedAt = date
+			}
+			row.WatchedAt = &watchedAt
+		}
+		if row.WatchedAt == nil && row.Score == nil {
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// parseCSVDate parses YYYY-MM-DD dates, empty dates are zero
+func parseCSVDate(value string) (time.Time, error) {
+	if strings.TrimSpace(value) == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse("2006-01-02", strings.TrimSpace(value))
+}
@@ -0,0 +1,112 @@
+package imports
+
+import (
+	"encoding/json"
+	"errors"
+	"hound/model/database"
+	"time"
+)
+
+/*
+	Trakt exports - watched-history.json and ratings-*.json from the trakt data export.
+	Both are arrays of entries, history entries have watched_at and ratings have rating (1-10).
+	Entries that can't be imported, eg. season ratings, are reported as unmatched rows
+*/
+
+type traktIDs struct {
+	IMDb string `json:"imdb"`
+	TMDB int    `json:"tmdb"`
+}
+
+type traktItem struct {
+	Title string   `json:"title"`
+	Year  int      `json:"year"`
+	IDs   traktIDs `json:"ids"`
+}
+
+type traktEpisode struct {
+	Season int      `json:"season"`
+	Number int      `json:"number"`
+	IDs    traktIDs `json:"ids"`
+}
+
+type traktEntry struct {
+	Type      string        `json:"type"` // movie, show, season, episode
+	WatchedAt *time.Time    `json:"watched_at"`
+	RatedAt   *time.Time    `json:"rated_at"`
+	Rating    *int          `json:"rating"`
+	Movie     *traktItem    `json:"movie"`
+	Show      *traktItem    `json:"show"`
+	Episode   *traktEpisode `json:"episode"`
+}
+
+func parseTrakt(data []byte) ([]ImportRow, error) {
+	var entries []traktEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, errors.New("expected a json array of history or rating entries")
+	}
+	rows := make([]ImportRow, 0, len(entries))
+	for num, entry := range entries {
+		rows = append(rows, parseTraktEntry(num+1, entry))
+	}
+	return rows, nil
+}
+
+// parseTraktEntry converts an entry to a row, entries that can't be imported get row.Error
+func parseTraktEntry(line int, entry traktEntry) ImportRow {
+	row := ImportRow{Line: line, WatchedAt: entry.WatchedAt}
+	switch entry.Type {
+	case "movie":
+		if entry.Movie == nil {
+			row.Error = "movie entry without movie"
+			return row
+		}
+		row.MediaType = database.MediaTypeMovie
+		setTraktItem(&row, entry.Movie)
+	case "show", "episode":
+		if entry.Show == nil {
+			row.Error = "show entry without show"
+			return row
+		}
+		row.MediaType = database.MediaTypeTVShow
+		setTraktItem(&row, entry.Show)
+		if entry.Type == "episode" {
+			if entry.Episode == nil {
+				row.Error = "episode entry without episode"
+				return row
+			}
+			season, episode := entry.Episode.Season, entry.Episode.Number
+			row.SeasonNumber = &season
+			row.EpisodeNumber = &episode
+		}
+	case "season":
+		// ratings-seasons.json, the show's review would get the season's score
+		if entry.Show != nil {
+			setTraktItem(&row, entry.Show)
+		}
+		row.Error = "season entries are not supported"
+		return row
+	default:
+		row.Error = "unknown type " + entry.Type
+		return row
+	}
+	if entry.Rating != nil {
+		if *entry.Rating < 1 || *entry.Rating > 10 {
+			row.Error = "rating out of range"
+			return row
+		}
+		score := *entry.Rating * 10
+		row.Score = &score
+		if entry.RatedAt != nil {
+			row.RatedAt = *entry.RatedAt
+		}
+	}
+	return row
+}
+
+func setTraktItem(row *ImportRow, item *traktItem) {
+	row.Title = item.Title
+	row.Year = item.Year
+	row.IMDbID = item.IDs.IMDb
+	row.TMDBID = item.IDs.TMDB
+}
@@ -0,0 +1,592 @@
+package media
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"hound/helpers"
+	"hound/model/database"
+	"hound/model/sources"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+	Download organizer - polls organizer.inbox for finished video files, matches them to
+	tmdb and copies, hardlinks or moves them into organizer.movie-destination or
+	organizer.tv-destination, named by the configured templates. Every run is logged
+	so operations can be undone. Failed files are retried on the next run, matched,
+	unmatched and skipped files are not
+*/
+
+const (
+	OrganizerModeCopy     = "copy"
+	OrganizerModeHardlink = "hardlink"
+	OrganizerModeMove     = "move"
+
+	OrganizerConflictSkip      = "skip"
+	OrganizerConflictRename    = "rename"
+	OrganizerConflictOverwrite = "overwrite"
+
+	// planned or attempted, not logged
+	OrganizerStatusFailed = "failed"
+)
+
+var (
+	// {show}, {season:02}
+	templateRegex = regexp.MustCompile(`\{(\w+)(?::(\d+))?\}`)
+	// characters not allowed in file names on common file systems
+	unsafeNameReplacer = strings.NewReplacer("/", "-", "\\", "-", ":", " -", "*", "", "?", "", "\"", "'", "<", "", ">", "", "|", "-")
+	sampleRegex        = regexp.MustCompile(`(?i)(?:^|[\s._\-])sample(?:[\s._\-]|$)`)
+)
+
+var organizerMutex sync.Mutex
+
+// OrganizerResult is a planned (dry run) or finished organizer operation
+type OrganizerResult struct {
+	OperationID     *int64 `json:"operation_id"` // null for dry runs and failed files
+	SourcePath      string `json:"source_path"`
+	DestinationPath string `json:"destination_path"`
+	Mode            string `json:"mode"`
+	Status          string `json:"status"` // done, skipped, unmatched or failed
+	Message         string `json:"message"`
+	Conflict        bool   `json:"conflict"` // destination already existed
+	MediaType       string `json:"media_type"`
+	MediaTitle      string `json:"media_title"`
+	SeasonNumber    *int   `json:"season_number"`
+	EpisodeNumber   *int   `json:"episode_number"`
+}
+
+type organizerConfig struct {
+	inbox            string
+	mode             string
+	conflict         string
+	settleTime       time.Duration
+	movieDestination string
+	tvDestination    string
+	movieTemplate    string
+	episodeTemplate  string
+}
+
+// organizerFile is an inbox file with its match and destination
+type organizerFile struct {
+	result          OrganizerResult
+	size            int64
+	modTime         time.Time
+	destinationRoot string
+	tmdbID          int
+}
+
+// InitializeOrganizer starts polling the inbox, disabled if organizer.inbox is empty or organizer.poll-interval <= 0
+func InitializeOrganizer() {
+	interval := viper.GetInt("organizer.poll-interval")
+	if interval <= 0 || viper.GetString("organizer.inbox") == "" {
+		fmt.Println(helpers.WarnMsg("Download organizer disabled"))
+		return
+	}
+	if _, err := getOrganizerConfig(); err != nil {
+		fmt.Println(helpers.WarnMsg("Download organizer disabled, invalid config: " + err.Error()))
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			results, err := RunOrganizer(false)
+			if err == nil && len(results) > 0 {
+				fmt.Println(helpers.InfoMsg(fmt.Sprintf("Download organizer processed %d files", len(results))))
+			}
+		}
+	}()
+}
+
+func getOrganizerConfig() (*organizerConfig, error) {
+	config := organizerConfig{
+		inbox:            viper.GetString("organizer.inbox"),
+		mode:             viper.GetString("organizer.mode"),
+		conflict:         viper.GetString("organizer.conflict"),
+		settleTime:       time.Duration(viper.GetInt("organizer.settle-time")) * time.Second,
+		movieDestination: viper.GetString("organizer.movie-destination"),
+		tvDestination:    viper.GetString("organizer.tv-destination"),
+		movieTemplate:    viper.GetString("organizer.movie-template"),
+		episodeTemplate:  viper.GetString("organizer.episode-template"),
+	}
+	if config.inbox == "" || config.movieDestination == "" || config.tvDestination == "" {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest),
+			"organizer.inbox, organizer.movie-destination and organizer.tv-destination are required")
+	}
+	for _, dir := range []*string{&config.inbox, &config.movieDestination, &config.tvDestination} {
+		absolute, err := filepath.Abs(*dir)
+		if err != nil {
+			return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid organizer directory "+*dir)
+		}
+		*dir = absolute
+	}
+	if config.mode != OrganizerModeCopy && config.mode != OrganizerModeHardlink && config.mode != OrganizerModeMove {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "organizer.mode must be copy, hardlink or move")
+	}
+	if config.conflict != OrganizerConflictSkip && config.conflict != OrganizerConflictRename &&
+		config.conflict != OrganizerConflictOverwrite {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "organizer.conflict must be skip, rename or overwrite")
+	}
+	// render with sample values to catch unknown placeholders
+	if _, err := renderTemplate(config.movieTemplate, templateValues("Title", 2000, nil, nil, "", "mkv")); err != nil {
+		return nil, err
+	}
+	season, episode := 1, 1
+	if _, err := renderTemplate(config.episodeTemplate, templateValues("Show", 2000, &season, &episode, "Title", "mkv")); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// RunOrganizer organizes the new files in the inbox, with dryRun nothing is written and the planned operations are returned
+func RunOrganizer(dryRun bool) ([]OrganizerResult, error) {
+	config, err := getOrganizerConfig()
+	if err != nil {
+		return nil, err
+	}
+	if !organizerMutex.TryLock() {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "The download organizer is already running")
+	}
+	defer organizerMutex.Unlock()
+	files, err := findInboxFiles(config)
+	if err != nil {
+		return nil, err
+	}
+	planner := newOrganizerPlanner()
+	results := []OrganizerResult{}
+	organized := false
+	for _, file := range files {
+		planner.plan(config, file)
+		if !dryRun {
+			organizeFile(config, file)
+			organized = organized || file.result.Status == database.OrganizerStatusDone
+		}
+		results = append(results, file.result)
+	}
+	if organized {
+		// pick the new files up if the destinations are library roots
+		_ = StartScan()
+	}
+	return results, nil
+}
+
+// findInboxFiles lists video files in the inbox that aren't in the log and have finished downloading
+func findInboxFiles(config *organizerConfig) ([]*organizerFile, error) {
+	if _, err := os.Stat(config.inbox); err != nil {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Organizer inbox not readable: "+config.inbox)
+	}
+	var files []*organizerFile
+	err := filepath.WalkDir(config.inbox, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if strings.HasPrefix(entry.Name(), ".") && path != config.inbox {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() || !VideoExtensions[strings.ToLower(filepath.Ext(path))] ||
+			sampleRegex.MatchString(strings.TrimSuffix(entry.Name(), filepath.Ext(path))) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < config.settleTime {
+			return nil
+		}
+		handled, err := database.IsOrganizerFileHandled(path, info.Size(), info.ModTime())
+		if err != nil {
+			return err
+		}
+		if !handled {
+			files = append(files, &organizerFile{
+				result:  OrganizerResult{SourcePath: path, Mode: config.mode},
+				size:    info.Size(),
+				modTime: info.ModTime(),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// organizerPlanner caches tmdb lookups for the duration of a run
+type organizerPlanner struct {
+	matches map[string]*sources.TMDBMatch
+	names   map[string]organizerName
+}
+
+// organizerName is what templates need from tmdb
+type organizerName struct {
+	title string
+	year  int
+}
+
+func newOrganizerPlanner() *organizerPlanner {
+	return &organizerPlanner{matches: map[string]*sources.TMDBMatch{}, names: map[string]organizerName{}}
+}
+
+// plan matches a file and sets its destination and expected status
+func (p *organizerPlanner) plan(config *organizerConfig, file *organizerFile) {
+	result := &file.result
+	parsed := ParseFileName(result.SourcePath)
+	result.MediaType = parsed.MediaType
+	result.SeasonNumber = parsed.SeasonNumber
+	result.EpisodeNumber = parsed.EpisodeNumber
+	match, err := p.match(parsed)
+	if err != nil {
+		result.Status, result.Message = OrganizerStatusFailed, "tmdb search failed"
+		return
+	}
+	if match == nil {
+		result.Status, result.Message = database.OrganizerStatusUnmatched, "no tmdb match for "+parsed.Title
+		return
+	}
+	file.tmdbID = match.TMDBID
+	rendered, err := p.render(config, file, parsed)
+	if err != nil {
+		result.Status, result.Message = OrganizerStatusFailed, err.Error()
+		return
+	}
+	destination := filepath.Join(file.destinationRoot, filepath.FromSlash(rendered))
+	if rel, err := filepath.Rel(file.destinationRoot, destination); err != nil || strings.HasPrefix(rel, "..") {
+		result.Status, result.Message = OrganizerStatusFailed, "template renders outside the destination"
+		return
+	}
+	result.DestinationPath = destination
+	result.Status = database.OrganizerStatusDone
+	if destinationInfo, err := os.Lstat(destination); err == nil {
+		result.Conflict = true
+		if sourceInfo, err := os.Stat(result.SourcePath); err == nil && os.SameFile(sourceInfo, destinationInfo) {
+			result.Status, result.Message = database.OrganizerStatusSkipped, "already organized"
+			return
+		}
+		switch config.conflict {
+		case OrganizerConflictSkip:
+			result.Status, result.Message = database.OrganizerStatusSkipped, "destination exists"
+		case OrganizerConflictRename:
+			result.DestinationPath = freePath(destination)
+			result.Message = "destination exists, renamed"
+		case OrganizerConflictOverwrite:
+			result.Message = "destination exists, replaced"
+		}
+	}
+}
+
+// render fills the movie or episode template with names from tmdb, relative to the destination root
+func (p *organizerPlanner) render(config *organizerConfig, file *organizerFile, parsed ParsedFile) (string, error) {
+	result := &file.result
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(result.SourcePath)), ".")
+	if parsed.MediaType == database.MediaTypeMovie {
+		movie, err := p.movieName(file.tmdbID)
+		if err != nil {
+			return "", errors.New("failed to get movie from tmdb")
+		}
+		result.MediaTitle = movie.title
+		file.destinationRoot = config.movieDestination
+		return renderTemplate(config.movieTemplate, templateValues(movie.title, movie.year, nil, nil, "", ext))
+	}
+	show, err := p.showName(file.tmdbID)
+	if err != nil {
+		return "", errors.New("failed to get tv show from tmdb")
+	}
+	episodeTitle := p.episodeTitle(file.tmdbID, *parsed.SeasonNumber, *parsed.EpisodeNumber)
+	result.MediaTitle = show.title
+	file.destinationRoot = config.tvDestination
+	return renderTemplate(config.episodeTemplate,
+		templateValues(show.title, show.year, parsed.SeasonNumber, parsed.EpisodeNumber, episodeTitle, ext))
+}
+
+func (p *organizerPlanner) match(parsed ParsedFile) (*sources.TMDBMatch, error) {
+	if parsed.Title == "" {
+		return nil, nil
+	}
+	year := 0
+	if parsed.Year != nil {
+		year = *parsed.Year
+	}
+	key := fmt.Sprintf("%s:%s:%d", parsed.MediaType, strings.ToLower(parsed.Title), year)
+	if match, ok := p.matches[key]; ok {
+		return match, nil
+	}
+	match, err := sources.SearchByTitleTMDB(parsed.MediaType, parsed.Title, year)
+	if err != nil {
+		return nil, err
+	}
+	p.matches[key] = match
+	return match, nil
+}
+
+func (p *organizerPlanner) movieName(tmdbID int) (organizerName, error) {
+	key := "movie:" + strconv.Itoa(tmdbID)
+	if name, ok := p.names[key]; ok {
+		return name, nil
+	}
+	movie, err := sources.GetMovieFromIDTMDB(tmdbID, nil)
+	if err != nil {
+		return organizerName{}, err
+	}
+	p.names[key] = organizerName{movie.Title, parseYear(movie.ReleaseDate)}
+	return p.names[key], nil
+}
+
+func (p *organizerPlanner) showName(tmdbID int) (organizerName, error) {
+	key := "tvshow:" + strconv.Itoa(tmdbID)
+	if name, ok := p.names[key]; ok {
+		return name, nil
+	}
+	show, err := sources.GetTVShowFromIDTMDB(tmdbID, nil)
+	if err != nil {
+		return organizerName{}, err
+	}
+	p.names[key] = organizerName{show.Name, parseYear(show.FirstAirDate)}
+	return p.names[key], nil
+}
+
+// episodeTitle returns the tmdb episode name, Episode N if the season or episode isn't on tmdb
+func (p *organizerPlanner) episodeTitle(tmdbID int, seasonNumber int, episodeNumber int) string {
+	seasonKey := fmt.Sprintf("season:%d:%d", tmdbID, seasonNumber)
+	if _, ok := p.names[seasonKey]; !ok {
+		p.names[seasonKey] = organizerName{}
+		season, err := sources.GetTVSeasonTMDB(tmdbID, seasonNumber, nil)
+		if err == nil {
+			for _, episode := range season.Episodes {
+				p.names[fmt.Sprintf("episode:%d:%d:%d", tmdbID, seasonNumber, episode.EpisodeNumber)] = organizerName{title: episode.Name}
+			}
+		}
+	}
+	if name, ok := p.names[fmt.Sprintf("episode:%d:%d:%d", tmdbID, seasonNumber, episodeNumber)]; ok && name.title != "" {
+		return name.title
+	}
+	return "Episode " + strconv.Itoa(episodeNumber)
+}
+
+// organizeFile carries out a planned file and logs it, failed files aren't logged
+func organizeFile(config *organizerConfig, file *organizerFile) {
+	result := &file.result
+	if result.Status == OrganizerStatusFailed {
+		return
+	}
+	operation := database.OrganizerOperation{
+		SourcePath:      result.SourcePath,
+		SourceSize:      file.size,
+		SourceModTime:   file.modTime,
+		DestinationRoot: file.destinationRoot,
+		DestinationPath: result.DestinationPath,
+		Mode:            config.mode,
+		Status:          result.Status,
+		Message:         result.Message,
+		MediaType:       result.MediaType,
+		SeasonNumber:    result.SeasonNumber,
+		EpisodeNumber:   result.EpisodeNumber,
+	}
+	if result.Status == database.OrganizerStatusDone {
+		libraryID, err := GetOrAddLibraryID(result.MediaType, sources.SourceTMDB, strconv.Itoa(file.tmdbID))
+		if err != nil {
+			result.Status, result.Message = OrganizerStatusFailed, "failed to add item to library"
+			return
+		}
+		operation.LibraryID = &libraryID
+		if result.Conflict && config.conflict == OrganizerConflictOverwrite {
+			operation.BackupPath = backupPath(result.DestinationPath)
+			if err := os.Rename(result.DestinationPath, operation.BackupPath); err != nil {
+				result.Status, result.Message = OrganizerStatusFailed, "failed to back up existing destination"
+				return
+			}
+		}
+		if err := transferFile(config.mode, result.SourcePath, result.DestinationPath); err != nil {
+			if operation.BackupPath != "" {
+				_ = os.Rename(operation.BackupPath, result.DestinationPath)
+			}
+			result.Status, result.Message = OrganizerStatusFailed, err.Error()
+			return
+		}
+	}
+	if err := database.AddOrganizerOperation(&operation); err != nil {
+		result.Message = "organized but not logged, can't be undone"
+		return
+	}
+	result.OperationID = &operation.OperationID
+}
+
+// UndoOrganizerOperation reverts a done operation: moved files go back to the inbox, copies and
+// links are deleted and a replaced destination is restored
+func UndoOrganizerOperation(operationID int64) (*database.OrganizerOperation, error) {
+	organizerMutex.Lock()
+	defer organizerMutex.Unlock()
+	operation, err := database.GetOrganizerOperation(operationID)
+	if err != nil {
+		return nil, err
+	}
+	if operation.Status != database.OrganizerStatusDone {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Only done operations can be undone")
+	}
+	if operation.Mode == OrganizerModeMove {
+		if _, err := os.Lstat(operation.SourcePath); err == nil {
+			return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "A file exists at the original path")
+		}
+		if err := transferFile(OrganizerModeMove, operation.DestinationPath, operation.SourcePath); err != nil {
+			return nil, helpers.LogErrorWithMessage(errors.New(helpers.InternalServerError), "Failed to move file back: "+err.Error())
+		}
+	} else if err := os.Remove(operation.DestinationPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.InternalServerError), "Failed to remove organized file")
+	}
+	if operation.BackupPath != "" {
+		if err := os.Rename(operation.BackupPath, operation.DestinationPath); err != nil {
+			return nil, helpers.LogErrorWithMessage(errors.New(helpers.InternalServerError), "Failed to restore replaced file")
+		}
+	} else {
+		removeEmptyDirs(filepath.Dir(operation.DestinationPath), operation.DestinationRoot)
+	}
+	if err := database.SetOrganizerOperationUndone(operationID); err != nil {
+		return nil, err
+	}
+	_ = StartScan()
+	return database.GetOrganizerOperation(operationID)
+}
+
+// transferFile copies, hardlinks or moves source to destination, creating directories.
+// Moves across file systems fall back to copy and delete
+func transferFile(mode string, source string, destination string) error {
+	if err := os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+		return errors.New("failed to create destination directory")
+	}
+	switch mode {
+	case OrganizerModeHardlink:
+		if err := os.Link(source, destination); err != nil {
+			return errors.New("failed to hardlink, source and destination must be on the same file system")
+		}
+	case OrganizerModeMove:
+		if err := os.Rename(source, destination); err != nil {
+			if err := copyFile(source, destination); err != nil {
+				return err
+			}
+			if err := os.Remove(source); err != nil {
+				return errors.New("copied but failed to remove source")
+			}
+		}
+	default:
+		return copyFile(source, destination)
+	}
+	return nil
+}
+
+// copyFile copies through a hidden partial file so scans never see half-copied files
+func copyFile(source string, destination string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return errors.New("failed to open source")
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return errors.New("failed to stat source")
+	}
+	partial := filepath.Join(filepath.Dir(destination), "."+filepath.Base(destination)+".partial")
+	out, err := os.OpenFile(partial, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return errors.New("failed to create destination")
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(partial)
+		return errors.New("failed to copy file")
+	}
+	_ = os.Chtimes(partial, info.ModTime(), info.ModTime())
+	if err := os.Rename(partial, destination); err != nil {
+		_ = os.Remove(partial)
+		return errors.New("failed to rename copied file")
+	}
+	return nil
+}
+
+// freePath returns the first of "name (1).ext", "name (2).ext"... that doesn't exist
+func freePath(path string) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for num := 1; ; num++ {
+		candidate := fmt.Sprintf("%s (%d)%s", base, num, ext)
+		if _, err := os.Lstat(candidate); err != nil {
+			return candidate
+		}
+	}
+}
+
+// backupPath is hidden so scans skip it
+func backupPath(path string) string {
+	return filepath.Join(filepath.Dir(path), fmt.Sprintf(".%s.hound-backup-%d", filepath.Base(path), time.Now().UnixNano()))
+}
+
+// removeEmptyDirs removes dir and its empty parents up to, not including, root
+func removeEmptyDirs(dir string, root string) {
+	for dir != root && strings.HasPrefix(dir, root+string(filepath.Separator)) {
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+func templateValues(title string, year int, seasonNumber *int, episodeNumber *int, episodeTitle string, ext string) map[string]interface{} {
+	values := map[string]interface{}{"year": year, "ext": ext}
+	if seasonNumber == nil {
+		values["title"] = title
+		return values
+	}
+	values["show"] = title
+	values["title"] = episodeTitle
+	values["season"] = *seasonNumber
+	values["episode"] = *episodeNumber
+	return values
+}
+
+// renderTemplate fills {name} and zero padded {name:02} placeholders, values are made safe for file names
+func renderTemplate(template string, values map[string]interface{}) (string, error) {
+	var renderErr error
+	rendered := templateRegex.ReplaceAllStringFunc(template, func(placeholder string) string {
+		match := templateRegex.FindStringSubmatch(placeholder)
+		value, ok := values[match[1]]
+		if !ok {
+			renderErr = helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Unknown organizer template placeholder "+placeholder)
+			return ""
+		}
+		switch value := value.(type) {
+		case int:
+			if match[2] != "" {
+				width, _ := strconv.Atoi(match[2])
+				return fmt.Sprintf("%0*d", width, value)
+			}
+			return strconv.Itoa(value)
+		default:
+			return strings.Trim(unsafeNameReplacer.Replace(fmt.Sprint(value)), " .")
+		}
+	})
+	if renderErr != nil {
+		return "", renderErr
+	}
+	return rendered, nil
+}
+
+// parseYear reads the year of a tmdb date (2019-05-01), 0 if missing
+func parseYear(date string) int {
+	if len(date) < 4 {
+		return 0
+	}
+	year, _ := strconv.Atoi(date[:4])
+	return year
+}
@@ -0,0 +1,158 @@
+package media
+
+import (
+	"fmt"
+	"hound/model/database"
+	"hound/model/sources"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestOrganizerRunsOncePerFile organizes an inbox file and polls the inbox again,
+// the file's mod time has fractional seconds, which the log doesn't store.
+// Needs a database, set DB_DRIVER and DB_CONNECTION_STRING
+func TestOrganizerRunsOncePerFile(t *testing.T) {
+	if os.Getenv("DB_DRIVER") == "" || os.Getenv("DB_CONNECTION_STRING") == "" {
+		t.Skip("DB_DRIVER and DB_CONNECTION_STRING not set")
+	}
+	database.InstantiateDB()
+	inbox := t.TempDir()
+	path := filepath.Join(inbox, "Organizer.Test.2001.1080p.mkv")
+	if err := os.WriteFile(path, []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Unix(time.Now().Add(-time.Hour).Unix(), 123456789)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	config := &organizerConfig{
+		inbox:    inbox,
+		mode:     OrganizerModeCopy,
+		conflict: OrganizerConflictSkip,
+	}
+
+	files, err := findInboxFiles(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("first run found %d files, expected 1", len(files))
+	}
+	// no tmdb lookups, the file is logged as unmatched
+	files[0].result.Status = database.OrganizerStatusUnmatched
+	organizeFile(config, files[0])
+	if files[0].result.OperationID == nil {
+		t.Fatalf("file wasn't logged: %s", files[0].result.Message)
+	}
+	operationID := *files[0].result.OperationID
+	t.Cleanup(func() {
+		if err := database.DeleteOrganizerOperation(operationID); err != nil {
+			t.Error(err)
+		}
+	})
+
+	files, err = findInboxFiles(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Fatalf("second run found %d files, expected the logged file to be skipped", len(files))
+	}
+}
+
+func TestRenderTemplate(t *testing.T) {
+	seasonNumber, episodeNumber := 1, 7
+	episodeValues := templateValues("Show", 2010, &seasonNumber, &episodeNumber, "Pilot", "mkv")
+	tests := []struct {
+		name     string
+		template string
+		values   map[string]interface{}
+		expected string
+		fails    bool
+	}{
+		{"padding", "{show}/Season {season:02}/{show} - S{season:02}E{episode:03}.{ext}", episodeValues, "Show/Season 01/Show - S01E007.mkv", false},
+		{"no padding", "{season}x{episode}", episodeValues, "1x7", false},
+		{"wider than padding", "{year:02}", episodeValues, "2010", false},
+		{"movie", "{title} ({year})/{title} ({year}).{ext}", templateValues("Heat", 1995, nil, nil, "", "mkv"), "Heat (1995)/Heat (1995).mkv", false},
+		{"unknown placeholder", "{show}/{resolution}.{ext}", episodeValues, "", true},
+		{"show placeholder for movies", "{show}.{ext}", templateValues("Heat", 1995, nil, nil, "", "mkv"), "", true},
+		{"unsafe characters", "{title}", map[string]interface{}{"title": `AC/DC: Live? "Now" <1> | *x*`}, "AC-DC - Live 'Now' 1 - x", false},
+		{"backslashes", "{title}", map[string]interface{}{"title": `a\b`}, "a-b", false},
+		{"leading and trailing dots", "{title}.{ext}", map[string]interface{}{"title": " ..Hidden. ", "ext": "mkv"}, "Hidden.mkv", false},
+		{"dot dot title", "{title}/x", map[string]interface{}{"title": ".."}, "/x", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rendered, err := renderTemplate(test.template, test.values)
+			if test.fails {
+				if err == nil {
+					t.Fatalf("expected an error, rendered %q", rendered)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rendered != test.expected {
+				t.Fatalf("rendered %q, expected %q", rendered, test.expected)
+			}
+		})
+	}
+}
+
+// TestPlanStaysInDestination plans a movie with templates that try to leave the destination,
+// the planner's caches are filled so tmdb isn't called
+func TestPlanStaysInDestination(t *testing.T) {
+	tests := []struct {
+		name     string
+		title    string
+		template string
+		escapes  bool
+	}{
+		{"template", "Heat", "{title} ({year})/{title}.{ext}", false},
+		{"parent directory", "Heat", "../{title}.{ext}", true},
+		{"parent directory after title", "Heat", "{title}/../../{title}.{ext}", true},
+		{"dot dot in the middle", "Heat", "{title}/../{title}.{ext}", false},
+		{"path in title", "../../etc/passwd", "{title}.{ext}", false},
+		{"dot dot title", "..", "{title}/../{title}.{ext}", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			destination := t.TempDir()
+			source := filepath.Join(t.TempDir(), "Heat.1995.1080p.mkv")
+			parsed := ParseFileName(source)
+			if parsed.MediaType != database.MediaTypeMovie || parsed.Year == nil {
+				t.Fatalf("%s parsed as %+v", source, parsed)
+			}
+			planner := newOrganizerPlanner()
+			key := fmt.Sprintf("%s:%s:%d", parsed.MediaType, strings.ToLower(parsed.Title), *parsed.Year)
+			planner.matches[key] = &sources.TMDBMatch{MediaType: database.MediaTypeMovie, TMDBID: 949}
+			planner.names["movie:949"] = organizerName{test.title, 1995}
+			config := &organizerConfig{
+				mode:             OrganizerModeCopy,
+				conflict:         OrganizerConflictSkip,
+				movieDestination: destination,
+				movieTemplate:    test.template,
+			}
+			file := &organizerFile{result: OrganizerResult{SourcePath: source, Mode: config.mode}}
+
+			planner.plan(config, file)
+			if test.escapes {
+				if file.result.Status != OrganizerStatusFailed {
+					t.Fatalf("status %s, expected failed for destination %q", file.result.Status, file.result.DestinationPath)
+				}
+				return
+			}
+			if file.result.Status != database.OrganizerStatusDone {
+				t.Fatalf("status %s: %s", file.result.Status, file.result.Message)
+			}
+			rel, err := filepath.Rel(destination, file.result.DestinationPath)
+			if err != nil || strings.HasPrefix(rel, "..") {
+				t.Fatalf("destination %q is outside %q", file.result.DestinationPath, destination)
+			}
+		})
+	}
+}
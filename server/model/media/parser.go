@@ -0,0 +1,95 @@
+package media
+
+import (
+	"hound/model/database"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// VideoExtensions are the file types picked up by scans
+var VideoExtensions = map[string]bool{
+	".mkv":  true,
+	".mp4":  true,
+	".m4v":  true,
+	".webm": true,
+	".avi":  true,
+	".mov":  true,
+	".wmv":  true,
+	".ts":   true,
+}
+
+var (
+	// Show.Name.S02E05, Show Name - s2e5, Show.Name.2x05
+	episodeRegex = regexp.MustCompile(`(?i)^(.*?)[\s._\-\[(]*\bs(\d{1,2})[\s._\-]*e(\d{1,3})\b|^(.*?)[\s._\-\[(]*\b(\d{1,2})x(\d{2,3})\b`)
+	// Movie (2019), Movie.2019.1080p, the last year wins so titles can contain years
+	yearRegex = regexp.MustCompile(`^(.*)[\s._\-\[(]+((?:19|20)\d{2})(?:[\s._\-\])]|$)`)
+	// release tags that end a title when there is no year
+	releaseTagRegex = regexp.MustCompile(`(?i)[\s._\-\[(]+(?:2160p|1080p|720p|480p|4k|uhd|bluray|blu-ray|brrip|bdrip|web-?dl|webrip|hdtv|dvdrip|x264|x265|h\.?264|h\.?265|hevc|remux|proper|repack)\b`)
+	// Season 2, S02 directories
+	seasonDirRegex = regexp.MustCompile(`(?i)^(?:season[\s._\-]*\d+|s\d{1,2}|specials)$`)
+	separatorRegex = regexp.MustCompile(`[._]+`)
+	spacesRegex    = regexp.MustCompile(`\s+`)
+)
+
+// ParsedFile is what can be read from a video file's name
+type ParsedFile struct {
+	MediaType     string // movie or tvshow
+	Title         string
+	Year          *int
+	SeasonNumber  *int
+	EpisodeNumber *int
+}
+
+// ParseFileName reads title, year and episode from a path like
+// /tv/Show.Name.S02E05.1080p.mkv or /movies/Movie (2019)/Movie (2019).mkv.
+// Episodes without a title in the file name take it from the show directory
+func ParseFileName(path string) ParsedFile {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if match := episodeRegex.FindStringSubmatch(name); match != nil {
+		title, season, episode := match[1], match[2], match[3]
+		if match[2] == "" {
+			title, season, episode = match[4], match[5], match[6]
+		}
+		seasonNumber, _ := strconv.Atoi(season)
+		episodeNumber, _ := strconv.Atoi(episode)
+		parsed := ParsedFile{
+			MediaType:     database.MediaTypeTVShow,
+			SeasonNumber:  &seasonNumber,
+			EpisodeNumber: &episodeNumber,
+		}
+		parsed.Title, parsed.Year = parseTitle(title)
+		if parsed.Title == "" {
+			parsed.Title, parsed.Year = parseTitle(showDirectory(path))
+		}
+		return parsed
+	}
+	parsed := ParsedFile{MediaType: database.MediaTypeMovie}
+	parsed.Title, parsed.Year = parseTitle(name)
+	return parsed
+}
+
+// parseTitle splits a name into a clean title and the release year if present
+func parseTitle(name string) (string, *int) {
+	var year *int
+	if match := yearRegex.FindStringSubmatch(name); match != nil && strings.TrimSpace(match[1]) != "" {
+		value, _ := strconv.Atoi(match[2])
+		year = &value
+		name = match[1]
+	} else if loc := releaseTagRegex.FindStringIndex(name); loc != nil {
+		name = name[:loc[0]]
+	}
+	name = separatorRegex.ReplaceAllString(name, " ")
+	name = strings.Trim(name, " -[](")
+	return spacesRegex.ReplaceAllString(name, " "), year
+}
+
+// showDirectory returns the directory above season directories, eg. Show Name for Show Name/Season 2/S02E05.mkv
+func showDirectory(path string) string {
+	dir := filepath.Dir(path)
+	if seasonDirRegex.MatchString(filepath.Base(dir)) {
+		dir = filepath.Dir(dir)
+	}
+	return filepath.Base(dir)
+}
@@ -0,0 +1,341 @@
+package media
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"hound/helpers"
+	"hound/model/database"
+	"hound/model/sources"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+	Media scanner - walks media.library-roots for video files, parses their names and
+	matches them to tmdb. Rescans only re-match files whose size or mtime changed,
+	manual matches are kept, files tmdb failed to answer for are retried. Files under a root or
+	directory that can't be read are left alone
+*/
+
+// max scan errors kept on the status
+const scanMaxErrors = 50
+
+type ScanStatus struct {
+	IsRunning      bool       `json:"is_running"`
+	StartedAt      *time.Time `json:"started_at"`
+	FinishedAt     *time.Time `json:"finished_at"`
+	FilesFound     int        `json:"files_found"`
+	FilesAdded     int        `json:"files_added"`
+	FilesUpdated   int        `json:"files_updated"`
+	FilesUnchanged int        `json:"files_unchanged"`
+	FilesRemoved   int        `json:"files_removed"`
+	FilesMatched   int        `json:"files_matched"`
+	FilesUnmatched int        `json:"files_unmatched"`
+	Errors         []string   `json:"errors"`
+}
+
+var (
+	scanStatus = ScanStatus{Errors: []string{}}
+	scanMutex  sync.Mutex
+)
+
+// InitializeMediaScanner starts periodic scans, disabled if media.scan-interval <= 0
+func InitializeMediaScanner() {
+	interval := viper.GetInt("media.scan-interval")
+	if interval <= 0 || len(GetLibraryRoots()) == 0 {
+		fmt.Println(helpers.WarnMsg("Media scanner disabled"))
+		return
+	}
+	go func() {
+		_ = StartScan()
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			_ = StartScan()
+		}
+	}()
+}
+
+// GetLibraryRoots returns the configured library roots as clean absolute paths
+func GetLibraryRoots() []string {
+	var roots []string
+	for _, root := range viper.GetStringSlice("media.library-roots") {
+		absolute, err := filepath.Abs(root)
+		if err != nil {
+			continue
+		}
+		roots = append(roots, absolute)
+	}
+	return roots
+}
+
+// GetScanStatus returns the progress of the running scan or the result of the last one
+func GetScanStatus() ScanStatus {
+	scanMutex.Lock()
+	defer scanMutex.Unlock()
+	status := scanStatus
+	status.Errors = append([]string{}, scanStatus.Errors...)
+	return status
+}
+
+// StartScan scans the library roots in the background, errors if a scan is already running
+func StartScan() error {
+	roots := GetLibraryRoots()
+	if len(roots) == 0 {
+		return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "No media.library-roots configured")
+	}
+	scanMutex.Lock()
+	defer scanMutex.Unlock()
+	if scanStatus.IsRunning {
+		return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "A media scan is already running")
+	}
+	now := time.Now()
+	scanStatus = ScanStatus{IsRunning: true, StartedAt: &now, Errors: []string{}}
+	go scan(roots)
+	return nil
+}
+
+func scan(roots []string) {
+	defer func() {
+		scanMutex.Lock()
+		now := time.Now()
+		scanStatus.IsRunning = false
+		scanStatus.FinishedAt = &now
+		status := scanStatus
+		scanMutex.Unlock()
+		fmt.Println(helpers.InfoMsg(fmt.Sprintf("Media scan finished: %d files, %d added, %d updated, %d removed, %d unmatched",
+			status.FilesFound, status.FilesAdded, status.FilesUpdated, status.FilesRemoved, status.FilesUnmatched)))
+	}()
+	known, err := database.GetAllMediaFiles()
+	if err != nil {
+		addScanError("failed to load media files")
+		return
+	}
+	knownFiles := map[string]database.MediaFile{}
+	for _, file := range known {
+		knownFiles[file.Path] = file
+	}
+	matcher := newMatcher()
+	seen := map[string]bool{}
+	unreadableRoots := map[string]bool{}
+	// directories and files that failed to read during the walk, known files under them are kept
+	var unreadablePaths []string
+	for _, root := range roots {
+		if _, err := os.Stat(root); err != nil {
+			unreadableRoots[root] = true
+			addScanError("library root not readable: " + root)
+			continue
+		}
+		_ = filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				unreadablePaths = append(unreadablePaths, path)
+				addScanError("failed to read " + path)
+				return nil
+			}
+			if strings.HasPrefix(entry.Name(), ".") && path != root {
+				if entry.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if entry.IsDir() || !VideoExtensions[strings.ToLower(filepath.Ext(path))] {
+				return nil
+			}
+			info, err := entry.Info()
+			if err != nil {
+				unreadablePaths = append(unreadablePaths, path)
+				addScanError("failed to stat " + path)
+				return nil
+			}
+			seen[path] = true
+			updateScanStatus(func(status *ScanStatus) { status.FilesFound++ })
+			scanFile(root, path, info, knownFiles, matcher)
+			return nil
+		})
+	}
+	var removed []int64
+	for path, file := range knownFiles {
+		if !seen[path] && !unreadableRoots[file.LibraryRoot] && !isUnderPaths(path, unreadablePaths) {
+			removed = append(removed, file.FileID)
+		}
+	}
+	if err := database.DeleteMediaFiles(removed); err != nil {
+		addScanError("failed to remove missing files")
+		return
+	}
+	updateScanStatus(func(status *ScanStatus) { status.FilesRemoved = len(removed) })
+}
+
+// isUnderPaths checks whether path is one of paths or inside one of them
+func isUnderPaths(path string, paths []string) bool {
+	for _, parent := range paths {
+		if path == parent || strings.HasPrefix(path, strings.TrimSuffix(parent, string(os.PathSeparator))+string(os.PathSeparator)) {
+			return true
+		}
+	}
+	return false
+}
+
+func scanFile(root string, path string, info fs.FileInfo, knownFiles map[string]database.MediaFile, matcher *matcher) {
+	existing, isKnown := knownFiles[path]
+	// mtimes are stored in a DATETIME column, without fractional seconds
+	modTime := info.ModTime().Truncate(time.Second)
+	if isKnown && existing.Size == info.Size() && existing.ModTime.Equal(modTime) {
+		updateScanStatus(func(status *ScanStatus) {
+			status.FilesUnchanged++
+			if existing.LibraryID == nil {
+				status.FilesUnmatched++
+			}
+		})
+		return
+	}
+	file := database.MediaFile{
+		Path:        path,
+		LibraryRoot: root,
+		Size:        info.Size(),
+		ModTime:     modTime,
+	}
+	if isKnown {
+		file.FileID = existing.FileID
+	}
+	parsed := ParseFileName(path)
+	file.MediaType = parsed.MediaType
+	file.ParsedTitle = parsed.Title
+	file.ParsedYear = parsed.Year
+	file.SeasonNumber = parsed.SeasonNumber
+	file.EpisodeNumber = parsed.EpisodeNumber
+	if isKnown && existing.MatchStatus == database.MediaFileStatusManual {
+		// replaced file, keep the admin's match
+		file.LibraryID = existing.LibraryID
+		file.MediaType = existing.MediaType
+		file.SeasonNumber = existing.SeasonNumber
+		file.EpisodeNumber = existing.EpisodeNumber
+		file.MatchStatus = database.MediaFileStatusManual
+	} else {
+		libraryID, err := matcher.match(parsed)
+		if err != nil {
+			// not saved, the new size and mtime would skip the file on later scans.
+			// Known files keep their previous row, new files are added once tmdb answers
+			addScanError(fmt.Sprintf("failed to match %s: %s", path, err.Error()))
+			return
+		}
+		file.LibraryID = libraryID
+		file.MatchStatus = database.MediaFileStatusMatched
+		if libraryID == nil {
+			file.MatchStatus = database.MediaFileStatusUnmatched
+		}
+	}
+	if err := database.UpsertMediaFile(&file); err != nil {
+		addScanError("failed to save " + path)
+		return
+	}
+	updateScanStatus(func(status *ScanStatus) {
+		if isKnown {
+			status.FilesUpdated++
+		} else {
+			status.FilesAdded++
+		}
+		if file.LibraryID == nil {
+			status.FilesUnmatched++
+		} else {
+			status.FilesMatched++
+		}
+	})
+}
+
+// matcher caches title lookups for the duration of a scan, an episode file per show only searches once
+type matcher struct {
+	libraryIDs map[string]*int64
+}
+
+func newMatcher() *matcher {
+	return &matcher{libraryIDs: map[string]*int64{}}
+}
+
+// match searches tmdb by title and year, returns nil if nothing was found
+func (m *matcher) match(parsed ParsedFile) (*int64, error) {
+	if parsed.Title == "" {
+		return nil, nil
+	}
+	year := 0
+	if parsed.Year != nil {
+		year = *parsed.Year
+	}
+	key := fmt.Sprintf("%s:%s:%d", parsed.MediaType, strings.ToLower(parsed.Title), year)
+	if libraryID, ok := m.libraryIDs[key]; ok {
+		return libraryID, nil
+	}
+	result, err := sources.SearchByTitleTMDB(parsed.MediaType, parsed.Title, year)
+	if err != nil {
+		return nil, err
+	}
+	var libraryID *int64
+	if result != nil {
+		id, err := GetOrAddLibraryID(result.MediaType, sources.SourceTMDB, strconv.Itoa(result.TMDBID))
+		if err != nil {
+			return nil, err
+		}
+		libraryID = &id
+	}
+	m.libraryIDs[key] = libraryID
+	return libraryID, nil
+}
+
+// GetOrAddLibraryID returns the library id of an item, fetching it from its source if it isn't in the library yet
+func GetOrAddLibraryID(mediaType string, mediaSource string, sourceID string) (int64, error) {
+	if libraryID, err := database.GetInternalLibraryID(mediaType, mediaSource, sourceID); err == nil {
+		return *libraryID, nil
+	}
+	record, err := sources.GetLibraryObject(mediaType, mediaSource, sourceID)
+	if err != nil {
+		return -1, err
+	}
+	return database.AddRecordToInternalLibrary(record)
+}
+
+func updateScanStatus(update func(status *ScanStatus)) {
+	scanMutex.Lock()
+	defer scanMutex.Unlock()
+	update(&scanStatus)
+}
+
+func addScanError(message string) {
+	_ = helpers.LogErrorWithMessage(errors.New(helpers.InternalServerError), "Media scan: "+message)
+	updateScanStatus(func(status *ScanStatus) {
+		if len(status.Errors) < scanMaxErrors {
+			status.Errors = append(status.Errors, message)
+		}
+	})
+}
+
+// MatchMediaFile links a file to an item by hand, tv show files need a season and episode.
+// Manual matches are kept by later scans
+func MatchMediaFile(fileID int64, mediaType string, mediaSource string, sourceID string, seasonNumber *int, episodeNumber *int) (*database.MediaFile, error) {
+	if _, err := database.GetMediaFile(fileID); err != nil {
+		return nil, err
+	}
+	if _, err := sources.GetSourceForMediaType(mediaType, mediaSource); err != nil {
+		return nil, err
+	}
+	if mediaType == database.MediaTypeTVShow {
+		if seasonNumber == nil || episodeNumber == nil || *seasonNumber < 0 || *episodeNumber < 0 {
+			return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "season_number and episode_number are required for tv shows")
+		}
+	} else {
+		seasonNumber, episodeNumber = nil, nil
+	}
+	libraryID, err := GetOrAddLibraryID(mediaType, mediaSource, sourceID)
+	if err != nil {
+		return nil, err
+	}
+	if err := database.SetMediaFileMatch(fileID, libraryID, mediaType, seasonNumber, episodeNumber, database.MediaFileStatusManual); err != nil {
+		return nil, err
+	}
+	return database.GetMediaFile(fileID)
+}
@@ -0,0 +1,185 @@
+package media
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"hound/helpers"
+	"hound/model"
+	"hound/model/database"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+	Streaming - serves matched media files. Players that can't send the auth cookie or
+	header get a short-lived url signed with JWT_SECRET_KEY. The byte offset of range
+	requests is reported as playback progress, an estimate since bitrates vary
+*/
+
+const (
+	StreamAPIPath = "/api/v1/stream/"
+	// players read the end of a file when they open it (eg. mp4 indexes), requests this soon
+	// after the file was opened aren't progress
+	streamProbeWindow = 30 * time.Second
+	// a request from offset 0 or after this long without requests opens the file again
+	streamSessionGap = 5 * time.Minute
+	streamSessionTTL = 12 * time.Hour
+	// runtime used when tmdb has none, tmdb often has no episode run time for newer shows
+	streamFallbackMovieRuntime   = 100
+	streamFallbackEpisodeRuntime = 45
+)
+
+// MimeTypes of streamable files, browsers only play some of these
+var MimeTypes = map[string]string{
+	".mkv":  "video/x-matroska",
+	".mp4":  "video/mp4",
+	".m4v":  "video/x-m4v",
+	".webm": "video/webm",
+	".avi":  "video/x-msvideo",
+	".mov":  "video/quicktime",
+	".wmv":  "video/x-ms-wmv",
+	".ts":   "video/mp2t",
+}
+
+func GetMimeType(path string) string {
+	if mimeType, ok := MimeTypes[strings.ToLower(filepath.Ext(path))]; ok {
+		return mimeType
+	}
+	return "application/octet-stream"
+}
+
+// SignStreamURL returns a stream url for the file that works without other auth until it expires,
+// valid for media.stream-url-expiration seconds
+func SignStreamURL(fileID int64, username string) (string, time.Time) {
+	expiration := viper.GetInt("media.stream-url-expiration")
+	if expiration <= 0 {
+		expiration = 14400
+	}
+	expiresAt := time.Now().Add(time.Duration(expiration) * time.Second)
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+	query := url.Values{}
+	query.Set("user", username)
+	query.Set("expires", expires)
+	query.Set("signature", signStream(strconv.FormatInt(fileID, 10), username, expires))
+	return StreamAPIPath + strconv.FormatInt(fileID, 10) + "?" + query.Encode(), expiresAt
+}
+
+// VerifyStreamSignature checks a signed stream url, the user must still be enabled
+func VerifyStreamSignature(fileID string, username string, expires string, signature string) error {
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return helpers.LogErrorWithMessage(errors.New(helpers.Unauthorized), "Invalid stream url expiry")
+	}
+	if time.Now().Unix() > expiresAt {
+		return helpers.LogErrorWithMessage(errors.New(helpers.Unauthorized), "Stream url expired")
+	}
+	if !hmac.Equal([]byte(signature), []byte(signStream(fileID, username, expires))) {
+		return helpers.LogErrorWithMessage(errors.New(helpers.Unauthorized), "Invalid stream url signature")
+	}
+	user, err := database.GetUser(username)
+	if err != nil || user.IsDisabled {
+		return helpers.LogErrorWithMessage(errors.New(helpers.Unauthorized), "Stream url user is disabled or deleted")
+	}
+	return nil
+}
+
+func signStream(fileID string, username string, expires string) string {
+	mac := hmac.New(sha256.New, []byte(os.Getenv("JWT_SECRET_KEY")))
+	mac.Write([]byte("stream:" + fileID + ":" + username + ":" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// OpenMediaFile opens a matched file for streaming, the caller closes it.
+// Files outside the configured library roots are refused, eg. after a root was removed from the config
+func OpenMediaFile(fileID int64) (*database.MediaFile, *os.File, error) {
+	file, err := database.GetMediaFile(fileID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if file.LibraryID == nil {
+		return nil, nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Media file is not matched")
+	}
+	if !IsInLibraryRoot(file.Path) {
+		return nil, nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Media file is outside the library roots")
+	}
+	osFile, err := os.Open(file.Path)
+	if err != nil {
+		return nil, nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Media file is missing, rescan the library")
+	}
+	return file, osFile, nil
+}
+
+// IsInLibraryRoot checks that path is inside one of the configured library roots
+func IsInLibraryRoot(path string) bool {
+	for _, root := range GetLibraryRoots() {
+		rel, err := filepath.Rel(root, path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// streamSession is one opening of a file by a player, tracked across its range requests
+type streamSession struct {
+	openedAt      time.Time
+	lastRequestAt time.Time
+}
+
+// RecordStreamProgress reports the position of a range request as playback progress,
+// estimated from the offset and the runtime of the item
+func RecordStreamProgress(userID int64, file *database.MediaFile, offset int64) error {
+	if file.LibraryID == nil || file.Size <= 0 {
+		return nil
+	}
+	now := time.Now()
+	sessionKey := fmt.Sprintf("stream-session-%d-%d", userID, file.FileID)
+	session := streamSession{openedAt: now, lastRequestAt: now}
+	if cached, ok := model.GetCache(sessionKey); ok {
+		previous := cached.(streamSession)
+		if offset > 0 && now.Sub(previous.lastRequestAt) < streamSessionGap {
+			session.openedAt = previous.openedAt
+		}
+	}
+	_ = model.UpdateOrSetCache(sessionKey, session, streamSessionTTL)
+	if now.Sub(session.openedAt) < streamProbeWindow {
+		return nil
+	}
+	records, err := database.GetLibraryRecords([]int64{*file.LibraryID})
+	if err != nil || len(records) == 0 {
+		return err
+	}
+	runtime := model.GetRuntime(records[0])
+	if runtime == 0 {
+		runtime = streamFallbackMovieRuntime
+		if file.SeasonNumber != nil {
+			runtime = streamFallbackEpisodeRuntime
+		}
+	}
+	duration := runtime * 60
+	position := int(float64(offset) / float64(file.Size) * float64(duration))
+	_, err = model.ReportProgress(userID, *file.LibraryID, file.SeasonNumber, file.EpisodeNumber, position, duration)
+	return err
+}
+
+// ParseRangeStart returns the first byte offset of a Range header, 0 if there is none.
+// Suffix ranges (bytes=-500) are treated as 0, players use them to read file indexes
+func ParseRangeStart(rangeHeader string) int64 {
+	if !strings.HasPrefix(rangeHeader, "bytes=") {
+		return 0
+	}
+	first := strings.Split(strings.TrimPrefix(rangeHeader, "bytes="), ",")[0]
+	start, err := strconv.ParseInt(strings.TrimSpace(strings.SplitN(first, "-", 2)[0]), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return start
+}
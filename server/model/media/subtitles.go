@@ -0,0 +1,256 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"hound/helpers"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+/*
+	Subtitles - sidecar subtitle files next to a video, eg. Movie (2019).en.srt or
+	Show.S01E02.eng.forced.ass. Files in a Subs/Subtitles folder next to the video
+	are also picked up. If a directory has a single video, every subtitle in it belongs
+	to that video. SRT is converted to WebVTT for browsers
+*/
+
+const (
+	SubtitleFormatSRT = "srt"
+	SubtitleFormatASS = "ass"
+	SubtitleFormatVTT = "vtt"
+)
+
+var subtitleExtensions = map[string]string{
+	".srt": SubtitleFormatSRT,
+	".ass": SubtitleFormatASS,
+	".ssa": SubtitleFormatASS,
+	".vtt": SubtitleFormatVTT,
+}
+
+var SubtitleMimeTypes = map[string]string{
+	SubtitleFormatSRT: "application/x-subrip",
+	SubtitleFormatASS: "text/x-ssa",
+	SubtitleFormatVTT: "text/vtt",
+}
+
+// subtitle folders in release directories
+var subtitleDirs = map[string]bool{"subs": true, "subtitles": true}
+
+// iso 639-2 codes and english names to iso 639-1
+var subtitleLanguages = map[string]string{
+	"eng": "en", "english": "en",
+	"spa": "es", "spanish": "es",
+	"fre": "fr", "fra": "fr", "french": "fr",
+	"ger": "de", "deu": "de", "german": "de",
+	"ita": "it", "italian": "it",
+	"por": "pt", "portuguese": "pt",
+	"dut": "nl", "nld": "nl", "dutch": "nl",
+	"swe": "sv", "swedish": "sv",
+	"nor": "no", "norwegian": "no",
+	"dan": "da", "danish": "da",
+	"fin": "fi", "finnish": "fi",
+	"pol": "pl", "polish": "pl",
+	"rus": "ru", "russian": "ru",
+	"ukr": "uk", "ukrainian": "uk",
+	"cze": "cs", "ces": "cs", "czech": "cs",
+	"hun": "hu", "hungarian": "hu",
+	"rum": "ro", "ron": "ro", "romanian": "ro",
+	"gre": "el", "ell": "el", "greek": "el",
+	"tur": "tr", "turkish": "tr",
+	"ara": "ar", "arabic": "ar",
+	"heb": "he", "hebrew": "he",
+	"hin": "hi", "hindi": "hi",
+	"jpn": "ja", "japanese": "ja",
+	"kor": "ko", "korean": "ko",
+	"chi": "zh", "zho": "zh", "chinese": "zh",
+	"tha": "th", "thai": "th",
+	"vie": "vi", "vietnamese": "vi",
+	"ind": "id", "indonesian": "id",
+}
+
+var (
+	// eg. pt-br, zh-tw
+	subtitleRegionRegex = regexp.MustCompile(`^([a-z]{2})-([a-z]{2})$`)
+	// 00:01:02,500 --> 00:01:04,000
+	srtTimingRegex = regexp.MustCompile(`(\d{2}:\d{2}:\d{2}),(\d{3})\s*-->\s*(\d{2}:\d{2}:\d{2}),(\d{3})`)
+)
+
+type Subtitle struct {
+	Name     string // file name, relative to the video directory
+	Path     string
+	Format   string  // srt, ass or vtt
+	Language *string // iso 639-1, with region if present (pt-BR), nil if unknown
+	Forced   bool    // only foreign dialogue
+	SDH      bool    // for the deaf and hard of hearing
+}
+
+// FindSubtitles lists the sidecar subtitles of a video, sorted by language then name
+func FindSubtitles(videoPath string) []Subtitle {
+	dir := filepath.Dir(videoPath)
+	videoName := strings.TrimSuffix(filepath.Base(videoPath), filepath.Ext(videoPath))
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return []Subtitle{}
+	}
+	videos := 0
+	var candidates []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		if entry.IsDir() && subtitleDirs[strings.ToLower(entry.Name())] {
+			subEntries, err := os.ReadDir(filepath.Join(dir, entry.Name()))
+			if err != nil {
+				continue
+			}
+			for _, subEntry := range subEntries {
+				if !subEntry.IsDir() {
+					candidates = append(candidates, filepath.Join(entry.Name(), subEntry.Name()))
+				}
+			}
+			continue
+		}
+		if VideoExtensions[strings.ToLower(filepath.Ext(entry.Name()))] {
+			videos++
+		} else if !entry.IsDir() {
+			candidates = append(candidates, entry.Name())
+		}
+	}
+	subtitles := []Subtitle{}
+	for _, name := range candidates {
+		format, ok := subtitleExtensions[strings.ToLower(filepath.Ext(name))]
+		if !ok {
+			continue
+		}
+		base := strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+		suffix := base
+		if isSubtitleOf(base, videoName) {
+			suffix = base[len(videoName):]
+		} else if videos != 1 {
+			// belongs to another video in this directory
+			continue
+		}
+		subtitle := parseSubtitleName(suffix)
+		subtitle.Name = filepath.ToSlash(name)
+		subtitle.Path = filepath.Join(dir, name)
+		subtitle.Format = format
+		subtitles = append(subtitles, subtitle)
+	}
+	sort.Slice(subtitles, func(i, j int) bool {
+		languageI, languageJ := "", ""
+		if subtitles[i].Language != nil {
+			languageI = *subtitles[i].Language
+		}
+		if subtitles[j].Language != nil {
+			languageJ = *subtitles[j].Language
+		}
+		if languageI != languageJ {
+			return languageI < languageJ
+		}
+		return subtitles[i].Name < subtitles[j].Name
+	})
+	return subtitles
+}
+
+// isSubtitleOf checks for the video name followed by nothing or a tag, Movie.en but not Movie 2.en
+func isSubtitleOf(subtitleName string, videoName string) bool {
+	if len(subtitleName) < len(videoName) || !strings.EqualFold(subtitleName[:len(videoName)], videoName) {
+		return false
+	}
+	rest := subtitleName[len(videoName):]
+	return rest == "" || rest[0] == '.' || rest[0] == '_'
+}
+
+// FindSubtitle returns the subtitle with this name, names come from FindSubtitles
+// so only sidecars of the video can be read
+func FindSubtitle(videoPath string, name string) (*Subtitle, error) {
+	for _, subtitle := range FindSubtitles(videoPath) {
+		if subtitle.Name == name {
+			return &subtitle, nil
+		}
+	}
+	return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "No subtitle with this name")
+}
+
+// parseSubtitleName reads language and flags from the part of the name after the video name, eg. .en.forced
+func parseSubtitleName(suffix string) Subtitle {
+	subtitle := Subtitle{}
+	tokens := strings.FieldsFunc(strings.ToLower(suffix), func(r rune) bool {
+		return r == '.' || r == '_' || r == ' ' || r == '[' || r == ']' || r == '(' || r == ')'
+	})
+	for _, token := range tokens {
+		token = strings.Trim(token, "-")
+		switch token {
+		case "forced", "foreign":
+			subtitle.Forced = true
+			continue
+		case "sdh", "cc":
+			subtitle.SDH = true
+			continue
+		}
+		if subtitle.Language != nil {
+			continue
+		}
+		if language, ok := parseSubtitleLanguage(token); ok {
+			subtitle.Language = &language
+		}
+	}
+	return subtitle
+}
+
+func parseSubtitleLanguage(token string) (string, bool) {
+	if language, ok := subtitleLanguages[token]; ok {
+		return language, true
+	}
+	if match := subtitleRegionRegex.FindStringSubmatch(token); match != nil && isSubtitleLanguageCode(match[1]) {
+		return match[1] + "-" + strings.ToUpper(match[2]), true
+	}
+	if isSubtitleLanguageCode(token) {
+		return token, true
+	}
+	return "", false
+}
+
+func isSubtitleLanguageCode(code string) bool {
+	for _, language := range subtitleLanguages {
+		if language == code {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadSubtitle reads a subtitle as utf-8, converting SRT to WebVTT if toVTT is set.
+// Files that aren't valid utf-8 are read as latin-1, the usual encoding of older srt files
+func ReadSubtitle(subtitle *Subtitle, toVTT bool) ([]byte, error) {
+	data, err := os.ReadFile(subtitle.Path)
+	if err != nil {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Subtitle file is missing")
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(data) {
+		runes := make([]rune, len(data))
+		for num, b := range data {
+			runes[num] = rune(b)
+		}
+		data = []byte(string(runes))
+	}
+	if toVTT && subtitle.Format == SubtitleFormatSRT {
+		return ConvertSRTToVTT(data), nil
+	}
+	return data, nil
+}
+
+// ConvertSRTToVTT adds the WebVTT header and switches timestamps to dot decimals,
+// SRT cue numbers are valid WebVTT cue identifiers
+func ConvertSRTToVTT(data []byte) []byte {
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	text = srtTimingRegex.ReplaceAllString(text, "$1.$2 --> $3.$4")
+	return []byte("WEBVTT\n\n" + strings.TrimLeft(text, "\n"))
+}
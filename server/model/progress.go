@@ -0,0 +1,93 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"hound/helpers"
+	"hound/model/database"
+	"time"
+)
+
+/*
+	Playback progress - players report position and duration of a movie or episode.
+	Past playback.watched-threshold the item is recorded in history and removed from
+	continue watching. Players keep reporting near the end (credits, stop events), only
+	the first report past the threshold is recorded until playback starts over
+*/
+
+const (
+	// positions before this are not stored, players report 0 when they open a file
+	progressMinPosition  = 30
+	progressCompletedTTL = 12 * time.Hour
+)
+
+type ProgressResult struct {
+	Watched   bool    `json:"watched"` // recorded in history
+	Position  int     `json:"position"`
+	Duration  int     `json:"duration"`
+	Threshold float64 `json:"threshold"`
+}
+
+// GetWatchedThreshold returns playback.watched-threshold, 0.9 if unset or invalid
+func GetWatchedThreshold() float64 {
+	threshold := viper.GetFloat64("playback.watched-threshold")
+	if threshold <= 0 || threshold > 1 {
+		return 0.9
+	}
+	return threshold
+}
+
+// ReportProgress stores the position of a movie or episode, or records a watch past the threshold.
+// Position and duration are in seconds
+func ReportProgress(userID int64, libraryID int64, seasonNumber *int, episodeNumber *int, position int, duration int) (*ProgressResult, error) {
+	if duration <= 0 || position < 0 {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid position or duration")
+	}
+	if (seasonNumber == nil) != (episodeNumber == nil) {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Progress needs both season and episode number, or neither")
+	}
+	if position > duration {
+		position = duration
+	}
+	result := ProgressResult{Position: position, Duration: duration, Threshold: GetWatchedThreshold()}
+	completedKey := fmt.Sprintf("progress-completed-%d-%d", userID, libraryID)
+	if seasonNumber != nil {
+		completedKey += fmt.Sprintf("-%d-%d", *seasonNumber, *episodeNumber)
+	}
+	if float64(position)/float64(duration) >= result.Threshold {
+		result.Watched = true
+		if _, ok := GetCache(completedKey); ok {
+			return &result, nil
+		}
+		err := database.CompleteProgress(database.HistoryRecord{
+			UserID:        userID,
+			LibraryID:     libraryID,
+			SeasonNumber:  seasonNumber,
+			EpisodeNumber: episodeNumber,
+			WatchedAt:     time.Now(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		_ = SetCache(completedKey, true, progressCompletedTTL)
+		return &result, nil
+	}
+	// playing again, the next time past the threshold is a rewatch
+	DeleteCache(completedKey)
+	if position < progressMinPosition {
+		return &result, nil
+	}
+	err := database.SetProgress(database.ProgressRecord{
+		UserID:        userID,
+		LibraryID:     libraryID,
+		SeasonNumber:  seasonNumber,
+		EpisodeNumber: episodeNumber,
+		Position:      position,
+		Duration:      duration,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -0,0 +1,109 @@
+package sources
+
+import (
+	"errors"
+	"hound/helpers"
+	"hound/model/database"
+	"sync"
+)
+
+const (
+	// max items in one batch request
+	BatchMaxItems = 100
+	// max concurrent source lookups for items missing from the library
+	batchWorkers = 5
+)
+
+type CollectionItem struct {
+	MediaType   string `json:"media_type" binding:"required,gt=0"`
+	MediaSource string `json:"media_source" binding:"required,gt=0"`
+	SourceID    string `json:"source_id" binding:"required,gt=0"`
+}
+
+type BatchItemResult struct {
+	CollectionItem
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// BatchCollectionItems adds, removes, moves or copies items in one transaction, see
+// database.BatchUpdateCollectionRelations. Items added that aren't in the internal library yet
+// are fetched from their source concurrently. If any item fails, nothing is applied
+func BatchCollectionItems(userID int64, action string, collectionID int64, targetCollectionID *int64,
+	items []CollectionItem) ([]BatchItemResult, bool, error) {
+	if len(items) == 0 || len(items) > BatchMaxItems {
+		return nil, false, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid number of batch items")
+	}
+	results := make([]BatchItemResult, len(items))
+	libraryIDs := make([]int64, len(items))
+	semaphore := make(chan struct{}, batchWorkers)
+	var wg sync.WaitGroup
+	seen := make(map[CollectionItem]bool)
+	for num := range items {
+		results[num].CollectionItem = items[num]
+		if seen[items[num]] {
+			results[num].Error = "item listed more than once"
+			continue
+		}
+		seen[items[num]] = true
+		wg.Add(1)
+		go func(num int) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			libraryID, err := resolveBatchItem(items[num], action == database.CollectionBatchAdd)
+			if err != nil {
+				results[num].Error = err.Error()
+				return
+			}
+			libraryIDs[num] = libraryID
+		}(num)
+	}
+	wg.Wait()
+	for _, result := range results {
+		if result.Error != "" {
+			return results, false, nil
+		}
+	}
+	itemErrors, err := database.BatchUpdateCollectionRelations(userID, action, collectionID, targetCollectionID, libraryIDs)
+	if err != nil {
+		return nil, false, err
+	}
+	success := true
+	for num, itemErr := range itemErrors {
+		if itemErr != nil {
+			results[num].Error = itemErr.Error()
+			success = false
+		}
+	}
+	if success {
+		for num := range results {
+			results[num].Success = true
+		}
+	}
+	return results, success, nil
+}
+
+// resolveBatchItem returns the internal library id of an item, fetching it from its source if missing and fetch is set
+func resolveBatchItem(item CollectionItem, fetch bool) (int64, error) {
+	_, err := GetSourceForMediaType(item.MediaType, item.MediaSource)
+	if err != nil {
+		return -1, errors.New("invalid media type or source")
+	}
+	libraryID, err := database.GetInternalLibraryID(item.MediaType, item.MediaSource, item.SourceID)
+	if err == nil {
+		return *libraryID, nil
+	}
+	if !fetch {
+		return -1, errors.New("item not in collection")
+	}
+	record, err := GetLibraryObject(item.MediaType, item.MediaSource, item.SourceID)
+	if err != nil {
+		return -1, errors.New("failed to get item from source")
+	}
+	newLibraryID, err := database.AddRecordToInternalLibrary(record)
+	if err != nil {
+		return -1, errors.New("failed to add item to library")
+	}
+	return newLibraryID, nil
+}
@@ -0,0 +1,163 @@
+package sources
+
+import (
+	"errors"
+	"hound/helpers"
+	"hound/model/database"
+	"strconv"
+	"time"
+)
+
+// AddToHistory adds the item to the internal library and records a watch.
+// For tv shows, a season without an episode marks every episode of that season
+func AddToHistory(userID int64, mediaType string, mediaSource string, sourceID string,
+	seasonNumber *int, episodeNumber *int, watchedAt time.Time, notes string) error {
+	if mediaType == database.MediaTypeTVShow {
+		if seasonNumber == nil || *seasonNumber < 0 || (episodeNumber != nil && *episodeNumber < 0) {
+			return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid season or episode number")
+		}
+	} else if seasonNumber != nil || episodeNumber != nil {
+		return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Season and episode are only valid for tv shows")
+	}
+	if watchedAt.IsZero() {
+		watchedAt = time.Now()
+	}
+	record, err := GetLibraryObject(mediaType, mediaSource, sourceID)
+	if err != nil {
+		return err
+	}
+	// add item to internal library if not there
+	libraryID, err := database.AddRecordToInternalLibrary(record)
+	if err != nil {
+		return err
+	}
+	// mark whole season as watched, episode range comes from the source
+	if mediaType == database.MediaTypeTVShow && episodeNumber == nil {
+		if mediaSource != SourceTMDB {
+			return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Marking seasons is only supported for tmdb")
+		}
+		tmdbID, err := strconv.Atoi(sourceID)
+		if err != nil {
+			return helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid tmdb id")
+		}
+		minEpisode, maxEpisode, err := GetTVSeasonEpisodeRangeTMDB(tmdbID, *seasonNumber)
+		if err != nil {
+			return err
+		}
+		return MarkTVSeasonAsWatchedTMDB(userID, libraryID, *seasonNumber, minEpisode, maxEpisode, watchedAt)
+	}
+	return database.AddHistoryRecords([]database.HistoryRecord{{
+		UserID:        userID,
+		LibraryID:     libraryID,
+		SeasonNumber:  seasonNumber,
+		EpisodeNumber: episodeNumber,
+		WatchedAt:     watchedAt,
+		Notes:         []byte(notes),
+	}})
+}
+
+// MarkTVShowWatchedTMDB marks every aired episode up to and including throughSeason x throughEpisode
+// as watched, the whole show if throughSeason is nil and the whole season if throughEpisode is nil.
+// Specials and episodes that are already watched are skipped. Returns the number of added episodes
+func MarkTVShowWatchedTMDB(userID int64, sourceID string, throughSeason *int, throughEpisode *int, watchedAt time.Time) (int, error) {
+	if (throughSeason == nil && throughEpisode != nil) || (throughSeason != nil && *throughSeason < 1) ||
+		(throughEpisode != nil && *throughEpisode < 1) {
+		return -1, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid season or episode number")
+	}
+	tmdbID, err := strconv.Atoi(sourceID)
+	if err != nil {
+		return -1, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid tmdb id")
+	}
+	if watchedAt.IsZero() {
+		watchedAt = time.Now()
+	}
+	showDetails, err := GetTVShowFromIDTMDB(tmdbID, nil)
+	if err != nil {
+		return -1, err
+	}
+	var seasonNumbers []int
+	for _, season := range showDetails.Seasons {
+		if season.SeasonNumber > 0 && (throughSeason == nil || season.SeasonNumber <= *throughSeason) {
+			seasonNumbers = append(seasonNumbers, season.SeasonNumber)
+		}
+	}
+	if throughSeason != nil && (len(seasonNumbers) == 0 || !containsInt(seasonNumbers, *throughSeason)) {
+		return -1, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Season does not exist")
+	}
+	record, err := GetLibraryObject(database.MediaTypeTVShow, SourceTMDB, sourceID)
+	if err != nil {
+		return -1, err
+	}
+	libraryID, err := database.AddRecordToInternalLibrary(record)
+	if err != nil {
+		return -1, err
+	}
+	history, _, err := database.GetHistory(database.HistoryQuery{UserID: userID, LibraryID: &libraryID}, -1, -1)
+	if err != nil {
+		return -1, err
+	}
+	watched := make(map[[2]int]bool)
+	for _, item := range history {
+		if item.SeasonNumber != nil && item.EpisodeNumber != nil {
+			watched[[2]int{*item.SeasonNumber, *item.EpisodeNumber}] = true
+		}
+	}
+	today := time.Now().Format("2006-01-02")
+	var records []database.HistoryRecord
+	for _, seasonNumber := range seasonNumbers {
+		season, err := GetTVSeasonTMDB(tmdbID, seasonNumber, nil)
+		if err != nil {
+			return -1, err
+		}
+		for _, episode := range season.Episodes {
+			if throughEpisode != nil && seasonNumber == *throughSeason && episode.EpisodeNumber > *throughEpisode {
+				continue
+			}
+			// unaired episodes can't be watched
+			if episode.AirDate == "" || episode.AirDate > today || watched[[2]int{seasonNumber, episode.EpisodeNumber}] {
+				continue
+			}
+			seasonNum := seasonNumber
+			episodeNum := episode.EpisodeNumber
+			records = append(records, database.HistoryRecord{
+				UserID:        userID,
+				LibraryID:     libraryID,
+				SeasonNumber:  &seasonNum,
+				EpisodeNumber: &episodeNum,
+				WatchedAt:     watchedAt,
+			})
+		}
+	}
+	if len(records) == 0 {
+		return 0, nil
+	}
+	// all episodes are added in one transaction
+	err = database.AddHistoryRecords(records)
+	if err != nil {
+		return -1, err
+	}
+	return len(records), nil
+}
+
+// UnmarkTVShowWatched removes the user's watches of a whole show, or one season if seasonNumber is set.
+// Returns the number of removed watches
+func UnmarkTVShowWatched(userID int64, mediaSource string, sourceID string, seasonNumber *int) (int64, error) {
+	if seasonNumber != nil && *seasonNumber < 0 {
+		return -1, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid season number")
+	}
+	libraryID, err := database.GetInternalLibraryID(database.MediaTypeTVShow, mediaSource, sourceID)
+	if err != nil {
+		// never added, nothing to remove
+		return 0, nil
+	}
+	return database.DeleteShowHistory(userID, *libraryID, seasonNumber)
+}
+
+func containsInt(slice []int, value int) bool {
+	for _, item := range slice {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
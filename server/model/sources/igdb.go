@@ -174,6 +174,40 @@ type IGDBSearchResultObject []IGDBSearchObject
 
 var igdbClient = &http.Client{Timeout: 10 * time.Second}
 
+// IGDBSource implements MediaSource for games
+type IGDBSource struct{}
+
+func (IGDBSource) GetName() string {
+	return SourceIGDB
+}
+
+func (IGDBSource) GetMediaTypes() []string {
+	return []string{database.MediaTypeGame}
+}
+
+func (IGDBSource) Search(mediaType string, query string) (interface{}, error) {
+	if mediaType != database.MediaTypeGame {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid media type for igdb search")
+	}
+	return SearchGameIGDB(query)
+}
+
+func (IGDBSource) GetDetails(mediaType string, sourceID string) (interface{}, error) {
+	igdbID, err := strconv.Atoi(sourceID)
+	if err != nil || mediaType != database.MediaTypeGame {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid igdb id or media type")
+	}
+	return GetGameFromIDIGDB(igdbID)
+}
+
+func (IGDBSource) GetLibraryObject(mediaType string, sourceID string) (*database.LibraryRecord, error) {
+	igdbID, err := strconv.Atoi(sourceID)
+	if err != nil || mediaType != database.MediaTypeGame {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid igdb id or media type")
+	}
+	return GetLibraryObjectIGDB(igdbID)
+}
+
 func getAccessToken(forceRefresh bool) string {
 	// get from ttl cache, return if it exists
 	// if force refresh is true, refresh token
@@ -308,31 +342,6 @@ func GetGameFromIDIGDB(igdbID int) (*IGDBGameObject, error) {
 	return &game, nil
 }
 
-func AddGameToCollectionIGDB(username string, source string, sourceID int, collectionID *int64) error {
-	userID, err := database.GetUserIDFromUsername(username)
-	if err != nil {
-		return err
-	}
-	if source != SourceIGDB {
-		panic("Only igdb source is allowed for now")
-	}
-	entry, err := GetLibraryObjectIGDB(sourceID)
-	if err != nil {
-		return err
-	}
-	// insert record to internal library if not exists
-	libraryID, err := database.AddRecordToInternalLibrary(entry)
-	if err != nil {
-		return err
-	}
-	// insert collection relation to collections table
-	err = database.InsertCollectionRelation(userID, libraryID, collectionID)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
 func GetLibraryObjectIGDB(igdbID int) (*database.LibraryRecord, error) {
 	game, err := GetGameFromIDIGDB(igdbID)
 	if err != nil {
@@ -0,0 +1,296 @@
+package sources
+
+import (
+	"errors"
+	"fmt"
+	"hound/helpers"
+	"hound/model"
+	"hound/model/database"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/*
+	Recommendations - tmdb recommendations of the user's items, ranked by how much
+	the user liked the items they came from and by the user's genre preferences.
+	Seeds are reviewed items scored 60 or more, weighted by score, and watched or
+	collected items without a review at a lower weight
+*/
+
+const (
+	recommendationWorkers  = 5
+	recommendationMaxSeeds = 25
+	// weight of a watched or collected item the user hasn't reviewed
+	recommendationUnratedWeight = 0.25
+	recommendationMinSeedScore  = 60
+	// how much genre preference can raise or lower a candidate's score
+	recommendationGenreFactor = 0.5
+	recommendationMaxReasons  = 2
+	recommendationCacheTTL    = 24 * time.Hour
+)
+
+type Recommendation struct {
+	MediaType   string
+	MediaSource string
+	SourceID    string
+	Title       string
+	Overview    string
+	ReleaseDate string
+	PosterPath  string
+	VoteAverage float32
+	Score       float64
+	Reasons     []string // eg. because you rated X
+}
+
+type recommendationSeed struct {
+	record database.LibraryRecord
+	weight float64
+	reason string
+}
+
+// tmdb movie and tv recommendation results in one shape
+type recommendationCandidate struct {
+	ID          int64
+	Title       string
+	Overview    string
+	ReleaseDate string
+	PosterPath  string
+	VoteAverage float32
+	GenreIDs    []int64
+}
+
+// GetRecommendationsTMDB ranks tmdb recommendations for the user, mediaType is movie, tvshow or empty for both.
+// Items the user has watched or collected are left out
+func GetRecommendationsTMDB(userID int64, mediaType string, limit int) ([]Recommendation, error) {
+	if mediaType != "" && mediaType != database.MediaTypeMovie && mediaType != database.MediaTypeTVShow {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid media type for recommendations")
+	}
+	seeds, genreAffinity, excluded, err := getRecommendationSeeds(userID, mediaType)
+	if err != nil {
+		return nil, err
+	}
+	candidateLists := make([][]recommendationCandidate, len(seeds))
+	semaphore := make(chan struct{}, recommendationWorkers)
+	var wg sync.WaitGroup
+	for num := range seeds {
+		wg.Add(1)
+		go func(num int) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			candidates, err := getRecommendationCandidatesTMDB(seeds[num].record)
+			if err != nil {
+				_ = helpers.LogErrorWithMessage(err, "GetRecommendationsTMDB(): Failed to get recommendations for "+seeds[num].record.SourceID)
+				return
+			}
+			candidateLists[num] = candidates
+		}(num)
+	}
+	wg.Wait()
+
+	type contribution struct {
+		seed   int
+		weight float64
+	}
+	recommendations := map[string]*Recommendation{}
+	contributions := map[string][]contribution{}
+	genres := map[string][]int64{}
+	for num, candidates := range candidateLists {
+		candidateType := seeds[num].record.MediaType
+		for rank, candidate := range candidates {
+			key := candidateType + ":" + strconv.FormatInt(candidate.ID, 10)
+			if excluded[key] {
+				continue
+			}
+			// tmdb orders recommendations by relevance, earlier results count more
+			weight := seeds[num].weight * (1 - float64(rank)/float64(len(candidates)+1))
+			if _, ok := recommendations[key]; !ok {
+				recommendations[key] = &Recommendation{
+					MediaType:   candidateType,
+					MediaSource: SourceTMDB,
+					SourceID:    strconv.FormatInt(candidate.ID, 10),
+					Title:       candidate.Title,
+					Overview:    candidate.Overview,
+					ReleaseDate: candidate.ReleaseDate,
+					PosterPath:  candidate.PosterPath,
+					VoteAverage: candidate.VoteAverage,
+				}
+				genres[key] = candidate.GenreIDs
+			}
+			recommendations[key].Score += weight
+			contributions[key] = append(contributions[key], contribution{num, weight})
+		}
+	}
+	ret := []Recommendation{}
+	for key, item := range recommendations {
+		if len(genres[key]) > 0 {
+			affinity := 0.0
+			for _, genreID := range genres[key] {
+				affinity += genreAffinity[genreID]
+			}
+			item.Score *= 1 + recommendationGenreFactor*affinity/float64(len(genres[key]))
+		}
+		sort.Slice(contributions[key], func(i, j int) bool {
+			return contributions[key][i].weight > contributions[key][j].weight
+		})
+		for _, contrib := range contributions[key] {
+			if len(item.Reasons) == recommendationMaxReasons {
+				break
+			}
+			item.Reasons = append(item.Reasons, seeds[contrib.seed].reason)
+		}
+		ret = append(ret, *item)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Score != ret[j].Score {
+			return ret[i].Score > ret[j].Score
+		}
+		return ret[i].Title < ret[j].Title
+	})
+	if limit > 0 && len(ret) > limit {
+		ret = ret[:limit]
+	}
+	return ret, nil
+}
+
+// getRecommendationSeeds returns the items to get recommendations from, the user's preference
+// for each tmdb genre id (-1 to 1), and the media_type:source_id keys of watched or collected items
+func getRecommendationSeeds(userID int64, mediaType string) ([]recommendationSeed, map[int64]float64, map[string]bool, error) {
+	reviews, err := database.GetUserReviews(userID, nil, nil)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	watchedIDs, err := database.GetWatchedLibraryIDs(userID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	collectedIDs, err := database.GetCollectedLibraryIDs(userID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	watched := map[int64]bool{}
+	for _, libraryID := range watchedIDs {
+		watched[libraryID] = true
+	}
+	libraryIDs := append(append([]int64{}, watchedIDs...), collectedIDs...)
+	for _, review := range reviews {
+		libraryIDs = append(libraryIDs, review.LibraryID)
+	}
+	records, err := database.GetLibraryRecords(libraryIDs)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	// a user may review an item more than once, the latest review counts
+	sort.Slice(reviews, func(i, j int) bool {
+		return reviews[i].CreatedAt.Before(reviews[j].CreatedAt)
+	})
+	scores := map[int64]int{}
+	for _, review := range reviews {
+		scores[review.LibraryID] = review.Score
+	}
+	var seeds []recommendationSeed
+	genreAffinity := map[int64]float64{}
+	excluded := map[string]bool{}
+	for _, record := range records {
+		if record.MediaSource != SourceTMDB ||
+			(record.MediaType != database.MediaTypeMovie && record.MediaType != database.MediaTypeTVShow) {
+			continue
+		}
+		excluded[record.MediaType+":"+record.SourceID] = true
+		var weight float64
+		var reason string
+		if score, ok := scores[record.LibraryID]; ok {
+			// centered on 50 so genres of disliked items count against candidates
+			weight = float64(score-50) / 50
+			reason = "because you rated " + record.MediaTitle
+			if score < recommendationMinSeedScore {
+				addGenreAffinity(genreAffinity, record, weight)
+				continue
+			}
+		} else {
+			weight = recommendationUnratedWeight
+			reason = "because you watched " + record.MediaTitle
+			if !watched[record.LibraryID] {
+				reason = "because " + record.MediaTitle + " is in your collection"
+			}
+		}
+		addGenreAffinity(genreAffinity, record, weight)
+		if mediaType == "" || record.MediaType == mediaType {
+			seeds = append(seeds, recommendationSeed{record, weight, reason})
+		}
+	}
+	sort.Slice(seeds, func(i, j int) bool {
+		if seeds[i].weight != seeds[j].weight {
+			return seeds[i].weight > seeds[j].weight
+		}
+		return seeds[i].record.LibraryID > seeds[j].record.LibraryID
+	})
+	if len(seeds) > recommendationMaxSeeds {
+		seeds = seeds[:recommendationMaxSeeds]
+	}
+	// scale to -1..1
+	maxAffinity := 0.0
+	for _, affinity := range genreAffinity {
+		if affinity > maxAffinity {
+			maxAffinity = affinity
+		} else if -affinity > maxAffinity {
+			maxAffinity = -affinity
+		}
+	}
+	if maxAffinity > 0 {
+		for genreID := range genreAffinity {
+			genreAffinity[genreID] /= maxAffinity
+		}
+	}
+	return seeds, genreAffinity, excluded, nil
+}
+
+// library tags of tmdb items are tmdb genres, tag ids are genre ids
+func addGenreAffinity(genreAffinity map[int64]float64, record database.LibraryRecord, weight float64) {
+	if record.Tags == nil {
+		return
+	}
+	for _, tag := range *record.Tags {
+		genreAffinity[tag.TagID] += weight
+	}
+}
+
+// getRecommendationCandidatesTMDB gets the first page of tmdb recommendations for an item, cached for a day
+func getRecommendationCandidatesTMDB(record database.LibraryRecord) ([]recommendationCandidate, error) {
+	cacheKey := fmt.Sprintf("tmdb-recommendations-%s-%s", record.MediaType, record.SourceID)
+	if cached, ok := model.GetCache(cacheKey); ok {
+		return cached.([]recommendationCandidate), nil
+	}
+	tmdbID, err := strconv.Atoi(record.SourceID)
+	if err != nil {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid tmdb id")
+	}
+	candidates := []recommendationCandidate{}
+	if record.MediaType == database.MediaTypeMovie {
+		results, err := tmdbClient.GetMovieRecommendations(tmdbID, nil)
+		if err != nil {
+			return nil, helpers.LogErrorWithMessage(err, "Failed to get movie recommendations from tmdb")
+		}
+		if results.MovieRecommendationsResults != nil {
+			for _, item := range results.Results {
+				candidates = append(candidates, recommendationCandidate{item.ID, item.Title, item.Overview,
+					item.ReleaseDate, item.PosterPath, item.VoteAverage, item.GenreIDs})
+			}
+		}
+	} else {
+		results, err := tmdbClient.GetTVRecommendations(tmdbID, nil)
+		if err != nil {
+			return nil, helpers.LogErrorWithMessage(err, "Failed to get tv show recommendations from tmdb")
+		}
+		if results.TVRecommendationsResults != nil {
+			for _, item := range results.Results {
+				candidates = append(candidates, recommendationCandidate{item.ID, item.Name, item.Overview,
+					item.FirstAirDate, item.PosterPath, item.VoteAverage, item.GenreIDs})
+			}
+		}
+	}
+	_ = model.SetCache(cacheKey, candidates, recommendationCacheTTL)
+	return candidates, nil
+}
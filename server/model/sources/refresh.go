@@ -0,0 +1,61 @@
+package sources
+
+import (
+	"fmt"
+	"github.com/spf13/viper"
+	"hound/helpers"
+	"hound/model/database"
+	"time"
+)
+
+/*
+	Library refresher - periodically re-fetches library records older than
+	library.refresh-max-age from their source so collections show current metadata
+*/
+
+// InitializeLibraryRefresher starts the background refresher, disabled if library.refresh-interval <= 0
+func InitializeLibraryRefresher() {
+	interval := viper.GetInt("library.refresh-interval")
+	if interval <= 0 {
+		fmt.Println(helpers.WarnMsg("Library refresher disabled"))
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			RefreshStaleLibraryRecords()
+		}
+	}()
+}
+
+// RefreshStaleLibraryRecords refreshes up to library.refresh-batch-size stale records
+func RefreshStaleLibraryRecords() {
+	maxAge := time.Duration(viper.GetInt("library.refresh-max-age")) * time.Second
+	records, err := database.GetStaleLibraryRecords(time.Now().Add(-maxAge), viper.GetInt("library.refresh-batch-size"))
+	if err != nil {
+		return
+	}
+	refreshed := 0
+	for _, record := range records {
+		err := RefreshLibraryRecord(record.LibraryID, record.MediaType, record.MediaSource, record.SourceID)
+		if err != nil {
+			// failing records (eg. removed from the source) would otherwise head every batch
+			_ = database.TouchLibraryRecord(record.LibraryID)
+			continue
+		}
+		refreshed++
+	}
+	if len(records) > 0 {
+		fmt.Println(helpers.InfoMsg(fmt.Sprintf("Library refresher: refreshed %d/%d records", refreshed, len(records))))
+	}
+}
+
+// RefreshLibraryRecord re-fetches a single record from its source and stores the result
+func RefreshLibraryRecord(libraryID int64, mediaType string, mediaSource string, sourceID string) error {
+	entry, err := GetLibraryObject(mediaType, mediaSource, sourceID)
+	if err != nil {
+		return helpers.LogErrorWithMessage(err, fmt.Sprintf("Failed to refresh library record %d", libraryID))
+	}
+	return database.UpdateLibraryRecord(libraryID, entry)
+}
@@ -1,5 +1,98 @@
 package sources
 
+import (
+	"errors"
+	"hound/helpers"
+	"hound/model/database"
+	"sort"
+)
+
+// MediaSource is implemented by every metadata provider (tmdb, igdb, etc.)
+// handlers dispatch through the registry instead of branching on source names
+type MediaSource interface {
+	// GetName returns the identifier stored in library.media_source, eg. tmdb
+	GetName() string
+	// GetMediaTypes returns the media types this source can provide
+	GetMediaTypes() []string
+	Search(mediaType string, query string) (interface{}, error)
+	GetDetails(mediaType string, sourceID string) (interface{}, error)
+	// GetLibraryObject builds a record ready to be inserted into the internal library
+	GetLibraryObject(mediaType string, sourceID string) (*database.LibraryRecord, error)
+}
+
+var sourceRegistry = map[string]MediaSource{}
+
 func InitializeSources() {
 	InitializeTMDB()
+	RegisterSource(TMDBSource{})
+	RegisterSource(IGDBSource{})
+}
+
+// RegisterSource adds a source to the registry, replacing any source with the same name
+func RegisterSource(source MediaSource) {
+	sourceRegistry[source.GetName()] = source
+}
+
+func GetSource(mediaSource string) (MediaSource, error) {
+	source, ok := sourceRegistry[mediaSource]
+	if !ok {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid media source")
+	}
+	return source, nil
+}
+
+// GetRegisteredSources returns all sources sorted by name
+func GetRegisteredSources() []MediaSource {
+	var ret []MediaSource
+	for _, source := range sourceRegistry {
+		ret = append(ret, source)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].GetName() < ret[j].GetName()
+	})
+	return ret
+}
+
+// GetSourceForMediaType returns the source if it exists and supports mediaType
+func GetSourceForMediaType(mediaType string, mediaSource string) (MediaSource, error) {
+	source, err := GetSource(mediaSource)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range source.GetMediaTypes() {
+		if item == mediaType {
+			return source, nil
+		}
+	}
+	return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid media type for source "+mediaSource)
+}
+
+func GetLibraryObject(mediaType string, mediaSource string, sourceID string) (*database.LibraryRecord, error) {
+	source, err := GetSourceForMediaType(mediaType, mediaSource)
+	if err != nil {
+		return nil, err
+	}
+	return source.GetLibraryObject(mediaType, sourceID)
+}
+
+func AddToCollection(username string, mediaType string, mediaSource string, sourceID string, collectionID *int64) error {
+	userID, err := database.GetUserIDFromUsername(username)
+	if err != nil {
+		return err
+	}
+	entry, err := GetLibraryObject(mediaType, mediaSource, sourceID)
+	if err != nil {
+		return err
+	}
+	// insert record to internal library if not exists
+	libraryID, err := database.AddRecordToInternalLibrary(entry)
+	if err != nil {
+		return err
+	}
+	// insert collection relation to collections table
+	err = database.InsertCollectionRelation(userID, libraryID, collectionID)
+	if err != nil {
+		return err
+	}
+	return nil
 }
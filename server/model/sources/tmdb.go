@@ -3,9 +3,12 @@ package sources
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	tmdb "github.com/cyruzin/golang-tmdb"
 	"hound/helpers"
+	"hound/model"
 	"hound/model/database"
+	"net/http"
 	"os"
 	"strconv"
 	"time"
@@ -13,9 +16,18 @@ import (
 
 const (
 	SourceTMDB string = "tmdb"
+	// golang-tmdb's GetTrending doesn't accept url options, so pages are requested directly
+	TMDBTrendingAPIPath = "https://api.themoviedb.org/3/trending/%s/%s?api_key=%s&page=%d"
+	TMDBTrendingMaxPage = 500
+)
+
+const (
+	TrendingTimeWindowDay  = "day"
+	TrendingTimeWindowWeek = "week"
 )
 
 var tmdbClient *tmdb.Client
+var tmdbHTTPClient = &http.Client{Timeout: 10 * time.Second}
 var tmdbTVGenres tmdb.GenreMovieList
 var tmdbMovieGenres tmdb.GenreMovieList
 
@@ -47,20 +59,55 @@ func InitializeTMDB() {
 	}
 }
 
+// TMDBSource implements MediaSource for tv shows and movies
+type TMDBSource struct{}
+
+func (TMDBSource) GetName() string {
+	return SourceTMDB
+}
+
+func (TMDBSource) GetMediaTypes() []string {
+	return []string{database.MediaTypeTVShow, database.MediaTypeMovie}
+}
+
+func (TMDBSource) Search(mediaType string, query string) (interface{}, error) {
+	if mediaType == database.MediaTypeTVShow {
+		return SearchTVShowTMDB(query)
+	} else if mediaType == database.MediaTypeMovie {
+		return SearchMoviesTMDB(query)
+	}
+	return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid media type for tmdb search")
+}
+
+func (TMDBSource) GetDetails(mediaType string, sourceID string) (interface{}, error) {
+	tmdbID, err := strconv.Atoi(sourceID)
+	if err != nil {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid tmdb id")
+	}
+	if mediaType == database.MediaTypeTVShow {
+		return GetTVShowFromIDTMDB(tmdbID, nil)
+	} else if mediaType == database.MediaTypeMovie {
+		return GetMovieFromIDTMDB(tmdbID, nil)
+	}
+	return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid media type for tmdb details")
+}
+
+func (TMDBSource) GetLibraryObject(mediaType string, sourceID string) (*database.LibraryRecord, error) {
+	tmdbID, err := strconv.Atoi(sourceID)
+	if err != nil {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid tmdb id")
+	}
+	return GetLibraryObjectTMDB(mediaType, tmdbID)
+}
+
 /*
 ------------------------------
 	TMDB TV SHOWS FUNCTIONS
 ------------------------------
  */
 
-func GetTrendingTVShowsTMDB(page string) (*tmdb.Trending, error) {
-	urlOptions := make(map[string]string)
-	urlOptions["page"] = page
-	shows, err := tmdbClient.GetTrending("tv", "week")
-	if err != nil {
-		return nil, err
-	}
-	return shows, nil
+func GetTrendingTVShowsTMDB(timeWindow string, page int) (*tmdb.Trending, error) {
+	return getTrendingTMDB("tv", timeWindow, page)
 }
 
 func SearchTVShowTMDB(query string) (*tmdb.SearchTVShowsResults, error) {
@@ -87,48 +134,42 @@ func GetTVSeasonTMDB(tmdbID int, seasonNumber int, options map[string]string) (*
 	return tvShow, nil
 }
 
-func AddTVShowToCollectionTMDB(username string, source string, sourceID int, collectionID *int64) error {
-	userID, err := database.GetUserIDFromUsername(username)
-	if err != nil {
-		return err
-	}
-	if source != SourceTMDB {
-		panic("Only tmdb source is allowed for now")
-	}
-	entry, err := GetLibraryObjectTMDB(database.MediaTypeTVShow, sourceID)
-	if err != nil {
-		return err
+func MarkTVSeasonAsWatchedTMDB(userID int64, libraryID int64, seasonNumber int, minEp int, maxEp int, date time.Time) error {
+	var records []database.HistoryRecord
+	for i := minEp; i <= maxEp; i++ {
+		season := seasonNumber
+		episode := i
+		records = append(records, database.HistoryRecord{
+			UserID:        userID,
+			LibraryID:     libraryID,
+			SeasonNumber:  &season,
+			EpisodeNumber: &episode,
+			WatchedAt:     date,
+		})
 	}
-	// insert record to internal library if not exists
-	libraryID, err := database.AddRecordToInternalLibrary(entry)
+	return database.AddHistoryRecords(records)
+}
+
+// GetTVSeasonEpisodeRangeTMDB returns the lowest and highest episode number of a season
+func GetTVSeasonEpisodeRangeTMDB(tmdbID int, seasonNumber int) (int, int, error) {
+	season, err := GetTVSeasonTMDB(tmdbID, seasonNumber, nil)
 	if err != nil {
-		return err
+		return -1, -1, err
 	}
-	// insert collection relation to collections table
-	err = database.InsertCollectionRelation(userID, libraryID, collectionID)
-	if err != nil {
-		return err
+	if len(season.Episodes) == 0 {
+		return -1, -1, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Season has no episodes")
 	}
-	return nil
-}
-
-func MarkTVSeasonAsWatchedTMDB(userID int64, libraryID int64, seasonNumber int, minEp int, maxEp int, date time.Time) error {
-	var records []database.CommentRecord
-	for i := minEp; i <= maxEp; i++ {
-		tagData := "S" + strconv.Itoa(seasonNumber) + "E" + strconv.Itoa(i)
-		records = append(records, database.CommentRecord{
-			CommentType:  "history",
-			UserID:       userID,
-			LibraryID:    libraryID,
-			IsPrivate:    true,
-			CommentTitle: "",
-			Comment:      nil,
-			TagData:      tagData,
-			StartDate:    date,
-			EndDate:      date,
-		})
+	minEpisode := season.Episodes[0].EpisodeNumber
+	maxEpisode := 0
+	for _, ep := range season.Episodes {
+		if ep.EpisodeNumber < minEpisode {
+			minEpisode = ep.EpisodeNumber
+		}
+		if ep.EpisodeNumber > maxEpisode {
+			maxEpisode = ep.EpisodeNumber
+		}
 	}
-	return database.AddCommentsBatch(&records)
+	return minEpisode, maxEpisode, nil
 }
 
 /*
@@ -137,14 +178,8 @@ func MarkTVSeasonAsWatchedTMDB(userID int64, libraryID int64, seasonNumber int,
 ------------------------------
 */
 
-func GetTrendingMoviesTMDB(page string) (*tmdb.Trending, error) {
-	urlOptions := make(map[string]string)
-	urlOptions["page"] = page
-	movies, err := tmdbClient.GetTrending("movie", "week")
-	if err != nil {
-		return nil, err
-	}
-	return movies, nil
+func GetTrendingMoviesTMDB(timeWindow string, page int) (*tmdb.Trending, error) {
+	return getTrendingTMDB("movie", timeWindow, page)
 }
 
 func SearchMoviesTMDB(query string) (*tmdb.SearchMoviesResults, error) {
@@ -163,38 +198,111 @@ func GetMovieFromIDTMDB(tmdbID int, options map[string]string) (*tmdb.MovieDetai
 	return movie, nil
 }
 
-func AddMovieToCollectionTMDB(username string, source string, sourceID int, collectionID *int64) error {
-	userID, err := database.GetUserIDFromUsername(username)
+/*
+------------------------------
+	HELPERS
+------------------------------
+*/
+
+// TMDBMatch is a tmdb item resolved from an external id or title, episodes resolve to their show
+type TMDBMatch struct {
+	MediaType     string
+	TMDBID        int
+	SeasonNumber  *int
+	EpisodeNumber *int
+}
+
+// FindByIMDbIDTMDB resolves an imdb id (tt1234567) to a tmdb movie, tv show or tv episode
+func FindByIMDbIDTMDB(imdbID string) (*TMDBMatch, error) {
+	return FindByExternalIDTMDB(imdbID, "imdb_id")
+}
+
+// FindByExternalIDTMDB resolves an external id to a tmdb movie, tv show or tv episode,
+// externalSource is a tmdb find source such as imdb_id or tvdb_id
+func FindByExternalIDTMDB(externalID string, externalSource string) (*TMDBMatch, error) {
+	results, err := tmdbClient.GetFindByID(externalID, map[string]string{"external_source": externalSource})
 	if err != nil {
-		return err
+		return nil, helpers.LogErrorWithMessage(err, "Failed to find "+externalSource+" on tmdb")
 	}
-	if source != SourceTMDB {
-		panic("Only tmdb source is allowed for now")
+	if len(results.MovieResults) > 0 {
+		return &TMDBMatch{MediaType: database.MediaTypeMovie, TMDBID: int(results.MovieResults[0].ID)}, nil
 	}
-	entry, err := GetLibraryObjectTMDB(database.MediaTypeMovie, sourceID)
-	if err != nil {
-		return err
+	if len(results.TvResults) > 0 {
+		return &TMDBMatch{MediaType: database.MediaTypeTVShow, TMDBID: int(results.TvResults[0].ID)}, nil
+	}
+	if len(results.TvEpisodeResults) > 0 {
+		episode := results.TvEpisodeResults[0]
+		return &TMDBMatch{
+			MediaType:     database.MediaTypeTVShow,
+			TMDBID:        int(episode.ShowID),
+			SeasonNumber:  &episode.SeasonNumber,
+			EpisodeNumber: &episode.EpisodeNumber,
+		}, nil
+	}
+	return nil, nil
+}
+
+// SearchByTitleTMDB returns the top search result for a title, year is ignored if 0
+func SearchByTitleTMDB(mediaType string, title string, year int) (*TMDBMatch, error) {
+	options := map[string]string{}
+	if mediaType == database.MediaTypeMovie {
+		if year > 0 {
+			options["year"] = strconv.Itoa(year)
+		}
+		results, err := tmdbClient.GetSearchMovies(title, options)
+		if err != nil {
+			return nil, helpers.LogErrorWithMessage(err, "Failed to search movies on tmdb")
+		}
+		if len(results.Results) == 0 {
+			return nil, nil
+		}
+		return &TMDBMatch{MediaType: mediaType, TMDBID: int(results.Results[0].ID)}, nil
+	} else if mediaType == database.MediaTypeTVShow {
+		if year > 0 {
+			options["first_air_date_year"] = strconv.Itoa(year)
+		}
+		results, err := tmdbClient.GetSearchTVShow(title, options)
+		if err != nil {
+			return nil, helpers.LogErrorWithMessage(err, "Failed to search tv shows on tmdb")
+		}
+		if len(results.Results) == 0 {
+			return nil, nil
+		}
+		return &TMDBMatch{MediaType: mediaType, TMDBID: int(results.Results[0].ID)}, nil
+	}
+	return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid media type for tmdb search")
+}
+
+// getTrendingTMDB gets one page of trending tv shows or movies, pages are cached for an hour
+func getTrendingTMDB(mediaType string, timeWindow string, page int) (*tmdb.Trending, error) {
+	if timeWindow != TrendingTimeWindowDay && timeWindow != TrendingTimeWindowWeek {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid trending time window")
+	}
+	if page < 1 || page > TMDBTrendingMaxPage {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid trending page")
 	}
-	// insert record to internal library if not exists
-	libraryID, err := database.AddRecordToInternalLibrary(entry)
+	cacheKey := fmt.Sprintf("tmdb-trending-%s-%s-%d", mediaType, timeWindow, page)
+	if cached, ok := model.GetCache(cacheKey); ok {
+		return cached.(*tmdb.Trending), nil
+	}
+	res, err := tmdbHTTPClient.Get(fmt.Sprintf(TMDBTrendingAPIPath, mediaType, timeWindow, os.Getenv("TMDB_API_KEY"), page))
 	if err != nil {
-		return err
+		return nil, helpers.LogErrorWithMessage(err, "Failed to get trending from tmdb")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.InternalServerError),
+			fmt.Sprintf("Non-200 response getting trending from tmdb: %d", res.StatusCode))
 	}
-	// insert collection relation to collections table
-	err = database.InsertCollectionRelation(userID, libraryID, collectionID)
+	trending := tmdb.Trending{}
+	err = json.NewDecoder(res.Body).Decode(&trending)
 	if err != nil {
-		return err
+		return nil, helpers.LogErrorWithMessage(err, "Failed to decode tmdb trending response")
 	}
-	return nil
+	_ = model.SetCache(cacheKey, &trending, time.Hour)
+	return &trending, nil
 }
 
-
-/*
-------------------------------
-	HELPERS
-------------------------------
-*/
-
 func populateTMDBTVGenres() error {
 	list, err := tmdbClient.GetGenreTVList(nil)
 	if err != nil {
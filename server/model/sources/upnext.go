@@ -0,0 +1,132 @@
+package sources
+
+import (
+	"errors"
+	"hound/helpers"
+	"hound/model/database"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// max concurrent tmdb lookups when building up next
+const upNextWorkers = 5
+
+// UpNextEpisode is the next unwatched aired episode of a partially watched show
+type UpNextEpisode struct {
+	Show          database.ShowActivity
+	SeasonNumber  int
+	EpisodeNumber int
+	EpisodeTitle  string
+	Overview      string
+	AirDate       string
+	StillPath     string
+}
+
+// GetUpNextTMDB returns the next episode of every partially watched show, most recent activity first.
+// Shows that are fully watched or whose next episode has not aired yet are left out
+func GetUpNextTMDB(userID int64) ([]UpNextEpisode, error) {
+	shows, err := database.GetShowActivity(userID)
+	if err != nil {
+		return nil, err
+	}
+	nextEpisodes := make([]*UpNextEpisode, len(shows))
+	semaphore := make(chan struct{}, upNextWorkers)
+	var wg sync.WaitGroup
+	for num := range shows {
+		if shows[num].MediaSource != SourceTMDB {
+			continue
+		}
+		wg.Add(1)
+		go func(num int) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			next, err := getNextEpisodeTMDB(shows[num])
+			if err != nil {
+				_ = helpers.LogErrorWithMessage(err, "GetUpNextTMDB(): Failed to get next episode for "+shows[num].SourceID)
+				return
+			}
+			nextEpisodes[num] = next
+		}(num)
+	}
+	wg.Wait()
+	// keep activity order from GetShowActivity
+	var ret []UpNextEpisode
+	for _, item := range nextEpisodes {
+		if item != nil {
+			ret = append(ret, *item)
+		}
+	}
+	return ret, nil
+}
+
+// getNextEpisodeTMDB walks forward from the furthest watched episode, crossing into later
+// seasons and skipping specials (season 0). Returns nil if there is no aired unwatched episode
+func getNextEpisodeTMDB(show database.ShowActivity) (*UpNextEpisode, error) {
+	tmdbID, err := strconv.Atoi(show.SourceID)
+	if err != nil {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid tmdb id")
+	}
+	watched := make(map[[2]int]bool)
+	lastSeason, lastEpisode := 0, 0
+	for _, item := range show.WatchedEpisodes {
+		if item.SeasonNumber == nil || item.EpisodeNumber == nil || *item.SeasonNumber == 0 {
+			continue
+		}
+		season, episode := *item.SeasonNumber, *item.EpisodeNumber
+		watched[[2]int{season, episode}] = true
+		if season > lastSeason || (season == lastSeason && episode > lastEpisode) {
+			lastSeason, lastEpisode = season, episode
+		}
+	}
+	// only specials watched
+	if lastSeason == 0 {
+		return nil, nil
+	}
+	showDetails, err := GetTVShowFromIDTMDB(tmdbID, nil)
+	if err != nil {
+		return nil, err
+	}
+	var seasonNumbers []int
+	for _, season := range showDetails.Seasons {
+		if season.SeasonNumber >= lastSeason && season.EpisodeCount > 0 {
+			seasonNumbers = append(seasonNumbers, season.SeasonNumber)
+		}
+	}
+	sort.Ints(seasonNumbers)
+	today := time.Now().Format("2006-01-02")
+	for _, seasonNumber := range seasonNumbers {
+		season, err := GetTVSeasonTMDB(tmdbID, seasonNumber, nil)
+		if err != nil {
+			return nil, err
+		}
+		episodes := season.Episodes
+		sort.Slice(episodes, func(i, j int) bool {
+			return episodes[i].EpisodeNumber < episodes[j].EpisodeNumber
+		})
+		for _, episode := range episodes {
+			if seasonNumber == lastSeason && episode.EpisodeNumber <= lastEpisode {
+				continue
+			}
+			if watched[[2]int{seasonNumber, episode.EpisodeNumber}] {
+				continue
+			}
+			// caught up, next episode hasn't aired
+			if episode.AirDate == "" || episode.AirDate > today {
+				return nil, nil
+			}
+			return &UpNextEpisode{
+				Show:          show,
+				SeasonNumber:  seasonNumber,
+				EpisodeNumber: episode.EpisodeNumber,
+				EpisodeTitle:  episode.Name,
+				Overview:      episode.Overview,
+				AirDate:       episode.AirDate,
+				StillPath:     episode.StillPath,
+			}, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,269 @@
+package model
+
+import (
+	"encoding/json"
+	"hound/model/database"
+	"sort"
+	"time"
+)
+
+/*
+	Stats - watch statistics computed from history, library metadata and reviews.
+	Runtimes come from the tmdb data stored in library.full_data, games have no runtime.
+	Months and weekdays are bucketed in the user's timezone
+*/
+
+// number of entries in top genres and most rewatched
+const statsTopCount = 10
+
+type UserStats struct {
+	StartDate       *time.Time             `json:"start_date"`
+	EndDate         *time.Time             `json:"end_date"`
+	Timezone        string                 `json:"timezone"`
+	TotalWatches    int                    `json:"total_watches"`
+	TotalMinutes    int                    `json:"total_minutes"`
+	TotalHours      float64                `json:"total_hours"`
+	UnknownRuntime  int                    `json:"unknown_runtime"` // watches without a known runtime, not in totals
+	MediaTypes      map[string]*MediaStats `json:"media_types"`
+	TopGenres       []GenreStats           `json:"top_genres"`
+	MonthlyActivity []ActivityBucket       `json:"monthly_activity"` // YYYY-MM, oldest first
+	WeekdayActivity []ActivityBucket       `json:"weekday_activity"` // Sunday first
+	MostRewatched   []RewatchStats         `json:"most_rewatched"`
+	Scores          ScoreStats             `json:"scores"`
+}
+
+type MediaStats struct {
+	Watches int `json:"watches"` // episodes for tv shows
+	Titles  int `json:"titles"`  // distinct movies, shows or games
+	Minutes int `json:"minutes"`
+}
+
+type GenreStats struct {
+	Genre   string `json:"genre"`
+	Watches int    `json:"watches"`
+	Minutes int    `json:"minutes"`
+}
+
+type ActivityBucket struct {
+	Label   string `json:"label"`
+	Watches int    `json:"watches"`
+	Minutes int    `json:"minutes"`
+}
+
+type RewatchStats struct {
+	LibraryID    int64   `json:"library_id"`
+	MediaType    string  `json:"media_type"`
+	MediaSource  string  `json:"media_source"`
+	SourceID     string  `json:"source_id"`
+	MediaTitle   string  `json:"media_title"`
+	Rewatches    int     `json:"rewatches"` // watches after the first, per episode for tv shows
+	ThumbnailURL *string `json:"thumbnail_url"`
+}
+
+type ScoreStats struct {
+	Reviews     int                 `json:"reviews"`
+	Average     *float64            `json:"average"` // 0-100, null without reviews
+	ByMediaType map[string]*float64 `json:"by_media_type"`
+}
+
+// runtimes in the stored tmdb details
+type runtimeData struct {
+	Runtime        int   `json:"runtime"`          // movies
+	EpisodeRunTime []int `json:"episode_run_time"` // tv shows
+}
+
+// GetUserStats computes watch statistics, optionally within a date range
+func GetUserStats(username string, startDate *time.Time, endDate *time.Time) (*UserStats, error) {
+	user, err := database.GetUser(username)
+	if err != nil {
+		return nil, err
+	}
+	location, err := time.LoadLocation(user.UserMeta.Timezone)
+	if err != nil || user.UserMeta.Timezone == "" {
+		location = time.UTC
+	}
+	history, _, err := database.GetHistory(database.HistoryQuery{
+		UserID:    user.Id,
+		StartDate: startDate,
+		EndDate:   endDate,
+	}, -1, -1)
+	if err != nil {
+		return nil, err
+	}
+	var libraryIDs []int64
+	seen := map[int64]bool{}
+	for _, item := range history {
+		if !seen[item.LibraryID] {
+			seen[item.LibraryID] = true
+			libraryIDs = append(libraryIDs, item.LibraryID)
+		}
+	}
+	records, err := database.GetLibraryRecords(libraryIDs)
+	if err != nil {
+		return nil, err
+	}
+	runtimes := map[int64]int{}
+	genres := map[int64][]string{}
+	for _, record := range records {
+		runtimes[record.LibraryID] = GetRuntime(record)
+		if record.Tags != nil {
+			for _, tag := range *record.Tags {
+				genres[record.LibraryID] = append(genres[record.LibraryID], tag.TagName)
+			}
+		}
+	}
+	stats := UserStats{
+		StartDate:       startDate,
+		EndDate:         endDate,
+		Timezone:        location.String(),
+		MediaTypes:      map[string]*MediaStats{},
+		TopGenres:       []GenreStats{},
+		MonthlyActivity: []ActivityBucket{},
+		WeekdayActivity: make([]ActivityBucket, 7),
+		MostRewatched:   []RewatchStats{},
+	}
+	for num := range stats.WeekdayActivity {
+		stats.WeekdayActivity[num].Label = time.Weekday(num).String()
+	}
+	titles := map[string]map[int64]bool{}
+	genreStats := map[string]*GenreStats{}
+	monthStats := map[string]*ActivityBucket{}
+	rewatches := map[int64]*RewatchStats{}
+	for _, item := range history {
+		minutes := runtimes[item.LibraryID]
+		stats.TotalWatches++
+		if minutes == 0 {
+			stats.UnknownRuntime++
+		}
+		stats.TotalMinutes += minutes
+		mediaStats, ok := stats.MediaTypes[item.MediaType]
+		if !ok {
+			mediaStats = &MediaStats{}
+			stats.MediaTypes[item.MediaType] = mediaStats
+			titles[item.MediaType] = map[int64]bool{}
+		}
+		mediaStats.Watches++
+		mediaStats.Minutes += minutes
+		titles[item.MediaType][item.LibraryID] = true
+		for _, genre := range genres[item.LibraryID] {
+			if _, ok := genreStats[genre]; !ok {
+				genreStats[genre] = &GenreStats{Genre: genre}
+			}
+			genreStats[genre].Watches++
+			genreStats[genre].Minutes += minutes
+		}
+		watchedAt := item.WatchedAt.In(location)
+		month := watchedAt.Format("2006-01")
+		if _, ok := monthStats[month]; !ok {
+			monthStats[month] = &ActivityBucket{Label: month}
+		}
+		monthStats[month].Watches++
+		monthStats[month].Minutes += minutes
+		stats.WeekdayActivity[watchedAt.Weekday()].Watches++
+		stats.WeekdayActivity[watchedAt.Weekday()].Minutes += minutes
+		if item.RewatchNumber > 0 {
+			if _, ok := rewatches[item.LibraryID]; !ok {
+				rewatches[item.LibraryID] = &RewatchStats{
+					LibraryID:    item.LibraryID,
+					MediaType:    item.MediaType,
+					MediaSource:  item.MediaSource,
+					SourceID:     item.SourceID,
+					MediaTitle:   item.MediaTitle,
+					ThumbnailURL: item.ThumbnailURL,
+				}
+			}
+			rewatches[item.LibraryID].Rewatches++
+		}
+	}
+	stats.TotalHours = float64(stats.TotalMinutes) / 60
+	for mediaType, mediaStats := range stats.MediaTypes {
+		mediaStats.Titles = len(titles[mediaType])
+	}
+	for _, genre := range genreStats {
+		stats.TopGenres = append(stats.TopGenres, *genre)
+	}
+	sort.Slice(stats.TopGenres, func(i, j int) bool {
+		if stats.TopGenres[i].Watches != stats.TopGenres[j].Watches {
+			return stats.TopGenres[i].Watches > stats.TopGenres[j].Watches
+		}
+		return stats.TopGenres[i].Genre < stats.TopGenres[j].Genre
+	})
+	if len(stats.TopGenres) > statsTopCount {
+		stats.TopGenres = stats.TopGenres[:statsTopCount]
+	}
+	for _, month := range monthStats {
+		stats.MonthlyActivity = append(stats.MonthlyActivity, *month)
+	}
+	sort.Slice(stats.MonthlyActivity, func(i, j int) bool {
+		return stats.MonthlyActivity[i].Label < stats.MonthlyActivity[j].Label
+	})
+	for _, item := range rewatches {
+		stats.MostRewatched = append(stats.MostRewatched, *item)
+	}
+	sort.Slice(stats.MostRewatched, func(i, j int) bool {
+		if stats.MostRewatched[i].Rewatches != stats.MostRewatched[j].Rewatches {
+			return stats.MostRewatched[i].Rewatches > stats.MostRewatched[j].Rewatches
+		}
+		return stats.MostRewatched[i].MediaTitle < stats.MostRewatched[j].MediaTitle
+	})
+	if len(stats.MostRewatched) > statsTopCount {
+		stats.MostRewatched = stats.MostRewatched[:statsTopCount]
+	}
+	stats.Scores, err = getScoreStats(user.Id, startDate, endDate)
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// GetRuntime returns the minutes of one watch of a movie or tv episode, 0 if unknown
+func GetRuntime(record database.LibraryRecord) int {
+	var data runtimeData
+	if err := json.Unmarshal(record.FullData, &data); err != nil {
+		return 0
+	}
+	switch record.MediaType {
+	case database.MediaTypeMovie:
+		return data.Runtime
+	case database.MediaTypeTVShow:
+		// tmdb lists a run time per distinct episode length, use the average
+		total, count := 0, 0
+		for _, runtime := range data.EpisodeRunTime {
+			if runtime > 0 {
+				total += runtime
+				count++
+			}
+		}
+		if count == 0 {
+			return 0
+		}
+		return total / count
+	}
+	return 0
+}
+
+func getScoreStats(userID int64, startDate *time.Time, endDate *time.Time) (ScoreStats, error) {
+	scoreStats := ScoreStats{ByMediaType: map[string]*float64{}}
+	reviews, err := database.GetUserReviews(userID, startDate, endDate)
+	if err != nil {
+		return scoreStats, err
+	}
+	total := 0
+	typeTotals := map[string]int{}
+	typeCounts := map[string]int{}
+	for _, review := range reviews {
+		total += review.Score
+		typeTotals[review.MediaType] += review.Score
+		typeCounts[review.MediaType]++
+	}
+	scoreStats.Reviews = len(reviews)
+	if len(reviews) > 0 {
+		average := float64(total) / float64(len(reviews))
+		scoreStats.Average = &average
+	}
+	for mediaType, count := range typeCounts {
+		average := float64(typeTotals[mediaType]) / float64(count)
+		scoreStats.ByMediaType[mediaType] = &average
+	}
+	return scoreStats, nil
+}
@@ -0,0 +1,92 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"errors"
+	"hound/helpers"
+	"hound/model/database"
+	"strconv"
+)
+
+/*
+	Jellyfin webhooks - json from the jellyfin webhook plugin. The plugin renders a user
+	defined template, numbers may be quoted or not so they are parsed as jsonNumber.
+	Positions are in ticks, 10,000,000 per second
+*/
+
+const jellyfinTicksPerSecond = 10000000
+
+var jellyfinEvents = map[string]string{
+	"PlaybackStart":    EventPlay,
+	"PlaybackProgress": EventProgress,
+	"PlaybackStop":     EventStop,
+}
+
+type jellyfinPayload struct {
+	NotificationType      string      `json:"NotificationType"`
+	NotificationUsername  string      `json:"NotificationUsername"`
+	ItemType              string      `json:"ItemType"` // Movie, Episode, Audio...
+	Name                  string      `json:"Name"`
+	SeriesName            string      `json:"SeriesName"`
+	SeasonNumber          *jsonNumber `json:"SeasonNumber"`
+	EpisodeNumber         *jsonNumber `json:"EpisodeNumber"`
+	Year                  jsonNumber  `json:"Year"`
+	ProviderTMDB          string      `json:"Provider_tmdb"`
+	ProviderIMDb          string      `json:"Provider_imdb"`
+	ProviderTVDB          string      `json:"Provider_tvdb"`
+	PlaybackPositionTicks jsonNumber  `json:"PlaybackPositionTicks"`
+	RunTimeTicks          jsonNumber  `json:"RunTimeTicks"`
+	PlayedToCompletion    interface{} `json:"PlayedToCompletion"` // bool, or "True"/"False"
+}
+
+// ParseJellyfin parses a jellyfin webhook plugin payload, unsupported events return nil
+func ParseJellyfin(body []byte) (*Event, error) {
+	var data jellyfinPayload
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid jellyfin webhook payload")
+	}
+	eventType, ok := jellyfinEvents[data.NotificationType]
+	if !ok {
+		return nil, nil
+	}
+	if eventType == EventStop && isTrue(data.PlayedToCompletion) {
+		eventType = EventScrobble
+	}
+	tmdbID, _ := strconv.Atoi(data.ProviderTMDB)
+	event := Event{
+		Event:    eventType,
+		Account:  data.NotificationUsername,
+		Title:    data.Name,
+		Year:     int(data.Year),
+		Position: int(data.PlaybackPositionTicks / jellyfinTicksPerSecond),
+		Duration: int(data.RunTimeTicks / jellyfinTicksPerSecond),
+	}
+	switch data.ItemType {
+	case "Movie":
+		event.MediaType = database.MediaTypeMovie
+		event.IDs = ExternalIDs{TMDB: tmdbID, IMDb: data.ProviderIMDb, TVDB: data.ProviderTVDB}
+	case "Episode":
+		if data.SeasonNumber == nil || data.EpisodeNumber == nil {
+			return nil, nil
+		}
+		seasonNumber, episodeNumber := int(*data.SeasonNumber), int(*data.EpisodeNumber)
+		event.MediaType = database.MediaTypeTVShow
+		event.IDs = ExternalIDs{IMDb: data.ProviderIMDb, TVDB: data.ProviderTVDB}
+		event.ShowTitle = data.SeriesName
+		event.SeasonNumber, event.EpisodeNumber = &seasonNumber, &episodeNumber
+	default:
+		return nil, nil
+	}
+	return &event, nil
+}
+
+func isTrue(value interface{}) bool {
+	switch value := value.(type) {
+	case bool:
+		return value
+	case string:
+		parsed, _ := strconv.ParseBool(value)
+		return parsed
+	}
+	return false
+}
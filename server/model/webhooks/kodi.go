@@ -0,0 +1,83 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"errors"
+	"hound/helpers"
+	"hound/model/database"
+	"strconv"
+)
+
+/*
+	Kodi webhooks - a simple json format for kodi add-ons and other players without
+	webhooks of their own. event is play, pause, stop, progress or scrobble, media_type
+	is movie or episode, ids of episodes are episode ids and show_ids the show's.
+	Position and duration are in seconds
+*/
+
+type kodiIDs struct {
+	TMDB jsonNumber `json:"tmdb"`
+	IMDb string     `json:"imdb"`
+	TVDB jsonNumber `json:"tvdb"`
+}
+
+func (ids kodiIDs) externalIDs() ExternalIDs {
+	externalIDs := ExternalIDs{TMDB: int(ids.TMDB), IMDb: ids.IMDb}
+	if ids.TVDB > 0 {
+		externalIDs.TVDB = strconv.FormatInt(int64(ids.TVDB), 10)
+	}
+	return externalIDs
+}
+
+type kodiPayload struct {
+	Event     string  `json:"event"`
+	MediaType string  `json:"media_type"`
+	Account   string  `json:"account"`
+	Title     string  `json:"title"`
+	Year      int     `json:"year"`
+	IDs       kodiIDs `json:"ids"`
+	ShowTitle string  `json:"show_title"`
+	ShowIDs   kodiIDs `json:"show_ids"`
+	Season    *int    `json:"season"`
+	Episode   *int    `json:"episode"`
+	Position  int     `json:"position"`
+	Duration  int     `json:"duration"`
+}
+
+// ParseKodi parses a kodi webhook payload
+func ParseKodi(body []byte) (*Event, error) {
+	var data kodiPayload
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid kodi webhook payload")
+	}
+	switch data.Event {
+	case EventPlay, EventPause, EventStop, EventProgress, EventScrobble:
+	default:
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "event must be play, pause, stop, progress or scrobble")
+	}
+	event := Event{
+		Event:    data.Event,
+		Account:  data.Account,
+		Title:    data.Title,
+		Year:     data.Year,
+		IDs:      data.IDs.externalIDs(),
+		Position: data.Position,
+		Duration: data.Duration,
+	}
+	switch data.MediaType {
+	case database.MediaTypeMovie:
+		event.MediaType = database.MediaTypeMovie
+	case "episode":
+		if data.Season == nil || data.Episode == nil {
+			return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "season and episode are required for episodes")
+		}
+		event.MediaType = database.MediaTypeTVShow
+		event.IDs.TMDB = 0
+		event.ShowTitle = data.ShowTitle
+		event.ShowIDs = data.ShowIDs.externalIDs()
+		event.SeasonNumber, event.EpisodeNumber = data.Season, data.Episode
+	default:
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "media_type must be movie or episode")
+	}
+	return &event, nil
+}
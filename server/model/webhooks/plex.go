@@ -0,0 +1,141 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"errors"
+	"hound/helpers"
+	"hound/model/database"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+/*
+	Plex webhooks - multipart form posts, the json is in the payload field. Plex sends
+	media.scrobble once an item is 90% watched. New agents list external ids in Guid
+	(imdb://, tmdb://, tvdb://), legacy agents put one id in guid, eg.
+	com.plexapp.agents.themoviedb://603?lang=en or com.plexapp.agents.thetvdb://81189/1/2?lang=en
+*/
+
+var plexEvents = map[string]string{
+	"media.play":     EventPlay,
+	"media.resume":   EventPlay,
+	"media.pause":    EventPause,
+	"media.stop":     EventStop,
+	"media.scrobble": EventScrobble,
+}
+
+type plexGuid struct {
+	ID string `json:"id"`
+}
+
+type plexPayload struct {
+	Event   string `json:"event"`
+	Account struct {
+		Title string `json:"title"`
+	} `json:"Account"`
+	Metadata *struct {
+		Type             string     `json:"type"` // movie, episode, track...
+		Title            string     `json:"title"`
+		GrandparentTitle string     `json:"grandparentTitle"` // show title of episodes
+		ParentIndex      *int       `json:"parentIndex"`      // season number of episodes
+		Index            *int       `json:"index"`            // episode number of episodes
+		Year             int        `json:"year"`
+		Guid             string     `json:"guid"`
+		Guids            []plexGuid `json:"Guid"`
+		ViewOffset       int        `json:"viewOffset"` // milliseconds
+		Duration         int        `json:"duration"`   // milliseconds
+	} `json:"Metadata"`
+}
+
+// ParsePlex parses the payload field of a plex webhook, unsupported events return nil
+func ParsePlex(payload string) (*Event, error) {
+	var data plexPayload
+	if err := json.Unmarshal([]byte(payload), &data); err != nil {
+		return nil, helpers.LogErrorWithMessage(errors.New(helpers.BadRequest), "Invalid plex webhook payload")
+	}
+	eventType, ok := plexEvents[data.Event]
+	if !ok || data.Metadata == nil {
+		return nil, nil
+	}
+	metadata := data.Metadata
+	event := Event{
+		Event:    eventType,
+		Account:  data.Account.Title,
+		Title:    metadata.Title,
+		Year:     metadata.Year,
+		Position: metadata.ViewOffset / 1000,
+		Duration: metadata.Duration / 1000,
+	}
+	var ids ExternalIDs
+	for _, guid := range metadata.Guids {
+		setPlexGuid(&ids, guid.ID)
+	}
+	switch metadata.Type {
+	case "movie":
+		event.MediaType = database.MediaTypeMovie
+		event.IDs = ids
+		setPlexLegacyGuid(&event, metadata.Guid)
+	case "episode":
+		event.MediaType = database.MediaTypeTVShow
+		event.IDs = ExternalIDs{IMDb: ids.IMDb, TVDB: ids.TVDB}
+		event.ShowTitle = metadata.GrandparentTitle
+		event.SeasonNumber = metadata.ParentIndex
+		event.EpisodeNumber = metadata.Index
+		setPlexLegacyGuid(&event, metadata.Guid)
+	default:
+		return nil, nil
+	}
+	return &event, nil
+}
+
+// setPlexGuid sets an id from the Guid list, eg. imdb://tt0133093
+func setPlexGuid(ids *ExternalIDs, guid string) {
+	source, id, found := strings.Cut(guid, "://")
+	if !found {
+		return
+	}
+	switch source {
+	case "imdb":
+		ids.IMDb = id
+	case "tmdb":
+		ids.TMDB, _ = strconv.Atoi(id)
+	case "tvdb":
+		ids.TVDB = id
+	}
+}
+
+// setPlexLegacyGuid sets ids from legacy agent guids, episode guids are show id/season/episode
+func setPlexLegacyGuid(event *Event, guid string) {
+	parsed, err := url.Parse(guid)
+	if err != nil || !strings.HasPrefix(parsed.Scheme, "com.plexapp.agents.") {
+		return
+	}
+	agent := strings.TrimPrefix(parsed.Scheme, "com.plexapp.agents.")
+	parts := strings.Split(strings.Trim(parsed.Host+parsed.Path, "/"), "/")
+	ids := &event.IDs
+	if event.MediaType == database.MediaTypeTVShow {
+		ids = &event.ShowIDs
+		if len(parts) == 3 {
+			seasonNumber, seasonErr := strconv.Atoi(parts[1])
+			episodeNumber, episodeErr := strconv.Atoi(parts[2])
+			if seasonErr == nil && episodeErr == nil && event.SeasonNumber == nil {
+				event.SeasonNumber, event.EpisodeNumber = &seasonNumber, &episodeNumber
+			}
+		}
+	}
+	switch agent {
+	case "imdb":
+		if ids.IMDb == "" {
+			ids.IMDb = parts[0]
+		}
+	case "themoviedb":
+		if ids.TMDB == 0 {
+			ids.TMDB, _ = strconv.Atoi(parts[0])
+		}
+	case "thetvdb":
+		if ids.TVDB == "" {
+			ids.TVDB = parts[0]
+		}
+	}
+}
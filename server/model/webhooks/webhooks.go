@@ -0,0 +1,262 @@
+package webhooks
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hound/helpers"
+	"hound/model"
+	"hound/model/database"
+	"hound/model/sources"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+	Scrobble webhooks - Plex, Jellyfin and Kodi post playback events to hound. Payloads
+	are parsed into Events, resolved to tmdb items and reported as playback progress,
+	so watches past playback.watched-threshold are recorded in history
+*/
+
+const (
+	SourcePlex     = "plex"
+	SourceJellyfin = "jellyfin"
+	SourceKodi     = "kodi"
+)
+
+const (
+	EventPlay     = "play"
+	EventPause    = "pause"
+	EventStop     = "stop"
+	EventProgress = "progress"
+	// the player considers the item watched
+	EventScrobble = "scrobble"
+)
+
+const (
+	ActionWatched  = "watched"  // recorded in history
+	ActionProgress = "progress" // playback position stored
+	ActionIgnored  = "ignored"
+)
+
+// resolved items are cached, players report progress every few seconds.
+// Misses are cached for less time, the item may be added to tmdb later
+const (
+	matchCacheTTL     = 6 * time.Hour
+	matchMissCacheTTL = 30 * time.Minute
+)
+
+// ExternalIDs are the ids a player knows an item by, empty if unknown
+type ExternalIDs struct {
+	TMDB int
+	IMDb string
+	TVDB string
+}
+
+// Event is a playback event parsed from a webhook payload
+type Event struct {
+	Event     string // play, pause, stop, progress or scrobble
+	Account   string // player account or user name, matched against the account filter
+	MediaType string // movie or tvshow
+	Title     string // movie or episode title
+	Year      int
+	IDs       ExternalIDs // movie or episode ids
+	// episodes only
+	ShowTitle     string
+	ShowIDs       ExternalIDs
+	SeasonNumber  *int
+	EpisodeNumber *int
+	Position      int // seconds, 0 if unknown
+	Duration      int // seconds, 0 if unknown
+}
+
+type Result struct {
+	Action        string `json:"action"`
+	Reason        string `json:"reason,omitempty"` // why the event was ignored
+	MediaType     string `json:"media_type,omitempty"`
+	TMDBID        int    `json:"tmdb_id,omitempty"`
+	LibraryID     int64  `json:"library_id,omitempty"`
+	SeasonNumber  *int   `json:"season_number,omitempty"`
+	EpisodeNumber *int   `json:"episode_number,omitempty"`
+}
+
+// GenerateToken creates or replaces the user's webhook token, the raw token is only returned here
+func GenerateToken(userID int64) (string, *database.WebhookTokenRecord, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", nil, helpers.LogErrorWithMessage(err, "Failed to generate webhook token")
+	}
+	token := hex.EncodeToString(b)
+	record, err := database.SetWebhookToken(userID, hashToken(token))
+	if err != nil {
+		return "", nil, err
+	}
+	return token, record, nil
+}
+
+// Authenticate returns the user a webhook token belongs to
+func Authenticate(token string) (int64, error) {
+	if token == "" {
+		return -1, helpers.LogErrorWithMessage(errors.New(helpers.Unauthorized), "Missing webhook token")
+	}
+	return database.GetUserIDFromWebhookToken(hashToken(token))
+}
+
+// jsonNumber is a number that may be sent as a json string, empty strings are 0
+type jsonNumber int64
+
+func (number *jsonNumber) UnmarshalJSON(data []byte) error {
+	value := strings.Trim(string(data), `"`)
+	if value == "" || value == "null" {
+		*number = 0
+		return nil
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return err
+	}
+	*number = jsonNumber(parsed)
+	return nil
+}
+
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// Handle records a playback event for a user. account filters events from shared servers,
+// events from other accounts are ignored when it is set
+func Handle(userID int64, event *Event, account string) (*Result, error) {
+	if event == nil {
+		return &Result{Action: ActionIgnored, Reason: "unsupported event"}, nil
+	}
+	if account != "" && !strings.EqualFold(account, event.Account) {
+		return &Result{Action: ActionIgnored, Reason: "event from another account"}, nil
+	}
+	if event.MediaType != database.MediaTypeMovie && event.MediaType != database.MediaTypeTVShow {
+		return &Result{Action: ActionIgnored, Reason: "only movies and episodes are tracked"}, nil
+	}
+	position, duration := event.Position, event.Duration
+	if event.Event == EventScrobble {
+		if duration <= 0 {
+			duration = 1
+		}
+		position = duration
+	} else if position <= 0 || duration <= 0 {
+		// play events are sent before the player knows the position
+		return &Result{Action: ActionIgnored, Reason: "no playback position"}, nil
+	}
+	match, err := resolve(event)
+	if err != nil {
+		return nil, err
+	}
+	if match == nil {
+		return &Result{Action: ActionIgnored, Reason: "no match on tmdb"}, nil
+	}
+	seasonNumber, episodeNumber := event.SeasonNumber, event.EpisodeNumber
+	if match.MediaType == database.MediaTypeTVShow {
+		// episode ids resolve to the show and episode
+		if seasonNumber == nil || episodeNumber == nil {
+			seasonNumber, episodeNumber = match.SeasonNumber, match.EpisodeNumber
+		}
+		if seasonNumber == nil || episodeNumber == nil {
+			return &Result{Action: ActionIgnored, Reason: "episode without season and episode number"}, nil
+		}
+	} else {
+		seasonNumber, episodeNumber = nil, nil
+	}
+	libraryID, err := getLibraryID(match.MediaType, match.TMDBID)
+	if err != nil {
+		return nil, err
+	}
+	progress, err := model.ReportProgress(userID, libraryID, seasonNumber, episodeNumber, position, duration)
+	if err != nil {
+		return nil, err
+	}
+	result := Result{
+		Action:        ActionProgress,
+		MediaType:     match.MediaType,
+		TMDBID:        match.TMDBID,
+		LibraryID:     libraryID,
+		SeasonNumber:  seasonNumber,
+		EpisodeNumber: episodeNumber,
+	}
+	if progress.Watched {
+		result.Action = ActionWatched
+	}
+	return &result, nil
+}
+
+// resolve finds the tmdb item of an event by tmdb id, imdb and tvdb ids, then title and year
+func resolve(event *Event) (*sources.TMDBMatch, error) {
+	if event.MediaType == database.MediaTypeMovie {
+		if event.IDs.TMDB > 0 {
+			return &sources.TMDBMatch{MediaType: database.MediaTypeMovie, TMDBID: event.IDs.TMDB}, nil
+		}
+		return findMatch(database.MediaTypeMovie, event.IDs, event.Title, event.Year)
+	}
+	if event.ShowIDs.TMDB > 0 {
+		return &sources.TMDBMatch{MediaType: database.MediaTypeTVShow, TMDBID: event.ShowIDs.TMDB}, nil
+	}
+	// ids of episode events are episode ids, tmdb episode ids can't be looked up so parsers
+	// leave them out and only imdb and tvdb are used
+	match, err := findMatch(database.MediaTypeTVShow, ExternalIDs{IMDb: event.IDs.IMDb, TVDB: event.IDs.TVDB}, "", 0)
+	if err != nil || match != nil {
+		return match, err
+	}
+	return findMatch(database.MediaTypeTVShow, event.ShowIDs, event.ShowTitle, 0)
+}
+
+// findMatch looks up imdb and tvdb ids, then searches the title, results and misses are cached
+func findMatch(mediaType string, ids ExternalIDs, title string, year int) (*sources.TMDBMatch, error) {
+	lookups := []struct {
+		source string
+		key    string
+		lookup func() (*sources.TMDBMatch, error)
+	}{
+		{"imdb", ids.IMDb, func() (*sources.TMDBMatch, error) { return sources.FindByExternalIDTMDB(ids.IMDb, "imdb_id") }},
+		{"tvdb", ids.TVDB, func() (*sources.TMDBMatch, error) { return sources.FindByExternalIDTMDB(ids.TVDB, "tvdb_id") }},
+		{"title", title, func() (*sources.TMDBMatch, error) { return sources.SearchByTitleTMDB(mediaType, title, year) }},
+	}
+	for _, item := range lookups {
+		if item.key == "" {
+			continue
+		}
+		cacheKey := fmt.Sprintf("webhook-match-%s-%s-%s-%d", mediaType, item.source, item.key, year)
+		if cached, ok := model.GetCache(cacheKey); ok {
+			if match := cached.(*sources.TMDBMatch); match != nil {
+				return match, nil
+			}
+			continue
+		}
+		match, err := item.lookup()
+		if err != nil {
+			return nil, err
+		}
+		// an imdb id can belong to something else, eg. a movie reported as an episode
+		if match == nil || match.MediaType != mediaType {
+			_ = model.SetCache(cacheKey, (*sources.TMDBMatch)(nil), matchMissCacheTTL)
+			continue
+		}
+		_ = model.SetCache(cacheKey, match, matchCacheTTL)
+		return match, nil
+	}
+	return nil, nil
+}
+
+// getLibraryID returns the library id of a tmdb item, adding it to the library if needed
+func getLibraryID(mediaType string, tmdbID int) (int64, error) {
+	sourceID := strconv.Itoa(tmdbID)
+	if libraryID, err := database.GetInternalLibraryID(mediaType, sources.SourceTMDB, sourceID); err == nil {
+		return *libraryID, nil
+	}
+	record, err := sources.GetLibraryObjectTMDB(mediaType, tmdbID)
+	if err != nil {
+		return -1, err
+	}
+	return database.AddRecordToInternalLibrary(record)
+}
@@ -0,0 +1,26 @@
+package view
+
+import "time"
+
+type HistoryObject struct {
+	HistoryID     int64     `json:"history_id"`
+	LibraryID     int64     `json:"library_id"`
+	MediaType     string    `json:"media_type"`
+	MediaSource   string    `json:"media_source"`
+	SourceID      string    `json:"source_id"`
+	MediaTitle    string    `json:"media_title"`
+	ThumbnailURL  *string   `json:"thumbnail_url"`
+	SeasonNumber  *int      `json:"season_number"`
+	EpisodeNumber *int      `json:"episode_number"`
+	WatchedAt     time.Time `json:"watched_at"`
+	RewatchNumber int       `json:"rewatch_number"`
+	Notes         string    `json:"notes"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type HistoryView struct {
+	Results      *[]HistoryObject `json:"results"`
+	TotalRecords int64            `json:"total_records"`
+	Limit        int              `json:"limit"`
+	Offset       int              `json:"offset"`
+}
@@ -14,6 +14,14 @@ type CollectionView struct {
 	Offset       int                   `json:"offset"`
 }
 
+type TrendingView struct {
+	Results      *[]LibraryObject `json:"results"`
+	Page         int              `json:"page"`
+	TotalPages   int64            `json:"total_pages"`
+	TotalResults int64            `json:"total_results"`
+	TimeWindow   string           `json:"time_window"` // day, week
+}
+
 // store user saved libraries
 type LibraryObject struct {
 	MediaType    string      `json:"media_type"`    // books,tvshows, etc.
@@ -34,16 +42,57 @@ type GeneralSearchResponse struct {
 }
 
 type CollectionRecordView struct {
-	CollectionID    int64                 `json:"collection_id"`
-	CollectionTitle string                `json:"collection_title"` // my collection, etc.
-	Description     string                `json:"description"`
-	Username        string                `json:"owner_user_id"`
-	IsPrimary       bool                  `json:"is_primary"` // is the user's primary collection, not deletable
-	IsPublic        bool                  `json:"is_public"`
-	Tags            *[]database.TagObject `json:"tags"`
-	ThumbnailURL    *string               `json:"thumbnail_url"` // url for media thumbnails
-	CreatedAt       time.Time             `json:"created_at"`
-	UpdatedAt       time.Time             `json:"updated_at"`
+	CollectionID    int64                     `json:"collection_id"`
+	CollectionTitle string                    `json:"collection_title"` // my collection, etc.
+	Description     string                    `json:"description"`
+	Username        string                    `json:"owner_user_id"`
+	IsPrimary       bool                      `json:"is_primary"` // is the user's primary collection, not deletable
+	IsPublic        bool                      `json:"is_public"`
+	Tags            *[]database.TagObject     `json:"tags"`
+	ThumbnailURL    *string                   `json:"thumbnail_url"` // url for media thumbnails
+	Rules           *database.CollectionRules `json:"rules"`         // set for smart collections
+	CreatedAt       time.Time                 `json:"created_at"`
+	UpdatedAt       time.Time                 `json:"updated_at"`
+}
+
+// CollectionMemberObject is a member of a shared collection, or a pending invite
+type CollectionMemberObject struct {
+	CollectionID int64     `json:"collection_id"`
+	Username     string    `json:"username"`
+	Role         string    `json:"role"` // viewer, editor, owner
+	InvitedBy    string    `json:"invited_by"`
+	IsAccepted   bool      `json:"is_accepted"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// PublicCollectionObject is a public collection with its item and follower counts
+type PublicCollectionObject struct {
+	CollectionRecordView
+	ItemCount     int64 `json:"item_count"`
+	FollowerCount int64 `json:"follower_count"`
+	IsFollowing   bool  `json:"is_following"`
+}
+
+type PublicCollectionsView struct {
+	Results      *[]PublicCollectionObject `json:"results"`
+	TotalRecords int                       `json:"total_records"`
+	Limit        int                       `json:"limit"`
+	Offset       int                       `json:"offset"`
+}
+
+// CommentEditObject is a previous version of a comment
+type CommentEditObject struct {
+	EditID       int64     `json:"edit_id"`
+	CommentID    int64     `json:"comment_id"`
+	CommentType  string    `json:"comment_type"`
+	IsPrivate    bool      `json:"is_private"`
+	CommentTitle string    `json:"title"`
+	Comment      string    `json:"comment"`
+	TagData      string    `json:"tag_data"`
+	Score        int       `json:"score"`
+	StartDate    time.Time `json:"start_date"`
+	EndDate      time.Time `json:"end_date"`
+	EditedAt     time.Time `json:"edited_at"`
 }
 
 type CommentObject struct {
@@ -61,3 +110,17 @@ type CommentObject struct {
 	CreatedAt    time.Time `xorm:"created" json:"created_at"`
 	UpdatedAt    time.Time `xorm:"updated" json:"updated_at"`
 }
+
+// RecommendationObject is a title recommended from the user's library and ratings
+type RecommendationObject struct {
+	MediaType    string   `json:"media_type"`
+	MediaSource  string   `json:"media_source"`
+	SourceID     string   `json:"source_id"`
+	MediaTitle   string   `json:"media_title"`
+	Overview     string   `json:"overview"`
+	ReleaseDate  string   `json:"release_date"`
+	ThumbnailURL string   `json:"thumbnail_url"`
+	VoteAverage  float32  `json:"vote_average"`
+	Score        float64  `json:"score"`   // ranking score, higher is a better match
+	Reasons      []string `json:"reasons"` // eg. because you rated X
+}
@@ -0,0 +1,61 @@
+package view
+
+import (
+	"hound/model/database"
+	"time"
+)
+
+type MediaFileObject struct {
+	FileID        int64     `json:"file_id"`
+	Path          string    `json:"path"`
+	LibraryRoot   string    `json:"library_root"`
+	Size          int64     `json:"size"`
+	ModTime       time.Time `json:"mod_time"`
+	MatchStatus   string    `json:"match_status"`
+	MediaType     string    `json:"media_type"`
+	ParsedTitle   string    `json:"parsed_title"`
+	ParsedYear    *int      `json:"parsed_year"`
+	SeasonNumber  *int      `json:"season_number"`
+	EpisodeNumber *int      `json:"episode_number"`
+	LibraryID     *int64    `json:"library_id"`
+	MediaSource   *string   `json:"media_source"`
+	SourceID      *string   `json:"source_id"`
+	MediaTitle    *string   `json:"media_title"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+type MediaFilesView struct {
+	Results      *[]MediaFileObject `json:"results"`
+	TotalRecords int64              `json:"total_records"`
+	Limit        int                `json:"limit"`
+	Offset       int                `json:"offset"`
+}
+
+// StreamableFileObject is a local file of a movie or episode, listed on detail responses
+type StreamableFileObject struct {
+	FileID        int64            `json:"file_id"`
+	FileName      string           `json:"file_name"`
+	Size          int64            `json:"size"`
+	MimeType      string           `json:"mime_type"`
+	SeasonNumber  *int             `json:"season_number"`
+	EpisodeNumber *int             `json:"episode_number"`
+	StreamURL     string           `json:"stream_url"`
+	Subtitles     []SubtitleObject `json:"subtitles"`
+}
+
+type SubtitleObject struct {
+	Name     string  `json:"name"`
+	Format   string  `json:"format"` // srt, ass or vtt, srt is served as vtt unless ?format=srt
+	Language *string `json:"language"`
+	Forced   bool    `json:"forced"`
+	SDH      bool    `json:"sdh"`
+	URL      string  `json:"url"`
+}
+
+type OrganizerOperationsView struct {
+	Results      *[]database.OrganizerOperation `json:"results"`
+	TotalRecords int64                          `json:"total_records"`
+	Limit        int                            `json:"limit"`
+	Offset       int                            `json:"offset"`
+}
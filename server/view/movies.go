@@ -38,4 +38,6 @@ type MovieFullObject struct {
 	Recommendations *tmdb.MovieRecommendations `json:"recommendations"`
 	WatchProviders  *tmdb.MovieWatchProviders  `json:"watch_providers"`
 	Comments        *[]CommentObject           `json:"comments"`
+	Files           *[]StreamableFileObject    `json:"files"`
+	Resume          *ProgressObject            `json:"resume"` // null if not in progress
 }
@@ -0,0 +1,25 @@
+package view
+
+import "time"
+
+type ProgressObject struct {
+	ProgressID    int64     `json:"progress_id"`
+	LibraryID     int64     `json:"library_id"`
+	MediaType     string    `json:"media_type"`
+	MediaSource   string    `json:"media_source"`
+	SourceID      string    `json:"source_id"`
+	MediaTitle    string    `json:"media_title"`
+	ThumbnailURL  *string   `json:"thumbnail_url"`
+	SeasonNumber  *int      `json:"season_number"`
+	EpisodeNumber *int      `json:"episode_number"`
+	Position      int       `json:"position"` // seconds
+	Duration      int       `json:"duration"` // seconds
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+type ProgressView struct {
+	Results      *[]ProgressObject `json:"results"`
+	TotalRecords int64             `json:"total_records"`
+	Limit        int               `json:"limit"`
+	Offset       int               `json:"offset"`
+}
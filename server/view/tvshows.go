@@ -3,6 +3,7 @@ package view
 import (
 	tmdb "github.com/cyruzin/golang-tmdb"
 	"hound/model/sources"
+	"time"
 )
 
 type TVGenre struct {
@@ -28,10 +29,12 @@ type TMDBSearchResultObject struct {
 }
 
 type TVSeasonResponseObject struct {
-	MediaSource     string                `json:"media_source"` // tmdb, openlibrary, etc
-	SourceID        int64                 `json:"source_id"`
-	SeasonData      *tmdb.TVSeasonDetails `json:"season"`
-	SeasonWatchInfo *[]CommentObject        `json:"watch_info"`
+	MediaSource     string                  `json:"media_source"` // tmdb, openlibrary, etc
+	SourceID        int64                   `json:"source_id"`
+	SeasonData      *tmdb.TVSeasonDetails   `json:"season"`
+	SeasonWatchInfo *[]HistoryObject        `json:"watch_info"`
+	Files           *[]StreamableFileObject `json:"files"`
+	Progress        *[]ProgressObject       `json:"progress"` // in-progress episodes of the season
 }
 
 type TVShowResults struct {
@@ -110,3 +113,17 @@ type TVShowFullObject struct {
 	WatchProviders   *tmdb.TVWatchProviders  `json:"watch_providers"`
 	Comments         *[]CommentObject        `json:"comments"`
 }
+
+type UpNextObject struct {
+	MediaSource   string    `json:"media_source"`
+	SourceID      string    `json:"source_id"`
+	MediaTitle    string    `json:"media_title"`
+	ThumbnailURL  *string   `json:"thumbnail_url"`
+	SeasonNumber  int       `json:"season_number"`
+	EpisodeNumber int       `json:"episode_number"`
+	EpisodeTitle  string    `json:"episode_title"`
+	Overview      string    `json:"overview"`
+	AirDate       string    `json:"air_date"`
+	StillURL      string    `json:"still_url"`
+	LastWatchedAt time.Time `json:"last_watched_at"`
+}
@@ -0,0 +1,36 @@
+package view
+
+import (
+	"hound/model/database"
+	"time"
+)
+
+type UserProfileView struct {
+	UserID    int64             `json:"user_id"`
+	Username  string            `json:"username"`
+	FirstName string            `json:"first_name"`
+	LastName  string            `json:"last_name"`
+	UserMeta  database.UserMeta `json:"user_meta"`
+	IsAdmin   bool              `json:"is_admin"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+type AdminUserView struct {
+	UserID     int64             `json:"user_id"`
+	Username   string            `json:"username"`
+	FirstName  string            `json:"first_name"`
+	LastName   string            `json:"last_name"`
+	UserMeta   database.UserMeta `json:"user_meta"`
+	IsAdmin    bool              `json:"is_admin"`
+	IsDisabled bool              `json:"is_disabled"`
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+}
+
+type AdminUsersView struct {
+	Results      *[]AdminUserView `json:"results"`
+	TotalRecords int64            `json:"total_records"`
+	Limit        int              `json:"limit"`
+	Offset       int              `json:"offset"`
+}
@@ -16,21 +16,22 @@ function HistoryTable(props: any) {
     if (!isDataLoaded) {
       axios
         .get(
-          `/api/v1/${mediaType}/${props.data.media_source}-${props.data.source_id}/comments?type=history`
+          `/api/v1/history?media_type=${props.data.media_type}&media_source=${props.data.media_source}&source_id=${props.data.source_id}`
         )
         .then((res) => {
-          if (res.data) {
+          if (res.data.results) {
             var temp: any[][] = [];
-            res.data.map((item: any) => {
-              var seasonEpisode = item.tag_data.split("E");
-              var title = item.title ? item.title : props.data.media_title;
+            res.data.results.map((item: any) => {
+              var title = item.media_title
+                ? item.media_title
+                : props.data.media_title;
               temp.push([
                 title,
-                parseInt(seasonEpisode[0].substring(1)),
-                parseInt(seasonEpisode[1]),
-                item.start_date.split("T")[0],
-                item.comment,
-                item.comment_id,
+                item.season_number,
+                item.episode_number,
+                item.watched_at.split("T")[0],
+                item.notes,
+                item.history_id,
               ]);
               return false;
             });
@@ -52,7 +53,7 @@ function HistoryTable(props: any) {
       const idsToDelete = rowsDeleted.data.map((d) => {
         return data[d.dataIndex][5];
       }); // array of all ids to to be deleted
-      axios.delete(`/api/v1/comments?ids=${idsToDelete}`).catch((err) => {
+      axios.delete(`/api/v1/history?ids=${idsToDelete}`).catch((err) => {
         console.log(err);
       });
     },
@@ -78,7 +79,7 @@ function HistoryTable(props: any) {
       name: "Notes",
       options: mediaType === "tv" ? excludeDisplay : includeDisplay,
     },
-    { name: "comment_id", options: excludeDisplay },
+    { name: "history_id", options: excludeDisplay },
   ];
   if (isDataLoaded && data[0].length === 0) {
     return <div className="history-no-data-header">No watch data.</div>;
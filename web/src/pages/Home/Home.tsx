@@ -27,7 +27,7 @@ function Home() {
       axios
         .get("/api/v1/tv/trending")
         .then((res) => {
-          setTrendingTVShows(res.data);
+          setTrendingTVShows(res.data.results);
           setIsTrendingTVShowsLoaded(true);
         })
         .catch((err) => {
@@ -60,7 +60,7 @@ function Home() {
       axios
         .get("/api/v1/movie/trending")
         .then((res) => {
-          setTrendingMovies(res.data);
+          setTrendingMovies(res.data.results);
           setIsTrendingMoviesLoaded(true);
         })
         .catch((err) => {
@@ -109,8 +109,8 @@ function SeasonModal(props: any) {
           setSeasonData(res.data);
           if (res.data.watch_info) {
             setWatchedEpisodes(
-              res.data.watch_info.map((item: { tag_data: string }) =>
-                parseInt(item.tag_data.split("E")[1])
+              res.data.watch_info.map(
+                (item: { episode_number: number }) => item.episode_number
               )
             );
           } else {